@@ -81,12 +81,16 @@ type Bot struct {
 	stats      *Stats
 	tracker    *RoomTracker
 	mode       string
+	queue      string
+	rematch    float64
 	mu         sync.RWMutex
 	playerID   string
 	roomID     string
+	phase      protocol.RoomPhase
 	players    []string
 	matchStart time.Time
 	rng        *rand.Rand
+	lastAcked  uint64
 }
 
 func main() {
@@ -94,6 +98,8 @@ func main() {
 	bots := flag.Int("bots", 100, "number of bots")
 	rooms := flag.Int("rooms", 50, "expected rooms")
 	mode := flag.String("mode", "mixed", "mode: move|skillspam|mixed")
+	queue := flag.String("queue", "default", "match mode to queue for: default|2v2|3v3")
+	rematch := flag.Float64("rematch", 0.5, "chance to vote for a rematch")
 	flag.Parse()
 	tracker := NewRoomTracker(*rooms)
 
@@ -101,7 +107,7 @@ func main() {
 
 	for i := 0; i < *bots; i++ {
 		go func(id int) {
-			bot := NewBot(id, *addr, *mode, stats, tracker)
+			bot := NewBot(id, *addr, *mode, *queue, *rematch, stats, tracker)
 			if err := bot.Run(); err != nil {
 				atomic.AddInt64(&stats.errors, 1)
 			}
@@ -121,7 +127,7 @@ func main() {
 	}
 }
 
-func NewBot(id int, addr string, mode string, stats *Stats, tracker *RoomTracker) *Bot {
+func NewBot(id int, addr string, mode, queue string, rematch float64, stats *Stats, tracker *RoomTracker) *Bot {
 	return &Bot{
 		id:      id,
 		addr:    addr,
@@ -129,6 +135,8 @@ func NewBot(id int, addr string, mode string, stats *Stats, tracker *RoomTracker
 		stats:   stats,
 		tracker: tracker,
 		mode:    mode,
+		queue:   queue,
+		rematch: rematch,
 		rng:     rand.New(rand.NewSource(time.Now().UnixNano() + int64(id))),
 	}
 }
@@ -167,7 +175,7 @@ func (b *Bot) sendMatch() error {
 	if b.tracker != nil {
 		b.tracker.WaitForSlot()
 	}
-	return b.send(protocol.MsgMatchReq, &protocol.MatchReq{Mode: "default"})
+	return b.send(protocol.MsgMatchReq, &protocol.MatchReq{Mode: b.queue})
 }
 
 func (b *Bot) send(msgType protocol.MsgType, msg proto.Message) error {
@@ -184,7 +192,25 @@ func (b *Bot) send(msgType protocol.MsgType, msg proto.Message) error {
 }
 
 func (b *Bot) handleMessage(data []byte) {
-	msgType, _, msg, err := protocol.DecodeMessage(data)
+	env, err := protocol.DecodeEnvelope(data)
+	if err != nil {
+		atomic.AddInt64(&b.stats.errors, 1)
+		return
+	}
+	if env.Reliable {
+		// Acks are cumulative, so only the next seq in line is taken; a
+		// message after a gap comes again with the one missing.
+		if env.Seq != b.lastAcked+1 {
+			if env.Seq <= b.lastAcked {
+				_ = b.send(protocol.MsgAck, &protocol.Ack{Seq: b.lastAcked})
+			}
+			return
+		}
+		b.lastAcked = env.Seq
+		_ = b.send(protocol.MsgAck, &protocol.Ack{Seq: env.Seq})
+	}
+	msgType := env.Type
+	msg, err := protocol.UnmarshalBody(env.Type, env.Body)
 	if err != nil {
 		atomic.AddInt64(&b.stats.errors, 1)
 		return
@@ -202,21 +228,33 @@ func (b *Bot) handleMessage(data []byte) {
 		resp := msg.(*protocol.MatchResp)
 		b.mu.Lock()
 		b.roomID = resp.RoomId
+		b.phase = protocol.RoomPhaseWaiting
 		b.matchStart = time.Now()
 		b.players = resp.Players
 		b.mu.Unlock()
 		if b.tracker != nil {
 			b.tracker.OnRoomStart(resp.RoomId)
 		}
+		_ = b.send(protocol.MsgPlayerReady, &protocol.PlayerReady{})
 	case protocol.MsgRoomSnapshot:
 		atomic.AddInt64(&b.stats.snaps, 1)
 		snap := msg.(*protocol.RoomSnapshot)
+		b.mu.Lock()
+		var team int32
+		for _, p := range snap.Players {
+			if p.PlayerId == b.playerID {
+				team = p.TeamId
+			}
+		}
+		// Teammates are left out so the bot never targets them.
 		ids := make([]string, 0, len(snap.Players))
 		for _, p := range snap.Players {
-			ids = append(ids, p.PlayerId)
+			if team == 0 || p.TeamId != team {
+				ids = append(ids, p.PlayerId)
+			}
 		}
-		b.mu.Lock()
 		b.players = ids
+		b.phase = snap.Phase
 		b.mu.Unlock()
 	case protocol.MsgRoomOver:
 		var roomID string
@@ -229,7 +267,17 @@ func (b *Bot) handleMessage(data []byte) {
 		b.mu.Lock()
 		b.roomID = ""
 		b.mu.Unlock()
-		_ = b.sendMatch()
+		if msg.(*protocol.RoomOver).RematchMs == 0 {
+			_ = b.sendMatch()
+			return
+		}
+		_ = b.send(protocol.MsgRematchVote, &protocol.RematchVote{Accept: rand.Float64() < b.rematch})
+	case protocol.MsgRematchState:
+		// An accepted rematch is followed by MatchResp.
+		switch msg.(*protocol.RematchState).Status {
+		case protocol.RematchStatusDeclined, protocol.RematchStatusExpired:
+			_ = b.sendMatch()
+		}
 	case protocol.MsgErrorResp:
 		atomic.AddInt64(&b.stats.errors, 1)
 	}
@@ -248,11 +296,12 @@ func (b *Bot) actionLoop() {
 	for range ticker.C {
 		b.mu.RLock()
 		roomID := b.roomID
+		phase := b.phase
 		players := append([]string(nil), b.players...)
 		self := b.playerID
 		b.mu.RUnlock()
 
-		if roomID == "" || self == "" {
+		if roomID == "" || self == "" || phase != protocol.RoomPhasePlaying {
 			continue
 		}
 
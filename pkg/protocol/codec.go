@@ -8,6 +8,15 @@ import (
 
 // Encode wraps a payload into an Envelope and marshals it.
 func Encode(msgType MsgType, body proto.Message, seq uint64) ([]byte, error) {
+	return encode(msgType, body, seq, false)
+}
+
+// EncodeReliable is Encode for messages on the reliable channel.
+func EncodeReliable(msgType MsgType, body proto.Message, seq uint64) ([]byte, error) {
+	return encode(msgType, body, seq, true)
+}
+
+func encode(msgType MsgType, body proto.Message, seq uint64, reliable bool) ([]byte, error) {
 	var raw []byte
 	var err error
 	if body != nil {
@@ -17,10 +26,11 @@ func Encode(msgType MsgType, body proto.Message, seq uint64) ([]byte, error) {
 		}
 	}
 	env := &Envelope{
-		Type:    msgType,
-		Seq:     seq,
-		Body:    raw,
-		Version: CurrentVersion,
+		Type:     msgType,
+		Seq:      seq,
+		Body:     raw,
+		Version:  CurrentVersion,
+		Reliable: reliable,
 	}
 	return proto.Marshal(env)
 }
@@ -56,6 +66,9 @@ func UnmarshalBody(msgType MsgType, body []byte) (proto.Message, error) {
 	case MsgPong:
 		var m Pong
 		return &m, proto.Unmarshal(body, &m)
+	case MsgAck:
+		var m Ack
+		return &m, proto.Unmarshal(body, &m)
 	case MsgLoginReq:
 		var m LoginReq
 		return &m, proto.Unmarshal(body, &m)
@@ -80,12 +93,81 @@ func UnmarshalBody(msgType MsgType, body []byte) (proto.Message, error) {
 	case MsgSkillCast:
 		var m SkillCast
 		return &m, proto.Unmarshal(body, &m)
+	case MsgPlayerReady:
+		var m PlayerReady
+		return &m, proto.Unmarshal(body, &m)
 	case MsgRoomSnapshot:
 		var m RoomSnapshot
 		return &m, proto.Unmarshal(body, &m)
 	case MsgRoomOver:
 		var m RoomOver
 		return &m, proto.Unmarshal(body, &m)
+	case MsgSpectateReq:
+		var m SpectateReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgSpectateResp:
+		var m SpectateResp
+		return &m, proto.Unmarshal(body, &m)
+	case MsgPlayerConnectionChanged:
+		var m PlayerConnectionChanged
+		return &m, proto.Unmarshal(body, &m)
+	case MsgRematchVote:
+		var m RematchVote
+		return &m, proto.Unmarshal(body, &m)
+	case MsgRematchState:
+		var m RematchState
+		return &m, proto.Unmarshal(body, &m)
+	case MsgFriendAddReq:
+		var m FriendAddReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgFriendAcceptReq:
+		var m FriendAcceptReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgFriendRemoveReq:
+		var m FriendRemoveReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgFriendListReq:
+		var m FriendListReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgFriendListResp:
+		var m FriendListResp
+		return &m, proto.Unmarshal(body, &m)
+	case MsgPresenceSubReq:
+		var m PresenceSubReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgPresenceUnsubReq:
+		var m PresenceUnsubReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgPresenceUpdate:
+		var m PresenceUpdate
+		return &m, proto.Unmarshal(body, &m)
+	case MsgCreateRoomReq:
+		var m CreateRoomReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgJoinRoomReq:
+		var m JoinRoomReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgLeaveRoomReq:
+		var m LeaveRoomReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgUpdateRulesReq:
+		var m UpdateRulesReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgStartRoomReq:
+		var m StartRoomReq
+		return &m, proto.Unmarshal(body, &m)
+	case MsgLobbyState:
+		var m LobbyState
+		return &m, proto.Unmarshal(body, &m)
+	case MsgChatSend:
+		var m ChatSend
+		return &m, proto.Unmarshal(body, &m)
+	case MsgChatMessage:
+		var m ChatMessage
+		return &m, proto.Unmarshal(body, &m)
+	case MsgChatHistory:
+		var m ChatHistory
+		return &m, proto.Unmarshal(body, &m)
 	case MsgErrorResp:
 		var m ErrorResp
 		return &m, proto.Unmarshal(body, &m)
@@ -8,20 +8,44 @@ import (
 type MsgType int32
 
 const (
-	MsgUnknown       MsgType = 0
-	MsgPing          MsgType = 1
-	MsgPong          MsgType = 2
-	MsgLoginReq      MsgType = 10
-	MsgLoginResp     MsgType = 11
-	MsgReconnectReq  MsgType = 12
-	MsgReconnectResp MsgType = 13
-	MsgMatchReq      MsgType = 20
-	MsgMatchResp     MsgType = 21
-	MsgPlayerInput   MsgType = 30
-	MsgSkillCast     MsgType = 31
-	MsgRoomSnapshot  MsgType = 40
-	MsgRoomOver      MsgType = 41
-	MsgErrorResp     MsgType = 90
+	MsgUnknown                 MsgType = 0
+	MsgPing                    MsgType = 1
+	MsgPong                    MsgType = 2
+	MsgAck                     MsgType = 3
+	MsgLoginReq                MsgType = 10
+	MsgLoginResp               MsgType = 11
+	MsgReconnectReq            MsgType = 12
+	MsgReconnectResp           MsgType = 13
+	MsgMatchReq                MsgType = 20
+	MsgMatchResp               MsgType = 21
+	MsgPlayerInput             MsgType = 30
+	MsgSkillCast               MsgType = 31
+	MsgPlayerReady             MsgType = 32
+	MsgRoomSnapshot            MsgType = 40
+	MsgRoomOver                MsgType = 41
+	MsgSpectateReq             MsgType = 42
+	MsgSpectateResp            MsgType = 43
+	MsgPlayerConnectionChanged MsgType = 44
+	MsgRematchVote             MsgType = 45
+	MsgRematchState            MsgType = 46
+	MsgFriendAddReq            MsgType = 50
+	MsgFriendAcceptReq         MsgType = 51
+	MsgFriendRemoveReq         MsgType = 52
+	MsgFriendListReq           MsgType = 53
+	MsgFriendListResp          MsgType = 54
+	MsgPresenceSubReq          MsgType = 55
+	MsgPresenceUnsubReq        MsgType = 56
+	MsgPresenceUpdate          MsgType = 57
+	MsgCreateRoomReq           MsgType = 60
+	MsgJoinRoomReq             MsgType = 61
+	MsgLeaveRoomReq            MsgType = 62
+	MsgUpdateRulesReq          MsgType = 63
+	MsgStartRoomReq            MsgType = 64
+	MsgLobbyState              MsgType = 65
+	MsgChatSend                MsgType = 70
+	MsgChatMessage             MsgType = 71
+	MsgChatHistory             MsgType = 72
+	MsgErrorResp               MsgType = 90
 )
 
 const CurrentVersion = 1
@@ -32,6 +56,8 @@ func (t MsgType) String() string {
 		return "PING"
 	case MsgPong:
 		return "PONG"
+	case MsgAck:
+		return "ACK"
 	case MsgLoginReq:
 		return "LOGIN_REQ"
 	case MsgLoginResp:
@@ -48,10 +74,56 @@ func (t MsgType) String() string {
 		return "PLAYER_INPUT"
 	case MsgSkillCast:
 		return "SKILL_CAST"
+	case MsgPlayerReady:
+		return "PLAYER_READY"
 	case MsgRoomSnapshot:
 		return "ROOM_SNAPSHOT"
 	case MsgRoomOver:
 		return "ROOM_OVER"
+	case MsgSpectateReq:
+		return "SPECTATE_REQ"
+	case MsgSpectateResp:
+		return "SPECTATE_RESP"
+	case MsgPlayerConnectionChanged:
+		return "PLAYER_CONNECTION_CHANGED"
+	case MsgRematchVote:
+		return "REMATCH_VOTE"
+	case MsgRematchState:
+		return "REMATCH_STATE"
+	case MsgFriendAddReq:
+		return "FRIEND_ADD_REQ"
+	case MsgFriendAcceptReq:
+		return "FRIEND_ACCEPT_REQ"
+	case MsgFriendRemoveReq:
+		return "FRIEND_REMOVE_REQ"
+	case MsgFriendListReq:
+		return "FRIEND_LIST_REQ"
+	case MsgFriendListResp:
+		return "FRIEND_LIST_RESP"
+	case MsgPresenceSubReq:
+		return "PRESENCE_SUB_REQ"
+	case MsgPresenceUnsubReq:
+		return "PRESENCE_UNSUB_REQ"
+	case MsgPresenceUpdate:
+		return "PRESENCE_UPDATE"
+	case MsgCreateRoomReq:
+		return "CREATE_ROOM_REQ"
+	case MsgJoinRoomReq:
+		return "JOIN_ROOM_REQ"
+	case MsgLeaveRoomReq:
+		return "LEAVE_ROOM_REQ"
+	case MsgUpdateRulesReq:
+		return "UPDATE_RULES_REQ"
+	case MsgStartRoomReq:
+		return "START_ROOM_REQ"
+	case MsgLobbyState:
+		return "LOBBY_STATE"
+	case MsgChatSend:
+		return "CHAT_SEND"
+	case MsgChatMessage:
+		return "CHAT_MESSAGE"
+	case MsgChatHistory:
+		return "CHAT_HISTORY"
 	case MsgErrorResp:
 		return "ERROR_RESP"
 	default:
@@ -61,10 +133,11 @@ func (t MsgType) String() string {
 
 // Envelope wraps all payloads to allow a single decoder.
 type Envelope struct {
-	Type    MsgType `protobuf:"varint,1,opt,name=type,proto3,enum=protocol.MsgType" json:"type,omitempty"`
-	Seq     uint64  `protobuf:"varint,2,opt,name=seq,proto3" json:"seq,omitempty"`
-	Body    []byte  `protobuf:"bytes,3,opt,name=body,proto3" json:"body,omitempty"`
-	Version int32   `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
+	Type     MsgType `protobuf:"varint,1,opt,name=type,proto3,enum=protocol.MsgType" json:"type,omitempty"`
+	Seq      uint64  `protobuf:"varint,2,opt,name=seq,proto3" json:"seq,omitempty"`
+	Body     []byte  `protobuf:"bytes,3,opt,name=body,proto3" json:"body,omitempty"`
+	Version  int32   `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
+	Reliable bool    `protobuf:"varint,5,opt,name=reliable,proto3" json:"reliable,omitempty"`
 }
 
 func (m *Envelope) Reset()         { *m = Envelope{} }
@@ -90,10 +163,21 @@ func (m *Pong) Reset()         { *m = Pong{} }
 func (m *Pong) String() string { return "Pong" }
 func (*Pong) ProtoMessage()    {}
 
+// Ack
+
+type Ack struct {
+	Seq uint64 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+}
+
+func (m *Ack) Reset()         { *m = Ack{} }
+func (m *Ack) String() string { return "Ack" }
+func (*Ack) ProtoMessage()    {}
+
 // Login
 
 type LoginReq struct {
-	Username string `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Username      string `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	IdentityToken string `protobuf:"bytes,2,opt,name=identity_token,json=identityToken,proto3" json:"identity_token,omitempty"`
 }
 
 func (m *LoginReq) Reset()         { *m = LoginReq{} }
@@ -104,6 +188,7 @@ type LoginResp struct {
 	PlayerId       string `protobuf:"bytes,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
 	AccessToken    string `protobuf:"bytes,2,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
 	ReconnectToken string `protobuf:"bytes,3,opt,name=reconnect_token,json=reconnectToken,proto3" json:"reconnect_token,omitempty"`
+	IdentityToken  string `protobuf:"bytes,4,opt,name=identity_token,json=identityToken,proto3" json:"identity_token,omitempty"`
 }
 
 func (m *LoginResp) Reset()         { *m = LoginResp{} }
@@ -112,6 +197,7 @@ func (*LoginResp) ProtoMessage()    {}
 
 type ReconnectReq struct {
 	ReconnectToken string `protobuf:"bytes,1,opt,name=reconnect_token,json=reconnectToken,proto3" json:"reconnect_token,omitempty"`
+	LastAckedSeq   uint64 `protobuf:"varint,2,opt,name=last_acked_seq,json=lastAckedSeq,proto3" json:"last_acked_seq,omitempty"`
 }
 
 func (m *ReconnectReq) Reset()         { *m = ReconnectReq{} }
@@ -143,6 +229,11 @@ type MatchResp struct {
 	MatchId string   `protobuf:"bytes,1,opt,name=match_id,json=matchId,proto3" json:"match_id,omitempty"`
 	RoomId  string   `protobuf:"bytes,2,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
 	Players []string `protobuf:"bytes,3,rep,name=players,proto3" json:"players,omitempty"`
+	// MapId is the arena the match is played on.
+	MapId string `protobuf:"bytes,4,opt,name=map_id,json=mapId,proto3" json:"map_id,omitempty"`
+	// Teams is the team of each player in Players, counting from 1; it is
+	// empty in a free-for-all.
+	Teams []int32 `protobuf:"varint,5,rep,packed,name=teams,proto3" json:"teams,omitempty"`
 }
 
 func (m *MatchResp) Reset()         { *m = MatchResp{} }
@@ -171,24 +262,144 @@ func (m *SkillCast) Reset()         { *m = SkillCast{} }
 func (m *SkillCast) String() string { return "SkillCast" }
 func (*SkillCast) ProtoMessage()    {}
 
+// Ready check
+
+type PlayerReady struct{}
+
+func (m *PlayerReady) Reset()         { *m = PlayerReady{} }
+func (m *PlayerReady) String() string { return "PlayerReady" }
+func (*PlayerReady) ProtoMessage()    {}
+
 // Snapshot
 
+type RoomPhase int32
+
+const (
+	RoomPhaseWaiting   RoomPhase = 0
+	RoomPhaseCountdown RoomPhase = 1
+	RoomPhasePlaying   RoomPhase = 2
+	RoomPhaseEnded     RoomPhase = 3
+)
+
+func (p RoomPhase) String() string {
+	switch p {
+	case RoomPhaseWaiting:
+		return "waiting"
+	case RoomPhaseCountdown:
+		return "countdown"
+	case RoomPhasePlaying:
+		return "playing"
+	case RoomPhaseEnded:
+		return "ended"
+	default:
+		return fmt.Sprintf("phase(%d)", int32(p))
+	}
+}
+
+type StatusKind int32
+
+const (
+	StatusStun   StatusKind = 0
+	StatusSlow   StatusKind = 1
+	StatusDot    StatusKind = 2
+	StatusShield StatusKind = 3
+)
+
+func (k StatusKind) String() string {
+	switch k {
+	case StatusStun:
+		return "stun"
+	case StatusSlow:
+		return "slow"
+	case StatusDot:
+		return "dot"
+	case StatusShield:
+		return "shield"
+	default:
+		return fmt.Sprintf("status(%d)", int32(k))
+	}
+}
+
+// StatusEffect is one effect on a player. Amount is the damage per pulse of
+// a DoT or what is left of a shield; Slow is the fraction of movement taken
+// away.
+type StatusEffect struct {
+	Kind     StatusKind `protobuf:"varint,1,opt,name=kind,proto3,enum=protocol.StatusKind" json:"kind,omitempty"`
+	SkillId  int32      `protobuf:"varint,2,opt,name=skill_id,json=skillId,proto3" json:"skill_id,omitempty"`
+	SourceId string     `protobuf:"bytes,3,opt,name=source_id,json=sourceId,proto3" json:"source_id,omitempty"`
+	Ticks    int32      `protobuf:"varint,4,opt,name=ticks,proto3" json:"ticks,omitempty"`
+	Amount   int32      `protobuf:"varint,5,opt,name=amount,proto3" json:"amount,omitempty"`
+	Slow     float32    `protobuf:"fixed32,6,opt,name=slow,proto3" json:"slow,omitempty"`
+}
+
+func (m *StatusEffect) Reset()         { *m = StatusEffect{} }
+func (m *StatusEffect) String() string { return "StatusEffect" }
+func (*StatusEffect) ProtoMessage()    {}
+
+type SkillCooldown struct {
+	SkillId int32 `protobuf:"varint,1,opt,name=skill_id,json=skillId,proto3" json:"skill_id,omitempty"`
+	Ticks   int32 `protobuf:"varint,2,opt,name=ticks,proto3" json:"ticks,omitempty"`
+}
+
+func (m *SkillCooldown) Reset()         { *m = SkillCooldown{} }
+func (m *SkillCooldown) String() string { return "SkillCooldown" }
+func (*SkillCooldown) ProtoMessage()    {}
+
 type PlayerSnapshot struct {
 	PlayerId string  `protobuf:"bytes,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
 	X        float32 `protobuf:"fixed32,2,opt,name=x,proto3" json:"x,omitempty"`
 	Y        float32 `protobuf:"fixed32,3,opt,name=y,proto3" json:"y,omitempty"`
 	Hp       int32   `protobuf:"varint,4,opt,name=hp,proto3" json:"hp,omitempty"`
 	SkillCd  int32   `protobuf:"varint,5,opt,name=skill_cd,json=skillCd,proto3" json:"skill_cd,omitempty"`
+	Ready    bool    `protobuf:"varint,6,opt,name=ready,proto3" json:"ready,omitempty"`
+	// Disconnected is set while the player is in the reconnect grace period.
+	Disconnected bool `protobuf:"varint,7,opt,name=disconnected,proto3" json:"disconnected,omitempty"`
+	// Ai is set while the server AI plays this character.
+	Ai bool `protobuf:"varint,8,opt,name=ai,proto3" json:"ai,omitempty"`
+	// Cooldowns lists the skills that are not ready yet.
+	Cooldowns []*SkillCooldown `protobuf:"bytes,9,rep,name=cooldowns,proto3" json:"cooldowns,omitempty"`
+	// Casting is the skill being cast, 0 if none.
+	Casting int32 `protobuf:"varint,10,opt,name=casting,proto3" json:"casting,omitempty"`
+	// Effects are the status effects on the player.
+	Effects []*StatusEffect `protobuf:"bytes,11,rep,name=effects,proto3" json:"effects,omitempty"`
+	// TeamId is the player's team, 0 in a free-for-all.
+	TeamId int32 `protobuf:"varint,12,opt,name=team_id,json=teamId,proto3" json:"team_id,omitempty"`
 }
 
+// ProjectileSnapshot is a projectile in flight. Velocity is in arena units per
+// tick.
+type ProjectileSnapshot struct {
+	Id      int64   `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	OwnerId string  `protobuf:"bytes,2,opt,name=owner_id,json=ownerId,proto3" json:"owner_id,omitempty"`
+	SkillId int32   `protobuf:"varint,3,opt,name=skill_id,json=skillId,proto3" json:"skill_id,omitempty"`
+	X       float32 `protobuf:"fixed32,4,opt,name=x,proto3" json:"x,omitempty"`
+	Y       float32 `protobuf:"fixed32,5,opt,name=y,proto3" json:"y,omitempty"`
+	Vx      float32 `protobuf:"fixed32,6,opt,name=vx,proto3" json:"vx,omitempty"`
+	Vy      float32 `protobuf:"fixed32,7,opt,name=vy,proto3" json:"vy,omitempty"`
+	Radius  float32 `protobuf:"fixed32,8,opt,name=radius,proto3" json:"radius,omitempty"`
+}
+
+func (m *ProjectileSnapshot) Reset()         { *m = ProjectileSnapshot{} }
+func (m *ProjectileSnapshot) String() string { return "ProjectileSnapshot" }
+func (*ProjectileSnapshot) ProtoMessage()    {}
+
 func (m *PlayerSnapshot) Reset()         { *m = PlayerSnapshot{} }
 func (m *PlayerSnapshot) String() string { return "PlayerSnapshot" }
 func (*PlayerSnapshot) ProtoMessage()    {}
 
 type RoomSnapshot struct {
-	RoomId  string             `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
-	Tick    int64              `protobuf:"varint,2,opt,name=tick,proto3" json:"tick,omitempty"`
-	Players []*PlayerSnapshot  `protobuf:"bytes,3,rep,name=players,proto3" json:"players,omitempty"`
+	RoomId      string            `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	Tick        int64             `protobuf:"varint,2,opt,name=tick,proto3" json:"tick,omitempty"`
+	Players     []*PlayerSnapshot `protobuf:"bytes,3,rep,name=players,proto3" json:"players,omitempty"`
+	Phase       RoomPhase         `protobuf:"varint,4,opt,name=phase,proto3,enum=protocol.RoomPhase" json:"phase,omitempty"`
+	CountdownMs int32             `protobuf:"varint,5,opt,name=countdown_ms,json=countdownMs,proto3" json:"countdown_ms,omitempty"`
+	SuddenDeath bool              `protobuf:"varint,6,opt,name=sudden_death,json=suddenDeath,proto3" json:"sudden_death,omitempty"`
+	// Projectiles are the skill shots in flight.
+	Projectiles []*ProjectileSnapshot `protobuf:"bytes,7,rep,name=projectiles,proto3" json:"projectiles,omitempty"`
+	// StateHash is the simulation state hash in fixed-point matches, 0
+	// otherwise. Clients running the same inputs can compare it to detect
+	// a desync.
+	StateHash uint64 `protobuf:"varint,8,opt,name=state_hash,json=stateHash,proto3" json:"state_hash,omitempty"`
 }
 
 func (m *RoomSnapshot) Reset()         { *m = RoomSnapshot{} }
@@ -197,15 +408,331 @@ func (*RoomSnapshot) ProtoMessage()    {}
 
 // Room over
 
+type RoomOutcome int32
+
+const (
+	RoomOutcomeWin       RoomOutcome = 0
+	RoomOutcomeDraw      RoomOutcome = 1
+	RoomOutcomeTimeout   RoomOutcome = 2
+	RoomOutcomeAbandoned RoomOutcome = 3
+	RoomOutcomeAborted   RoomOutcome = 4
+)
+
+func (o RoomOutcome) String() string {
+	switch o {
+	case RoomOutcomeWin:
+		return "win"
+	case RoomOutcomeDraw:
+		return "draw"
+	case RoomOutcomeTimeout:
+		return "timeout"
+	case RoomOutcomeAbandoned:
+		return "abandoned"
+	case RoomOutcomeAborted:
+		return "aborted"
+	default:
+		return fmt.Sprintf("outcome(%d)", int32(o))
+	}
+}
+
+// PlayerMatchStats is one player's line in RoomOver, best placement first.
+type PlayerMatchStats struct {
+	PlayerId     string  `protobuf:"bytes,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+	Placement    int32   `protobuf:"varint,2,opt,name=placement,proto3" json:"placement,omitempty"`
+	DamageDealt  int32   `protobuf:"varint,3,opt,name=damage_dealt,json=damageDealt,proto3" json:"damage_dealt,omitempty"`
+	DamageTaken  int32   `protobuf:"varint,4,opt,name=damage_taken,json=damageTaken,proto3" json:"damage_taken,omitempty"`
+	SkillsCast   int32   `protobuf:"varint,5,opt,name=skills_cast,json=skillsCast,proto3" json:"skills_cast,omitempty"`
+	SkillsLanded int32   `protobuf:"varint,6,opt,name=skills_landed,json=skillsLanded,proto3" json:"skills_landed,omitempty"`
+	Distance     float32 `protobuf:"fixed32,7,opt,name=distance,proto3" json:"distance,omitempty"`
+	TimeAliveMs  int64   `protobuf:"varint,8,opt,name=time_alive_ms,json=timeAliveMs,proto3" json:"time_alive_ms,omitempty"`
+	Forfeited    bool    `protobuf:"varint,9,opt,name=forfeited,proto3" json:"forfeited,omitempty"`
+}
+
+func (m *PlayerMatchStats) Reset()         { *m = PlayerMatchStats{} }
+func (m *PlayerMatchStats) String() string { return "PlayerMatchStats" }
+func (*PlayerMatchStats) ProtoMessage()    {}
+
 type RoomOver struct {
-	RoomId   string `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
-	WinnerId string `protobuf:"bytes,2,opt,name=winner_id,json=winnerId,proto3" json:"winner_id,omitempty"`
+	RoomId   string      `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	WinnerId string      `protobuf:"bytes,2,opt,name=winner_id,json=winnerId,proto3" json:"winner_id,omitempty"`
+	Outcome  RoomOutcome `protobuf:"varint,3,opt,name=outcome,proto3,enum=protocol.RoomOutcome" json:"outcome,omitempty"`
+	Reason   string      `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	// Players is empty when the match never started.
+	Players []*PlayerMatchStats `protobuf:"bytes,5,rep,name=players,proto3" json:"players,omitempty"`
+	// RematchMs is how long players can vote for a rematch; 0 means the
+	// room closes right away.
+	RematchMs int32 `protobuf:"varint,6,opt,name=rematch_ms,json=rematchMs,proto3" json:"rematch_ms,omitempty"`
+	// WinningTeam is set instead of WinnerId when a team wins.
+	WinningTeam int32 `protobuf:"varint,7,opt,name=winning_team,json=winningTeam,proto3" json:"winning_team,omitempty"`
 }
 
 func (m *RoomOver) Reset()         { *m = RoomOver{} }
 func (m *RoomOver) String() string { return "RoomOver" }
 func (*RoomOver) ProtoMessage()    {}
 
+type PlayerConnectionChanged struct {
+	RoomId    string `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	PlayerId  string `protobuf:"bytes,2,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+	Connected bool   `protobuf:"varint,3,opt,name=connected,proto3" json:"connected,omitempty"`
+	GraceMs   int32  `protobuf:"varint,4,opt,name=grace_ms,json=graceMs,proto3" json:"grace_ms,omitempty"`
+}
+
+func (m *PlayerConnectionChanged) Reset()         { *m = PlayerConnectionChanged{} }
+func (m *PlayerConnectionChanged) String() string { return "PlayerConnectionChanged" }
+func (*PlayerConnectionChanged) ProtoMessage()    {}
+
+// Rematch
+
+type RematchVote struct {
+	Accept bool `protobuf:"varint,1,opt,name=accept,proto3" json:"accept,omitempty"`
+}
+
+func (m *RematchVote) Reset()         { *m = RematchVote{} }
+func (m *RematchVote) String() string { return "RematchVote" }
+func (*RematchVote) ProtoMessage()    {}
+
+type RematchStatus int32
+
+const (
+	RematchStatusVoting   RematchStatus = 0
+	RematchStatusAccepted RematchStatus = 1
+	RematchStatusDeclined RematchStatus = 2
+	RematchStatusExpired  RematchStatus = 3
+)
+
+func (s RematchStatus) String() string {
+	switch s {
+	case RematchStatusVoting:
+		return "voting"
+	case RematchStatusAccepted:
+		return "accepted"
+	case RematchStatusDeclined:
+		return "declined"
+	case RematchStatusExpired:
+		return "expired"
+	default:
+		return fmt.Sprintf("rematch(%d)", int32(s))
+	}
+}
+
+type RematchState struct {
+	RoomId string        `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	Status RematchStatus `protobuf:"varint,2,opt,name=status,proto3,enum=protocol.RematchStatus" json:"status,omitempty"`
+	// Accepted lists the players who voted yes so far, bots included.
+	Accepted    []string `protobuf:"bytes,3,rep,name=accepted,proto3" json:"accepted,omitempty"`
+	RemainingMs int32    `protobuf:"varint,4,opt,name=remaining_ms,json=remainingMs,proto3" json:"remaining_ms,omitempty"`
+}
+
+func (m *RematchState) Reset()         { *m = RematchState{} }
+func (m *RematchState) String() string { return "RematchState" }
+func (*RematchState) ProtoMessage()    {}
+
+// Spectate
+
+type SpectateReq struct {
+	RoomId string `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+}
+
+func (m *SpectateReq) Reset()         { *m = SpectateReq{} }
+func (m *SpectateReq) String() string { return "SpectateReq" }
+func (*SpectateReq) ProtoMessage()    {}
+
+type SpectateResp struct {
+	RoomId string `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	Ok     bool   `protobuf:"varint,2,opt,name=ok,proto3" json:"ok,omitempty"`
+	Reason string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (m *SpectateResp) Reset()         { *m = SpectateResp{} }
+func (m *SpectateResp) String() string { return "SpectateResp" }
+func (*SpectateResp) ProtoMessage()    {}
+
+// Friends
+
+type FriendAddReq struct {
+	PlayerId string `protobuf:"bytes,2,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+}
+
+func (m *FriendAddReq) Reset()         { *m = FriendAddReq{} }
+func (m *FriendAddReq) String() string { return "FriendAddReq" }
+func (*FriendAddReq) ProtoMessage()    {}
+
+type FriendAcceptReq struct {
+	PlayerId string `protobuf:"bytes,2,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+}
+
+func (m *FriendAcceptReq) Reset()         { *m = FriendAcceptReq{} }
+func (m *FriendAcceptReq) String() string { return "FriendAcceptReq" }
+func (*FriendAcceptReq) ProtoMessage()    {}
+
+type FriendRemoveReq struct {
+	PlayerId string `protobuf:"bytes,2,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+}
+
+func (m *FriendRemoveReq) Reset()         { *m = FriendRemoveReq{} }
+func (m *FriendRemoveReq) String() string { return "FriendRemoveReq" }
+func (*FriendRemoveReq) ProtoMessage()    {}
+
+type FriendListReq struct{}
+
+func (m *FriendListReq) Reset()         { *m = FriendListReq{} }
+func (m *FriendListReq) String() string { return "FriendListReq" }
+func (*FriendListReq) ProtoMessage()    {}
+
+type FriendListResp struct {
+	Friends  []*PresenceUpdate `protobuf:"bytes,1,rep,name=friends,proto3" json:"friends,omitempty"`
+	Incoming []*FriendRef      `protobuf:"bytes,4,rep,name=incoming,proto3" json:"incoming,omitempty"`
+	Outgoing []*FriendRef      `protobuf:"bytes,5,rep,name=outgoing,proto3" json:"outgoing,omitempty"`
+}
+
+func (m *FriendListResp) Reset()         { *m = FriendListResp{} }
+func (m *FriendListResp) String() string { return "FriendListResp" }
+func (*FriendListResp) ProtoMessage()    {}
+
+// FriendRef names the other player of a pending friend request.
+type FriendRef struct {
+	PlayerId string `protobuf:"bytes,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+	Username string `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+}
+
+func (m *FriendRef) Reset()         { *m = FriendRef{} }
+func (m *FriendRef) String() string { return "FriendRef" }
+func (*FriendRef) ProtoMessage()    {}
+
+// Presence
+
+type PresenceStatus int32
+
+const (
+	PresenceOffline PresenceStatus = 0
+	PresenceIdle    PresenceStatus = 1
+	PresenceInQueue PresenceStatus = 2
+	PresenceInMatch PresenceStatus = 3
+)
+
+type PresenceSubReq struct {
+	PlayerIds []string `protobuf:"bytes,2,rep,name=player_ids,json=playerIds,proto3" json:"player_ids,omitempty"`
+}
+
+func (m *PresenceSubReq) Reset()         { *m = PresenceSubReq{} }
+func (m *PresenceSubReq) String() string { return "PresenceSubReq" }
+func (*PresenceSubReq) ProtoMessage()    {}
+
+type PresenceUnsubReq struct {
+	PlayerIds []string `protobuf:"bytes,2,rep,name=player_ids,json=playerIds,proto3" json:"player_ids,omitempty"`
+}
+
+func (m *PresenceUnsubReq) Reset()         { *m = PresenceUnsubReq{} }
+func (m *PresenceUnsubReq) String() string { return "PresenceUnsubReq" }
+func (*PresenceUnsubReq) ProtoMessage()    {}
+
+type PresenceUpdate struct {
+	Username string         `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Status   PresenceStatus `protobuf:"varint,2,opt,name=status,proto3,enum=protocol.PresenceStatus" json:"status,omitempty"`
+	RoomId   string         `protobuf:"bytes,3,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	PlayerId string         `protobuf:"bytes,4,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+}
+
+func (m *PresenceUpdate) Reset()         { *m = PresenceUpdate{} }
+func (m *PresenceUpdate) String() string { return "PresenceUpdate" }
+func (*PresenceUpdate) ProtoMessage()    {}
+
+// Private rooms
+
+type RoomRules struct {
+	MaxHp            int32   `protobuf:"varint,1,opt,name=max_hp,json=maxHp,proto3" json:"max_hp,omitempty"`
+	DamageMultiplier float32 `protobuf:"fixed32,2,opt,name=damage_multiplier,json=damageMultiplier,proto3" json:"damage_multiplier,omitempty"`
+	TimeLimitSec     int32   `protobuf:"varint,3,opt,name=time_limit_sec,json=timeLimitSec,proto3" json:"time_limit_sec,omitempty"`
+	Players          int32   `protobuf:"varint,4,opt,name=players,proto3" json:"players,omitempty"`
+	// MapId picks the arena; empty picks one at random when the room starts.
+	MapId string `protobuf:"bytes,5,opt,name=map_id,json=mapId,proto3" json:"map_id,omitempty"`
+	// TeamSize of 2 or more splits the players into teams in join order.
+	TeamSize     int32 `protobuf:"varint,6,opt,name=team_size,json=teamSize,proto3" json:"team_size,omitempty"`
+	FriendlyFire bool  `protobuf:"varint,7,opt,name=friendly_fire,json=friendlyFire,proto3" json:"friendly_fire,omitempty"`
+}
+
+func (m *RoomRules) Reset()         { *m = RoomRules{} }
+func (m *RoomRules) String() string { return "RoomRules" }
+func (*RoomRules) ProtoMessage()    {}
+
+type CreateRoomReq struct {
+	Rules *RoomRules `protobuf:"bytes,1,opt,name=rules,proto3" json:"rules,omitempty"`
+}
+
+func (m *CreateRoomReq) Reset()         { *m = CreateRoomReq{} }
+func (m *CreateRoomReq) String() string { return "CreateRoomReq" }
+func (*CreateRoomReq) ProtoMessage()    {}
+
+type JoinRoomReq struct {
+	Code string `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+}
+
+func (m *JoinRoomReq) Reset()         { *m = JoinRoomReq{} }
+func (m *JoinRoomReq) String() string { return "JoinRoomReq" }
+func (*JoinRoomReq) ProtoMessage()    {}
+
+type LeaveRoomReq struct{}
+
+func (m *LeaveRoomReq) Reset()         { *m = LeaveRoomReq{} }
+func (m *LeaveRoomReq) String() string { return "LeaveRoomReq" }
+func (*LeaveRoomReq) ProtoMessage()    {}
+
+type UpdateRulesReq struct {
+	Rules *RoomRules `protobuf:"bytes,1,opt,name=rules,proto3" json:"rules,omitempty"`
+}
+
+func (m *UpdateRulesReq) Reset()         { *m = UpdateRulesReq{} }
+func (m *UpdateRulesReq) String() string { return "UpdateRulesReq" }
+func (*UpdateRulesReq) ProtoMessage()    {}
+
+type StartRoomReq struct{}
+
+func (m *StartRoomReq) Reset()         { *m = StartRoomReq{} }
+func (m *StartRoomReq) String() string { return "StartRoomReq" }
+func (*StartRoomReq) ProtoMessage()    {}
+
+type LobbyState struct {
+	Code    string     `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	HostId  string     `protobuf:"bytes,2,opt,name=host_id,json=hostId,proto3" json:"host_id,omitempty"`
+	Players []string   `protobuf:"bytes,3,rep,name=players,proto3" json:"players,omitempty"`
+	Rules   *RoomRules `protobuf:"bytes,4,opt,name=rules,proto3" json:"rules,omitempty"`
+}
+
+func (m *LobbyState) Reset()         { *m = LobbyState{} }
+func (m *LobbyState) String() string { return "LobbyState" }
+func (*LobbyState) ProtoMessage()    {}
+
+// Chat
+
+type ChatSend struct {
+	Text string `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+}
+
+func (m *ChatSend) Reset()         { *m = ChatSend{} }
+func (m *ChatSend) String() string { return "ChatSend" }
+func (*ChatSend) ProtoMessage()    {}
+
+type ChatMessage struct {
+	RoomId   string `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	SenderId string `protobuf:"bytes,2,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"`
+	Username string `protobuf:"bytes,3,opt,name=username,proto3" json:"username,omitempty"`
+	Text     string `protobuf:"bytes,4,opt,name=text,proto3" json:"text,omitempty"`
+	SentAt   int64  `protobuf:"varint,5,opt,name=sent_at,json=sentAt,proto3" json:"sent_at,omitempty"`
+}
+
+func (m *ChatMessage) Reset()         { *m = ChatMessage{} }
+func (m *ChatMessage) String() string { return "ChatMessage" }
+func (*ChatMessage) ProtoMessage()    {}
+
+type ChatHistory struct {
+	RoomId   string         `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	Messages []*ChatMessage `protobuf:"bytes,2,rep,name=messages,proto3" json:"messages,omitempty"`
+}
+
+func (m *ChatHistory) Reset()         { *m = ChatHistory{} }
+func (m *ChatHistory) String() string { return "ChatHistory" }
+func (*ChatHistory) ProtoMessage()    {}
+
 // Error
 
 type ErrorResp struct {
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/replay"
+)
+
+type tickState struct {
+	Tick        int64             `json:"tick"`
+	Hash        string            `json:"hash"`
+	Players     []playerState     `json:"players"`
+	Projectiles []projectileState `json:"projectiles,omitempty"`
+}
+
+type projectileState struct {
+	ID      int64   `json:"id"`
+	Owner   string  `json:"owner"`
+	SkillID int32   `json:"skill_id"`
+	X       float32 `json:"x"`
+	Y       float32 `json:"y"`
+}
+
+type playerState struct {
+	ID          string     `json:"id"`
+	Team        int32      `json:"team,omitempty"`
+	X           float32    `json:"x"`
+	Y           float32    `json:"y"`
+	HP          int32      `json:"hp"`
+	Cooldowns   []cooldown `json:"cooldowns,omitempty"`
+	Casting     int32      `json:"casting,omitempty"`
+	DamageDealt int32      `json:"damage_dealt"`
+}
+
+type cooldown struct {
+	SkillID int32 `json:"skill_id"`
+	Ticks   int32 `json:"ticks"`
+}
+
+func main() {
+	redisAddr := flag.String("redis", "", "load <match-id> from this Redis instead of a file")
+	redisPassword := flag.String("redis-password", "", "Redis password")
+	redisDB := flag.Int("redis-db", 0, "Redis database")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: replay [flags] verify|timeline <file | match-id>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmd, src := flag.Arg(0), flag.Arg(1)
+
+	var (
+		rp  *replay.Replay
+		err error
+	)
+	if *redisAddr != "" {
+		rdb := redis.NewClient(&redis.Options{Addr: *redisAddr, Password: *redisPassword, DB: *redisDB})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		rp, err = replay.NewRedisStore(rdb, 0).Load(ctx, src)
+		cancel()
+		_ = rdb.Close()
+	} else {
+		rp, err = replay.LoadFile(src)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load %s: %v\n", src, err)
+		os.Exit(1)
+	}
+
+	switch cmd {
+	case "verify":
+		if err := replay.Verify(rp); err != nil {
+			fmt.Fprintf(os.Stderr, "match %s: %v\n", rp.MatchID, err)
+			os.Exit(1)
+		}
+		winner := fmt.Sprintf("winner %q", rp.Result.Winner)
+		if rp.Result.Team != 0 {
+			winner = fmt.Sprintf("team %d", rp.Result.Team)
+		}
+		fmt.Printf("match %s ok: %d events, %d ticks, hash %016x, %s %s (%s)\n",
+			rp.MatchID, len(rp.Events), rp.FinalTick, rp.FinalHash, rp.Result.Outcome, winner, rp.Result.Reason)
+	case "timeline":
+		var timeline []tickState
+		replay.Run(rp, func(s *battle.State) {
+			timeline = append(timeline, toTickState(s))
+		})
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(timeline); err != nil {
+			fmt.Fprintf(os.Stderr, "encode: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func toTickState(s *battle.State) tickState {
+	ts := tickState{Tick: s.Tick, Hash: fmt.Sprintf("%016x", s.Hash())}
+	for _, p := range replay.Players(s) {
+		ps := playerState{ID: p.ID, Team: p.Team, X: p.X, Y: p.Y, HP: p.HP, Casting: p.Casting, DamageDealt: p.DamageDealt}
+		for _, cd := range s.ActiveCooldowns(&p) {
+			ps.Cooldowns = append(ps.Cooldowns, cooldown{SkillID: cd.SkillID, Ticks: cd.Ticks})
+		}
+		ts.Players = append(ts.Players, ps)
+	}
+	for _, pr := range s.Projectiles {
+		ts.Projectiles = append(ts.Projectiles, projectileState{ID: pr.ID, Owner: pr.Owner, SkillID: pr.SkillID, X: pr.X, Y: pr.Y})
+	}
+	return ts
+}
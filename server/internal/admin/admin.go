@@ -0,0 +1,347 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/replay"
+	"miniarena/server/internal/room"
+)
+
+const (
+	// Prefix is where the handler expects to be mounted.
+	Prefix = "/admin/"
+
+	requestTimeout = 2 * time.Second
+	maxBodyBytes   = 64 << 10
+)
+
+// Handler serves the operator API for live rooms. Every request needs
+// "Authorization: Bearer <token>".
+//
+//	GET  /admin/rooms               list rooms
+//	GET  /admin/rooms/{id}          one room with its battle state
+//	POST /admin/rooms/{id}/end      {"outcome", "winner" or "team", "reason"}
+//	POST /admin/rooms/{id}/kick     {"player_id"}
+//	POST /admin/rooms/{id}/message  {"text"}
+type Handler struct {
+	token []byte
+	rooms *room.Manager
+	log   *zap.Logger
+}
+
+func NewHandler(token string, rooms *room.Manager, log *zap.Logger) *Handler {
+	return &Handler{token: []byte(token), rooms: rooms, log: log}
+}
+
+type roomSummary struct {
+	ID        string   `json:"id"`
+	MatchID   string   `json:"match_id"`
+	Phase     string   `json:"phase"`
+	Players   []string `json:"players"`
+	Observers int      `json:"observers"`
+	Tick      int64    `json:"tick"`
+	AgeSec    float64  `json:"age_sec"`
+}
+
+type roomDetail struct {
+	roomSummary
+	State stateJSON `json:"state"`
+}
+
+type stateJSON struct {
+	Seed        int64        `json:"seed"`
+	Hash        string       `json:"hash"`
+	SuddenDeath bool         `json:"sudden_death"`
+	Rules       rulesJSON    `json:"rules"`
+	Players     []playerJSON `json:"players"`
+}
+
+type rulesJSON struct {
+	MaxHP            int32       `json:"max_hp"`
+	DamageMultiplier float32     `json:"damage_multiplier"`
+	TimeLimitTicks   int64       `json:"time_limit_ticks"`
+	SuddenDeathTicks int64       `json:"sudden_death_ticks"`
+	Players          int         `json:"players"`
+	Skills           []skillJSON `json:"skills"`
+	TeamSize         int         `json:"team_size"`
+	FriendlyFire     bool        `json:"friendly_fire"`
+	FixedPoint       bool        `json:"fixed_point"`
+}
+
+type playerJSON struct {
+	ID          string         `json:"id"`
+	Team        int32          `json:"team"`
+	X           float32        `json:"x"`
+	Y           float32        `json:"y"`
+	HP          int32          `json:"hp"`
+	Cooldowns   []cooldownJSON `json:"cooldowns"`
+	Casting     int32          `json:"casting"`
+	Effects     []effectJSON   `json:"effects"`
+	DamageDealt int32          `json:"damage_dealt"`
+	Forfeited   bool           `json:"forfeited"`
+}
+
+type cooldownJSON struct {
+	SkillID int32 `json:"skill_id"`
+	Ticks   int32 `json:"ticks"`
+}
+
+type effectJSON struct {
+	Kind    string  `json:"kind"`
+	SkillID int32   `json:"skill_id"`
+	Source  string  `json:"source"`
+	Ticks   int32   `json:"ticks"`
+	Amount  int32   `json:"amount,omitempty"`
+	Slow    float32 `json:"slow,omitempty"`
+}
+
+type skillJSON struct {
+	ID       int32    `json:"id"`
+	Name     string   `json:"name"`
+	Damage   int32    `json:"damage"`
+	Heal     int32    `json:"heal"`
+	Range    float64  `json:"range"`
+	Cooldown int32    `json:"cooldown_ticks"`
+	CastTime int32    `json:"cast_ticks"`
+	Target   string   `json:"target"`
+	Speed    float64  `json:"speed,omitempty"`
+	Radius   float64  `json:"radius,omitempty"`
+	Effects  []string `json:"effects,omitempty"`
+}
+
+type endReq struct {
+	Outcome string `json:"outcome"`
+	Winner  string `json:"winner"`
+	Team    int32  `json:"team"`
+	Reason  string `json:"reason"`
+}
+
+type kickReq struct {
+	PlayerID string `json:"player_id"`
+}
+
+type messageReq struct {
+	Text string `json:"text"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	// Paths are /admin/rooms, /admin/rooms/{id} and /admin/rooms/{id}/{action}.
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, Prefix), "/"), "/")
+	if parts[0] != "rooms" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	switch {
+	case len(parts) == 1:
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+		h.list(ctx, w)
+	case len(parts) == 2:
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+		h.inspect(ctx, w, parts[1])
+	default:
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+		h.act(ctx, w, r, parts[1], parts[2])
+	}
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), h.token) == 1
+}
+
+func (h *Handler) list(ctx context.Context, w http.ResponseWriter) {
+	infos := h.rooms.Rooms(ctx)
+	sort.Slice(infos, func(i, j int) bool { return infos[i].CreatedAt.Before(infos[j].CreatedAt) })
+	out := make([]roomSummary, 0, len(infos))
+	for _, info := range infos {
+		out = append(out, summarize(info))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (h *Handler) inspect(ctx context.Context, w http.ResponseWriter, roomID string) {
+	info, err := h.rooms.Inspect(ctx, roomID)
+	if err != nil {
+		h.writeRoomError(w, err)
+		return
+	}
+	s := info.State
+	detail := roomDetail{
+		roomSummary: summarize(info),
+		State: stateJSON{
+			Seed:        s.Seed,
+			Hash:        fmt.Sprintf("%016x", s.Hash()),
+			SuddenDeath: s.SuddenDeath(),
+			Rules: rulesJSON{
+				MaxHP:            s.Rules.MaxHP,
+				DamageMultiplier: s.Rules.DamageMultiplier,
+				TimeLimitTicks:   s.Rules.TimeLimitTicks,
+				SuddenDeathTicks: s.Rules.SuddenDeathTicks,
+				Players:          s.Rules.Players,
+				TeamSize:         s.Rules.TeamSize,
+				FriendlyFire:     s.Rules.FriendlyFire,
+				FixedPoint:       s.Rules.FixedPoint,
+			},
+		},
+	}
+	for _, sk := range s.Rules.Skills {
+		sj := skillJSON{
+			ID: sk.ID, Name: sk.Name, Damage: sk.Damage, Heal: sk.Heal, Range: sk.Range,
+			Cooldown: sk.Cooldown, CastTime: sk.CastTime, Target: sk.Target.String(),
+			Speed: sk.Speed, Radius: sk.Radius,
+		}
+		for _, e := range sk.Effects {
+			sj.Effects = append(sj.Effects, e.Kind.String())
+		}
+		detail.State.Rules.Skills = append(detail.State.Rules.Skills, sj)
+	}
+	for _, p := range replay.Players(s) {
+		pj := playerJSON{
+			ID: p.ID, Team: p.Team, X: p.X, Y: p.Y, HP: p.HP, Cooldowns: []cooldownJSON{}, Casting: p.Casting, Effects: []effectJSON{},
+			DamageDealt: p.DamageDealt, Forfeited: p.Forfeited,
+		}
+		for _, cd := range s.ActiveCooldowns(&p) {
+			pj.Cooldowns = append(pj.Cooldowns, cooldownJSON{SkillID: cd.SkillID, Ticks: cd.Ticks})
+		}
+		for _, e := range p.Effects {
+			pj.Effects = append(pj.Effects, effectJSON{
+				Kind: e.Kind.String(), SkillID: e.SkillID, Source: e.Source, Ticks: e.Ticks, Amount: e.Amount, Slow: e.Slow,
+			})
+		}
+		detail.State.Players = append(detail.State.Players, pj)
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+func (h *Handler) act(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, action string) {
+	body := http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	var err error
+	switch action {
+	case "end":
+		var req endReq
+		if !decode(w, body, &req) {
+			return
+		}
+		outcome, ok := parseOutcome(req.Outcome)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "outcome must be win, draw, timeout or abandoned")
+			return
+		}
+		err = h.rooms.ForceEnd(ctx, roomID, battle.Result{Outcome: outcome, Winner: req.Winner, Team: req.Team, Reason: req.Reason})
+	case "kick":
+		var req kickReq
+		if !decode(w, body, &req) {
+			return
+		}
+		err = h.rooms.Kick(ctx, roomID, req.PlayerID)
+	case "message":
+		var req messageReq
+		if !decode(w, body, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Text) == "" {
+			writeError(w, http.StatusBadRequest, "empty text")
+			return
+		}
+		err = h.rooms.Announce(ctx, roomID, req.Text)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err != nil {
+		h.writeRoomError(w, err)
+		return
+	}
+	h.log.Info("admin action", zap.String("room", roomID), zap.String("action", action))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) writeRoomError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, room.ErrNotFound), errors.Is(err, room.ErrNotInRoom):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, room.ErrEnded):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, room.ErrBadResult):
+		writeError(w, http.StatusBadRequest, "win needs a winner or a team; other outcomes must not name one")
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, "room did not answer")
+	default:
+		h.log.Warn("admin request failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func summarize(info room.Info) roomSummary {
+	return roomSummary{
+		ID:        info.ID,
+		MatchID:   info.MatchID,
+		Phase:     info.Phase.String(),
+		Players:   info.Players,
+		Observers: info.Observers,
+		Tick:      info.Tick,
+		AgeSec:    time.Since(info.CreatedAt).Seconds(),
+	}
+}
+
+func parseOutcome(s string) (battle.Outcome, bool) {
+	for _, o := range []battle.Outcome{battle.OutcomeWin, battle.OutcomeDraw, battle.OutcomeTimeout, battle.OutcomeAbandoned} {
+		if o.String() == s {
+			return o, true
+		}
+	}
+	return 0, false
+}
+
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func decode(w http.ResponseWriter, body io.Reader, v any) bool {
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/room"
+	"miniarena/server/internal/store"
+)
+
+const testToken = "secret"
+
+// noteSender keeps a line per message the room sends to a player.
+type noteSender struct {
+	mu    sync.Mutex
+	notes []string
+}
+
+func (s *noteSender) Send(playerID string, msgType protocol.MsgType, msg proto.Message) error {
+	var note string
+	switch m := msg.(type) {
+	case *protocol.RoomOver:
+		note = fmt.Sprintf("over %s %q %d", m.Outcome, m.WinnerId, m.WinningTeam)
+	case *protocol.ErrorResp:
+		note = fmt.Sprintf("error %d", m.Code)
+	case *protocol.ChatMessage:
+		note = fmt.Sprintf("chat %q", m.Text)
+	default:
+		return nil
+	}
+	s.mu.Lock()
+	s.notes = append(s.notes, playerID+": "+note)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *noteSender) SendReliable(playerID string, msgType protocol.MsgType, msg proto.Message) error {
+	return s.Send(playerID, msgType, msg)
+}
+
+func (s *noteSender) take() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.notes
+	s.notes = nil
+	return out
+}
+
+func TestHandler(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		// path has {id} replaced by the live room's ID.
+		path string
+		body string
+		// token is sent as the bearer token; "-" sends no Authorization
+		// header.
+		token string
+		// ended force-ends the room before the request.
+		ended bool
+		want  int
+		// notes are what the players receive, in order.
+		notes []string
+	}{
+		{name: "no token", method: http.MethodGet, path: "/admin/rooms", token: "-", want: 401},
+		{name: "wrong token", method: http.MethodGet, path: "/admin/rooms", token: "guess", want: 401},
+		{name: "wrong token on a write", method: http.MethodPost, path: "/admin/rooms/{id}/message", body: `{"text":"hi"}`, token: "guess", want: 401},
+		{name: "list", method: http.MethodGet, path: "/admin/rooms", want: 200},
+		{name: "inspect", method: http.MethodGet, path: "/admin/rooms/{id}", want: 200},
+		{name: "inspect unknown room", method: http.MethodGet, path: "/admin/rooms/nope", want: 404},
+		{name: "unknown path", method: http.MethodGet, path: "/admin/players", want: 404},
+		{name: "unknown action", method: http.MethodPost, path: "/admin/rooms/{id}/pause", body: `{}`, want: 404},
+		{name: "wrong method", method: http.MethodPost, path: "/admin/rooms/{id}", want: 405},
+		{name: "bad json", method: http.MethodPost, path: "/admin/rooms/{id}/end", body: `{`, want: 400},
+
+		{
+			name: "end with a winner", method: http.MethodPost, path: "/admin/rooms/{id}/end",
+			body: `{"outcome":"win","winner":"a"}`, want: 204,
+			notes: []string{`a: over win "a" 0`, `b: over win "a" 0`, `c: over win "a" 0`, `d: over win "a" 0`},
+		},
+		{
+			name: "end with a team", method: http.MethodPost, path: "/admin/rooms/{id}/end",
+			body: `{"outcome":"win","team":2}`, want: 204,
+			notes: []string{`a: over win "" 2`, `b: over win "" 2`, `c: over win "" 2`, `d: over win "" 2`},
+		},
+		{
+			name: "end in a draw", method: http.MethodPost, path: "/admin/rooms/{id}/end",
+			body: `{"outcome":"draw"}`, want: 204,
+			notes: []string{`a: over draw "" 0`, `b: over draw "" 0`, `c: over draw "" 0`, `d: over draw "" 0`},
+		},
+		{name: "end an unknown room", method: http.MethodPost, path: "/admin/rooms/nope/end", body: `{"outcome":"draw"}`, want: 404},
+		{name: "end with an unknown outcome", method: http.MethodPost, path: "/admin/rooms/{id}/end", body: `{"outcome":"aborted"}`, want: 400},
+		{name: "win without a winner", method: http.MethodPost, path: "/admin/rooms/{id}/end", body: `{"outcome":"win"}`, want: 400},
+		{name: "win with a winner and a team", method: http.MethodPost, path: "/admin/rooms/{id}/end", body: `{"outcome":"win","winner":"a","team":1}`, want: 400},
+		{name: "draw with a winner", method: http.MethodPost, path: "/admin/rooms/{id}/end", body: `{"outcome":"draw","winner":"a"}`, want: 400},
+		{name: "timeout with a team", method: http.MethodPost, path: "/admin/rooms/{id}/end", body: `{"outcome":"timeout","team":1}`, want: 400},
+		{name: "winner not in the room", method: http.MethodPost, path: "/admin/rooms/{id}/end", body: `{"outcome":"win","winner":"z"}`, want: 404},
+		{name: "team not in the room", method: http.MethodPost, path: "/admin/rooms/{id}/end", body: `{"outcome":"win","team":3}`, want: 404},
+		{name: "end twice", method: http.MethodPost, path: "/admin/rooms/{id}/end", body: `{"outcome":"draw"}`, ended: true, want: 409},
+
+		{name: "kick", method: http.MethodPost, path: "/admin/rooms/{id}/kick", body: `{"player_id":"b"}`, want: 204, notes: []string{"b: error 403"}},
+		{name: "kick a non-member", method: http.MethodPost, path: "/admin/rooms/{id}/kick", body: `{"player_id":"z"}`, want: 404},
+		{name: "kick from an unknown room", method: http.MethodPost, path: "/admin/rooms/nope/kick", body: `{"player_id":"b"}`, want: 404},
+		{name: "kick after the end", method: http.MethodPost, path: "/admin/rooms/{id}/kick", body: `{"player_id":"b"}`, ended: true, want: 409},
+
+		{
+			name: "announce", method: http.MethodPost, path: "/admin/rooms/{id}/message", body: `{"text":"restart soon"}`, want: 204,
+			notes: []string{`a: chat "restart soon"`, `b: chat "restart soon"`, `c: chat "restart soon"`, `d: chat "restart soon"`},
+		},
+		{name: "announce nothing", method: http.MethodPost, path: "/admin/rooms/{id}/message", body: `{"text":"  "}`, want: 400},
+		{name: "announce to an unknown room", method: http.MethodPost, path: "/admin/rooms/nope/message", body: `{"text":"hi"}`, want: 404},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			log := zap.NewNop()
+			sender := &noteSender{}
+			rules := battle.DefaultRules(4)
+			rules.TeamSize = 2
+			rooms := room.NewManager(room.Settings{
+				Tick:         time.Hour,
+				ReadyTimeout: time.Hour,
+				Rules:        rules,
+			}, sender, store.NewMemoryIdem(), nil, log, room.Hooks{})
+			t.Cleanup(rooms.Stop)
+			roomID := rooms.CreateRoom(room.Spec{MatchID: "m1", Players: []string{"a", "b", "c", "d"}, Rules: rules})
+			if tc.ended {
+				if err := rooms.ForceEnd(context.Background(), roomID, battle.Result{Outcome: battle.OutcomeDraw}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sender.take()
+
+			req := httptest.NewRequest(tc.method, strings.ReplaceAll(tc.path, "{id}", roomID), strings.NewReader(tc.body))
+			switch tc.token {
+			case "-":
+			case "":
+				req.Header.Set("Authorization", "Bearer "+testToken)
+			default:
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			w := httptest.NewRecorder()
+			NewHandler(testToken, rooms, log).ServeHTTP(w, req)
+
+			if w.Code != tc.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+			if w.Code == 200 && !strings.Contains(w.Body.String(), roomID) {
+				t.Fatalf("room %s missing from %s", roomID, w.Body)
+			}
+			if got := sender.take(); !reflect.DeepEqual(got, tc.notes) {
+				t.Fatalf("players got %q, want %q", got, tc.notes)
+			}
+		})
+	}
+}
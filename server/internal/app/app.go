@@ -2,18 +2,28 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 
 	"go.uber.org/zap"
 
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/admin"
 	"miniarena/server/internal/auth"
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/chat"
 	"miniarena/server/internal/config"
+	"miniarena/server/internal/lobby"
 	"miniarena/server/internal/match"
 	"miniarena/server/internal/metrics"
 	"miniarena/server/internal/netws"
+	"miniarena/server/internal/replay"
 	"miniarena/server/internal/room"
 	"miniarena/server/internal/session"
+	"miniarena/server/internal/social"
 	"miniarena/server/internal/store"
 )
 
@@ -35,26 +45,136 @@ func New(cfg config.Config) (*App, error) {
 		return nil, err
 	}
 
+	tick := time.Duration(cfg.TickMS) * time.Millisecond
+	rules := battle.DefaultRules(cfg.PlayersPerRoom)
+	rules.TimeLimitTicks = int64(cfg.MatchTimeLimit / tick)
+	rules.SuddenDeathTicks = int64(cfg.SuddenDeath / tick)
+	rules.FixedPoint = cfg.FixedPoint
+	if cfg.SkillsFile != "" {
+		if rules.Skills, err = loadSkills(cfg.SkillsFile, tick); err != nil {
+			return nil, err
+		}
+		log.Info("skill catalog loaded", zap.String("file", cfg.SkillsFile), zap.Int("skills", len(rules.Skills)))
+	}
+	var maps []battle.Map
+	if cfg.MapsDir != "" {
+		if maps, err = loadMaps(cfg.MapsDir); err != nil {
+			return nil, err
+		}
+		log.Info("maps loaded", zap.String("dir", cfg.MapsDir), zap.Int("maps", len(maps)))
+	}
+
 	metricsSrv := metrics.NewMetrics()
 	storeSrv, err := store.NewStore(cfg, log)
 	if err != nil {
 		return nil, err
 	}
 
-	sessions := session.NewManager(cfg.ReconnectTTL, metricsSrv, log)
+	sessions := session.NewManager(cfg.ReconnectTTL, cfg.ReliableBufferSize, metricsSrv, log)
 	authMgr := auth.NewManager(cfg.JWTSecret)
-	rooms := room.NewManager(time.Duration(cfg.TickMS)*time.Millisecond, sessions, storeSrv.Idem, metricsSrv, log, func(roomID string, players []string) {
-		for _, pid := range players {
-			sessions.SetRoom(pid, "")
+	difficulty, err := room.ParseDifficulty(cfg.AIDifficulty)
+	if err != nil {
+		log.Warn("bad AI difficulty, using normal", zap.Error(err))
+	}
+	roomSettings := room.Settings{
+		Tick:         tick,
+		ReadyTimeout: cfg.ReadyTimeout,
+		Countdown:    cfg.Countdown,
+
+		MaxSpectators:  cfg.MaxSpectators,
+		SpectatorDelay: cfg.SpectatorDelay,
+		Rules:          rules,
+		Maps:           maps,
+		Chat: chat.Settings{
+			MaxLength:  cfg.ChatMaxLength,
+			RateLimit:  cfg.ChatRateLimit,
+			RateWindow: cfg.ChatRateWindow,
+			History:    cfg.ChatHistory,
+			Filter:     chat.NewFilter(cfg.ChatBlockedWords),
+		},
+		Replays:         newReplayStore(cfg, storeSrv, log),
+		Matches:         storeSrv.Matches,
+		DisconnectGrace: cfg.DisconnectGrace,
+		RematchWindow:   cfg.RematchWindow,
+		AI:              room.AISettings{Difficulty: difficulty, TakeOver: cfg.AITakeOver},
+		Shards:          cfg.RoomShards,
+		StallAfter:      cfg.RoomStallAfter,
+	}
+	if cfg.CheckpointEvery > 0 {
+		roomSettings.Checkpoints = storeSrv.Checkpoints
+		roomSettings.CheckpointEvery = cfg.CheckpointEvery
+		roomSettings.ResumeWithin = cfg.ReconnectTTL
+	}
+	rooms := room.NewManager(roomSettings, sessions, storeSrv.Idem, metricsSrv, log, room.Hooks{
+		OnClosed: func(roomID string, players, observers []string) {
+			for _, pid := range players {
+				sessions.ClearRoom(pid, roomID)
+			}
+			for _, pid := range observers {
+				sessions.ClearSpectating(pid, roomID)
+			}
+		},
+		OnPlayerRemoved: func(roomID, playerID string) {
+			sessions.ClearRoom(playerID, roomID)
+		},
+		OnRecovered: func(cp store.Checkpoint, resumed bool) {
+			// Players of a settled match come back to the lobby and find
+			// its RoomOver waiting.
+			roomID := ""
+			if resumed {
+				roomID = cp.RoomID
+			}
+			for _, pid := range cp.Players {
+				sessions.Restore(pid, cp.Names[pid], roomID)
+			}
+		},
+		OnRematchStarted: func(roomID string, spec room.Spec) {
+			resp := &protocol.MatchResp{
+				MatchId: spec.MatchID,
+				RoomId:  roomID,
+				Players: append(append([]string(nil), spec.Players...), spec.Bots...),
+				MapId:   spec.Rules.Map.ID,
+				Teams:   spec.Teams(),
+			}
+			for _, pid := range spec.Players {
+				sessions.SetRoom(pid, roomID)
+				_ = sessions.SendReliable(pid, protocol.MsgMatchResp, resp)
+			}
+		},
+	})
+	recoverRooms(rooms, log)
+	lobbies := lobby.NewManager(rooms, sessions, roomSettings.Tick, log)
+	matcher := match.NewMatcher(match.Modes(cfg.PlayersPerRoom, cfg.FriendlyFireModes), cfg.MatchQueueSize, cfg.BotFillAfter, rooms, sessions, lobbies.InLobby, metricsSrv, log)
+
+	sessions.Subscribe(auditSessionEvents(metricsSrv, log))
+	sessions.Subscribe(matcher.OnSessionEvent)
+	socialSrv := social.NewService(storeSrv.Friends, sessions, log)
+	sessions.Subscribe(socialSrv.OnSessionEvent)
+	sessions.Subscribe(lobbies.OnSessionEvent)
+	sessions.Subscribe(func(ev session.Event) {
+		switch ev.Type {
+		case session.EventDisconnected:
+			if ev.RoomID != "" {
+				rooms.SendEvent(ev.RoomID, room.Event{Type: room.EventDisconnect, PlayerID: ev.PlayerID})
+			}
+			if watched := sessions.SetSpectating(ev.PlayerID, ""); watched != "" {
+				rooms.SendEvent(watched, room.Event{Type: room.EventUnspectate, PlayerID: ev.PlayerID})
+			}
+		case session.EventExpired:
+			if ev.RoomID != "" {
+				rooms.SendEvent(ev.RoomID, room.Event{Type: room.EventLeave, PlayerID: ev.PlayerID})
+			}
 		}
 	})
-	matcher := match.NewMatcher(cfg.PlayersPerRoom, cfg.MatchQueueSize, rooms, sessions, metricsSrv, log)
 
-	netServer := netws.NewServer(cfg, log, metricsSrv, authMgr, sessions, matcher, rooms)
+	netServer := netws.NewServer(cfg, log, metricsSrv, authMgr, sessions, matcher, rooms, socialSrv, lobbies)
 
 	mux := http.NewServeMux()
 	mux.Handle("/ws", netServer)
 	mux.Handle("/metrics", metrics.Handler())
+	if cfg.AdminToken != "" {
+		mux.Handle(admin.Prefix, admin.NewHandler(cfg.AdminToken, rooms, log))
+	}
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
@@ -90,10 +210,102 @@ func (a *App) Run() error {
 }
 
 func (a *App) Shutdown(ctx context.Context) error {
+	a.sessions.Stop()
 	a.store.Close()
 	return a.httpServer.Shutdown(ctx)
 }
 
+// auditSessionEvents counts every session lifecycle event and logs it at
+// debug level; at info there would be a line per login and room change.
+func auditSessionEvents(m *metrics.Metrics, log *zap.Logger) session.Handler {
+	return func(ev session.Event) {
+		m.SessionEvents.WithLabelValues(ev.Type.String()).Inc()
+		log.Debug("session event",
+			zap.Stringer("type", ev.Type),
+			zap.String("player", ev.PlayerID),
+			zap.String("username", ev.Username),
+			zap.String("room", ev.RoomID),
+			zap.String("prev_room", ev.PrevRoomID),
+		)
+	}
+}
+
+// recoverRooms resumes the matches a previous run left checkpointed and
+// restores their players' sessions so they can reconnect.
+func recoverRooms(rooms *room.Manager, log *zap.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rooms.Recover(ctx); err != nil {
+		log.Warn("recover rooms failed", zap.Error(err))
+	}
+}
+
+// newReplayStore picks where match recordings go. Redis falls back to the
+// local directory when it is unavailable.
+func newReplayStore(cfg config.Config, st *store.Store, log *zap.Logger) replay.Store {
+	switch cfg.ReplayStore {
+	case "", "off":
+		return nil
+	case "redis":
+		if st.Redis != nil {
+			return replay.NewRedisStore(st.Redis, cfg.ReplayTTL)
+		}
+		log.Warn("redis unavailable, writing replays to disk", zap.String("dir", cfg.ReplayDir))
+	case "file":
+	default:
+		log.Warn("unknown replay store, writing replays to disk", zap.String("store", cfg.ReplayStore))
+	}
+	dir, err := replay.NewDirStore(cfg.ReplayDir, cfg.ReplayTTL)
+	if err != nil {
+		log.Warn("replay dir unavailable, recording disabled", zap.Error(err))
+		return nil
+	}
+	return dir
+}
+
+// loadSkills reads the skill catalog. A bad file stops startup rather than
+// running matches with a different catalog than the one configured.
+func loadSkills(path string, tick time.Duration) ([]battle.Skill, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	skills, err := battle.ParseSkills(data, tick)
+	if err != nil {
+		return nil, fmt.Errorf("skills file %s: %w", path, err)
+	}
+	return skills, nil
+}
+
+// loadMaps reads every *.json map in dir, in name order.
+func loadMaps(dir string) ([]battle.Map, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("maps dir %s: no maps", dir)
+	}
+	maps := make([]battle.Map, 0, len(files))
+	seen := make(map[string]bool, len(files))
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		mp, err := battle.ParseMap(data)
+		if err != nil {
+			return nil, fmt.Errorf("map file %s: %w", path, err)
+		}
+		if seen[mp.ID] {
+			return nil, fmt.Errorf("map file %s: duplicate id %q", path, mp.ID)
+		}
+		seen[mp.ID] = true
+		maps = append(maps, mp)
+	}
+	return maps, nil
+}
+
 func newLogger(level string) (*zap.Logger, error) {
 	if level == "debug" {
 		return zap.NewDevelopment()
@@ -23,6 +23,9 @@ type ReconnectClaims struct {
 	jwt.RegisteredClaims
 }
 
+// identityAudience marks identity tokens so no other token passes for one.
+const identityAudience = "identity"
+
 func (m *Manager) GenerateAccessToken(playerID, username string, ttl time.Duration) (string, error) {
 	claims := AccessClaims{
 		Username: username,
@@ -60,6 +63,32 @@ func (m *Manager) ParseReconnectToken(token string) (string, error) {
 	return claims.Subject, nil
 }
 
+// GenerateIdentityToken returns a token that logs the player in again under
+// the same player ID, which is what friendships are keyed by.
+func (m *Manager) GenerateIdentityToken(playerID string, ttl time.Duration) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Subject:   playerID,
+		Audience:  jwt.ClaimStrings{identityAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+	return m.sign(claims)
+}
+
+func (m *Manager) ParseIdentityToken(token string) (string, error) {
+	var claims jwt.RegisteredClaims
+	parsed, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return m.secret, nil
+	}, jwt.WithAudience(identityAudience))
+	if err != nil {
+		return "", err
+	}
+	if !parsed.Valid || claims.Subject == "" {
+		return "", jwt.ErrTokenInvalidClaims
+	}
+	return claims.Subject, nil
+}
+
 func (m *Manager) sign(claims jwt.Claims) (string, error) {
 	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return t.SignedString(m.secret)
@@ -0,0 +1,268 @@
+package battle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// DefaultMapID is the built-in open arena.
+const DefaultMapID = "open"
+
+// Point is a position in arena units.
+type Point struct {
+	X, Y float32
+}
+
+// Obstacle is a polygon that blocks movement, projectiles and line of
+// sight. Rectangles are stored as four-point polygons.
+type Obstacle struct {
+	Points []Point
+}
+
+// Map is an arena layout: its bounds, where players spawn and what stands in
+// the way.
+type Map struct {
+	ID                     string
+	Name                   string
+	MinX, MinY, MaxX, MaxY float32
+	Spawns                 []Point
+	Obstacles              []Obstacle
+}
+
+// DefaultMap is an empty 200 by 200 square with eight spawns on a circle.
+// Two players spawn where they always have, at (-50, 0) and (50, 0).
+func DefaultMap() Map {
+	const d = 35.36
+	return Map{
+		ID:   DefaultMapID,
+		Name: "Open",
+		MinX: arenaMin, MinY: arenaMin, MaxX: arenaMax, MaxY: arenaMax,
+		Spawns: []Point{
+			{-50, 0}, {-d, -d}, {0, -50}, {d, -d},
+			{50, 0}, {d, d}, {0, 50}, {-d, d},
+		},
+	}
+}
+
+var defaultMap = DefaultMap()
+
+// arena is the map the match is played on. Rules without one, such as
+// those from before maps existed, get the default.
+func (s *State) arena() *Map {
+	if s.Rules.Map.ID == "" {
+		return &defaultMap
+	}
+	return &s.Rules.Map
+}
+
+// spawn returns the spawn point of player i of n, spread evenly over the
+// map's spawns. Maps with fewer spawns than players reuse them.
+func (m *Map) spawn(i, n int) Point {
+	if n <= len(m.Spawns) {
+		return m.Spawns[i*len(m.Spawns)/n]
+	}
+	return m.Spawns[i%len(m.Spawns)]
+}
+
+// inBounds reports whether (x, y) lies inside the map bounds.
+func (m *Map) inBounds(x, y float32) bool {
+	return x >= m.MinX && x <= m.MaxX && y >= m.MinY && y <= m.MaxY
+}
+
+// blockedAt returns how far along the segment from (x1, y1) to (x2, y2),
+// from 0 to 1, it first touches an obstacle.
+func (m *Map) blockedAt(g geometry, x1, y1, x2, y2 float32) (float64, bool) {
+	first, hit := math.Inf(1), false
+	for _, o := range m.Obstacles {
+		for i, a := range o.Points {
+			b := o.Points[(i+1)%len(o.Points)]
+			if t, ok := g.cross(x1, y1, x2, y2, a.X, a.Y, b.X, b.Y); ok && t < first {
+				first, hit = t, true
+			}
+		}
+	}
+	return first, hit
+}
+
+// move walks p toward (x, y), already clamped to the bounds. A blocked move
+// stops just short of the obstacle and slides along it on whichever axis is
+// still free.
+func (m *Map) move(g geometry, p *PlayerState, x, y float32) {
+	t, blocked := m.blockedAt(g, p.X, p.Y, x, y)
+	if !blocked {
+		m.step(g, p, x, y)
+		return
+	}
+	sx, sy := g.stopShort(p.X, p.Y, x, y, t)
+	m.step(g, p, sx, sy)
+	if _, blocked := m.blockedAt(g, p.X, p.Y, x, p.Y); !blocked {
+		m.step(g, p, x, p.Y)
+	} else if _, blocked := m.blockedAt(g, p.X, p.Y, p.X, y); !blocked {
+		m.step(g, p, p.X, y)
+	}
+}
+
+// wallMargin is how far from an obstacle a blocked move stops.
+const wallMargin = 0.01
+
+func (m *Map) step(g geometry, p *PlayerState, x, y float32) {
+	p.Moved += float32(g.dist(p.X, p.Y, x, y))
+	p.X, p.Y = x, y
+}
+
+// LineOfSight reports whether nothing on the map stands between two players.
+// It is false if either is missing.
+func (s *State) LineOfSight(a, b string) bool {
+	pa, pb := s.Players[a], s.Players[b]
+	if pa == nil || pb == nil {
+		return false
+	}
+	_, blocked := s.arena().blockedAt(s.geom(), pa.X, pa.Y, pb.X, pb.Y)
+	return !blocked
+}
+
+// segmentsCross reports whether segment p1-p2 touches segment q1-q2 and
+// where along p1-p2 it does.
+func segmentsCross(px1, py1, px2, py2, qx1, qy1, qx2, qy2 float32) (float64, bool) {
+	rx, ry := float64(px2-px1), float64(py2-py1)
+	sx, sy := float64(qx2-qx1), float64(qy2-qy1)
+	wx, wy := float64(qx1-px1), float64(qy1-py1)
+	denom := rx*sy - ry*sx
+	if denom == 0 {
+		// Parallel. Collinear overlap counts as touching at the nearest
+		// shared point.
+		if wx*ry-wy*rx != 0 {
+			return 0, false
+		}
+		l := rx*rx + ry*ry
+		if l == 0 {
+			return 0, false
+		}
+		t0 := (wx*rx + wy*ry) / l
+		t1 := t0 + (sx*rx+sy*ry)/l
+		lo, hi := math.Min(t0, t1), math.Max(t0, t1)
+		if hi < 0 || lo > 1 {
+			return 0, false
+		}
+		return math.Max(lo, 0), true
+	}
+	t := (wx*sy - wy*sx) / denom
+	u := (wx*ry - wy*rx) / denom
+	if t < 0 || t > 1 || u < 0 || u > 1 {
+		return 0, false
+	}
+	return t, true
+}
+
+// inside reports whether (x, y) is strictly inside the polygon.
+func (o Obstacle) inside(x, y float32) bool {
+	in := false
+	for i, a := range o.Points {
+		b := o.Points[(i+1)%len(o.Points)]
+		if (a.Y > y) != (b.Y > y) && x < (b.X-a.X)*(y-a.Y)/(b.Y-a.Y)+a.X {
+			in = !in
+		}
+	}
+	return in
+}
+
+// area is the polygon's area by the shoelace formula. Points all on one
+// line, however many, enclose none.
+func (o Obstacle) area() float64 {
+	var sum float64
+	for i, a := range o.Points {
+		b := o.Points[(i+1)%len(o.Points)]
+		sum += float64(a.X)*float64(b.Y) - float64(b.X)*float64(a.Y)
+	}
+	return math.Abs(sum) / 2
+}
+
+type mapFile struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Bounds    [4]float32     `json:"bounds"`
+	Spawns    [][2]float32   `json:"spawns"`
+	Obstacles []obstacleJSON `json:"obstacles"`
+}
+
+type obstacleJSON struct {
+	Rect    *[4]float32  `json:"rect"`
+	Polygon [][2]float32 `json:"polygon"`
+}
+
+// ParseMap reads a map definition in JSON. Bounds and rectangles are
+// [min_x, min_y, max_x, max_y]; spawns and polygon points are [x, y].
+func ParseMap(data []byte) (Map, error) {
+	var f mapFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Map{}, err
+	}
+	m := Map{
+		ID:   f.ID,
+		Name: f.Name,
+		MinX: f.Bounds[0], MinY: f.Bounds[1], MaxX: f.Bounds[2], MaxY: f.Bounds[3],
+	}
+	for _, s := range f.Spawns {
+		m.Spawns = append(m.Spawns, Point{s[0], s[1]})
+	}
+	for i, o := range f.Obstacles {
+		switch {
+		case o.Rect != nil && o.Polygon == nil:
+			r := o.Rect
+			if r[0] >= r[2] || r[1] >= r[3] {
+				return Map{}, fmt.Errorf("obstacle %d: empty rect", i)
+			}
+			m.Obstacles = append(m.Obstacles, Obstacle{Points: []Point{
+				{r[0], r[1]}, {r[2], r[1]}, {r[2], r[3]}, {r[0], r[3]},
+			}})
+		case o.Rect == nil && len(o.Polygon) >= 3:
+			var ob Obstacle
+			for _, p := range o.Polygon {
+				ob.Points = append(ob.Points, Point{p[0], p[1]})
+			}
+			if ob.area() == 0 {
+				return Map{}, fmt.Errorf("obstacle %d: polygon has no area", i)
+			}
+			m.Obstacles = append(m.Obstacles, ob)
+		default:
+			return Map{}, fmt.Errorf("obstacle %d: needs a rect or a polygon of at least 3 points", i)
+		}
+	}
+	if err := m.validate(); err != nil {
+		return Map{}, err
+	}
+	return m, nil
+}
+
+func (m *Map) validate() error {
+	switch {
+	case m.ID == "":
+		return errors.New("map needs an id")
+	case m.MinX >= m.MaxX || m.MinY >= m.MaxY:
+		return fmt.Errorf("map %s: empty bounds", m.ID)
+	case m.MinX < -maxCoord || m.MinY < -maxCoord || m.MaxX > maxCoord || m.MaxY > maxCoord:
+		return fmt.Errorf("map %s: bounds beyond ±%d", m.ID, maxCoord)
+	case len(m.Spawns) < 2:
+		return fmt.Errorf("map %s: needs at least 2 spawns", m.ID)
+	}
+	for i, s := range m.Spawns {
+		if !m.inBounds(s.X, s.Y) {
+			return fmt.Errorf("map %s: spawn %d out of bounds", m.ID, i)
+		}
+		for _, o := range m.Obstacles {
+			if o.inside(s.X, s.Y) {
+				return fmt.Errorf("map %s: spawn %d inside an obstacle", m.ID, i)
+			}
+		}
+	}
+	for i, o := range m.Obstacles {
+		for _, p := range o.Points {
+			if p.X < -maxCoord || p.X > maxCoord || p.Y < -maxCoord || p.Y > maxCoord {
+				return fmt.Errorf("map %s: obstacle %d beyond ±%d", m.ID, i, maxCoord)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package battle
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"miniarena/pkg/protocol"
+)
+
+func TestParseMap(t *testing.T) {
+	cases := []struct {
+		name string
+		json string
+		// err is part of the error; "" expects the map to parse.
+		err string
+	}{
+		{name: "valid", json: `{"id": "m", "name": "M", "bounds": [-50, -40, 50, 40],
+			"spawns": [[-45, 0], [45, 0]],
+			"obstacles": [{"rect": [-5, -5, 5, 5]}, {"polygon": [[20, 0], [30, 10], [20, 20]]}]}`},
+		{name: "bad json", json: `{"id": `, err: "unexpected end"},
+		{name: "no id", json: `{"bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]]}`, err: "map needs an id"},
+		{name: "empty bounds", json: `{"id": "m", "bounds": [50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]]}`, err: "empty bounds"},
+		{name: "bounds too large", json: `{"id": "m", "bounds": [-20000, -50, 50, 50], "spawns": [[-45, 0], [45, 0]]}`, err: "bounds beyond"},
+		{name: "one spawn", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0]]}`, err: "needs at least 2 spawns"},
+		{name: "spawn outside the bounds", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [55, 0]]}`,
+			err: "spawn 1 out of bounds"},
+		{name: "spawn inside a rect", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]],
+			"obstacles": [{"rect": [40, -5, 50, 5]}]}`, err: "spawn 1 inside an obstacle"},
+		{name: "spawn inside a polygon", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]],
+			"obstacles": [{"polygon": [[-50, -10], [-40, 0], [-50, 10]]}]}`, err: "spawn 0 inside an obstacle"},
+		{name: "empty rect", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]],
+			"obstacles": [{"rect": [5, -5, 5, 5]}]}`, err: "obstacle 0: empty rect"},
+		{name: "inverted rect", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]],
+			"obstacles": [{"rect": [5, 5, -5, -5]}]}`, err: "obstacle 0: empty rect"},
+		{name: "rect and polygon", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]],
+			"obstacles": [{"rect": [-5, -5, 5, 5], "polygon": [[20, 0], [30, 10], [20, 20]]}]}`, err: "obstacle 0: needs a rect or a polygon"},
+		{name: "neither", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]],
+			"obstacles": [{}]}`, err: "obstacle 0: needs a rect or a polygon"},
+		{name: "two point polygon", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]],
+			"obstacles": [{"polygon": [[20, 0], [30, 10]]}]}`, err: "obstacle 0: needs a rect or a polygon"},
+		{name: "collinear polygon", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]],
+			"obstacles": [{"rect": [-5, -5, 5, 5]}, {"polygon": [[20, 0], [25, 5], [30, 10]]}]}`, err: "obstacle 1: polygon has no area"},
+		{name: "repeated points", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]],
+			"obstacles": [{"polygon": [[20, 0], [30, 10], [20, 0]]}]}`, err: "obstacle 0: polygon has no area"},
+		{name: "obstacle too far out", json: `{"id": "m", "bounds": [-50, -50, 50, 50], "spawns": [[-45, 0], [45, 0]],
+			"obstacles": [{"polygon": [[20, 0], [30000, 10], [20, 20]]}]}`, err: "obstacle 0 beyond"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := ParseMap([]byte(tc.json))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("ParseMap() error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Map{
+				ID: "m", Name: "M", MinX: -50, MinY: -40, MaxX: 50, MaxY: 40,
+				Spawns: []Point{{-45, 0}, {45, 0}},
+				Obstacles: []Obstacle{
+					rect(-5, -5, 5, 5),
+					{Points: []Point{{20, 0}, {30, 10}, {20, 20}}},
+				},
+			}
+			if !reflect.DeepEqual(m, want) {
+				t.Fatalf("ParseMap() = %+v, want %+v", m, want)
+			}
+		})
+	}
+}
+
+func TestDeployMaps(t *testing.T) {
+	files, err := filepath.Glob("../../../deploy/maps/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no maps in deploy/maps")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ParseMap(data); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// arenaState plays on a map with a wall from x 10 to 20 and a thin wall at x
+// -20.5 to -20, both from y -10 to 10.
+func arenaState(t *testing.T) *State {
+	t.Helper()
+	rules := DefaultRules(2)
+	rules.Map = testMap(rect(10, -10, 20, 10), rect(-20.5, -10, -20, 10))
+	return NewState([]string{"a", "b"}, rules, 1)
+}
+
+func TestMove(t *testing.T) {
+	cases := []struct {
+		name   string
+		from   Point
+		dx, dy float32
+		want   Point
+	}{
+		{name: "free", from: Point{0, 30}, dx: 3, dy: -4, want: Point{3, 26}},
+		{name: "stops at an edge", from: Point{7, 0}, dx: 5, want: Point{10 - wallMargin, 0}},
+		{name: "slides along an edge", from: Point{7, 0}, dx: 5, dy: 3, want: Point{10 - wallMargin, 3}},
+		{name: "slides up past a corner", from: Point{7, 6}, dx: 5, dy: 5, want: Point{10 - wallMargin, 11}},
+		{name: "passes over a corner", from: Point{7, 8}, dx: 5, dy: 5, want: Point{12, 13}},
+		{name: "slides along a top edge", from: Point{15, 12}, dx: 3, dy: -4, want: Point{18, 10 + wallMargin}},
+		{name: "no tunnelling through a thin wall", from: Point{-17, 0}, dx: -5, want: Point{-20 + wallMargin, 0}},
+		{name: "moves away from an edge", from: Point{10 - wallMargin, 0}, dx: -5, want: Point{5 - wallMargin, 0}},
+		{name: "clamped to the bounds", from: Point{98, 30}, dx: 5, want: Point{100, 30}},
+		{name: "capped per tick", from: Point{0, 30}, dx: 50, want: Point{MaxMovePerTick, 30}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := arenaState(t)
+			p := s.Players["a"]
+			p.X, p.Y = tc.from.X, tc.from.Y
+			s.ApplyInput("a", &protocol.PlayerInput{Dx: tc.dx, Dy: tc.dy})
+			// A blocked move stops wallMargin short of the edge measured
+			// along the move, so a little closer to it on each axis.
+			if math.Abs(float64(p.X-tc.want.X)) > wallMargin/2 || math.Abs(float64(p.Y-tc.want.Y)) > wallMargin/2 {
+				t.Fatalf("moved to (%v, %v), want (%v, %v)", p.X, p.Y, tc.want.X, tc.want.Y)
+			}
+		})
+	}
+}
+
+func TestLineOfSight(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b Point
+		// missing removes b from the match.
+		missing bool
+		want    bool
+	}{
+		{name: "clear", a: Point{0, 30}, b: Point{30, 30}, want: true},
+		{name: "through a wall", a: Point{0, 0}, b: Point{30, 0}},
+		{name: "through a thin wall", a: Point{-30, 0}, b: Point{0, 0}},
+		{name: "clipping a corner", a: Point{6, 4}, b: Point{14, 14}},
+		{name: "touching a corner", a: Point{4, 4}, b: Point{13, 13}},
+		{name: "along an edge", a: Point{0, 10}, b: Point{30, 10}},
+		{name: "just past an edge", a: Point{0, 10.5}, b: Point{30, 10.5}, want: true},
+		{name: "up to an edge", a: Point{0, 0}, b: Point{9.5, 0}, want: true},
+		{name: "missing player", a: Point{0, 30}, b: Point{30, 30}, missing: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := arenaState(t)
+			s.Players["a"].X, s.Players["a"].Y = tc.a.X, tc.a.Y
+			s.Players["b"].X, s.Players["b"].Y = tc.b.X, tc.b.Y
+			if tc.missing {
+				s.RemovePlayer("b")
+			}
+			if got := s.LineOfSight("a", "b"); got != tc.want {
+				t.Fatalf("LineOfSight() = %v, want %v", got, tc.want)
+			}
+			if got := s.LineOfSight("b", "a"); got != tc.want {
+				t.Fatalf("LineOfSight() back = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
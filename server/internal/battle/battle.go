@@ -2,132 +2,600 @@ package battle
 
 import (
 	"math"
+	"sort"
 
 	"miniarena/pkg/protocol"
 )
 
 const (
-	defaultHP      = 100
-	arenaMin       = -100.0
-	arenaMax       = 100.0
-	skillDamage    = 10
-	skillCooldown  = 20
-	skillRange     = 20.0
-	maxMovePerTick = 5.0
+	defaultHP = 100
+	arenaMin  = -100.0
+	arenaMax  = 100.0
+	// suddenDeathDamage multiplies skill damage once the time limit passes.
+	suddenDeathDamage = 2
 )
 
+// MaxMovePerTick is the movement limit AI controllers plan against.
+const MaxMovePerTick = 5.0
+
+// Rules are the match settings a room is created with.
+type Rules struct {
+	MaxHP            int32
+	DamageMultiplier float32
+	// TimeLimitTicks ends the match after this many ticks; 0 means no limit.
+	TimeLimitTicks int64
+	// SuddenDeathTicks extends a timed match with a sudden-death period in
+	// which skills deal double damage; 0 goes straight to the tie-break.
+	SuddenDeathTicks int64
+	Players          int
+	// Skills is the skill catalog; players may only cast these.
+	Skills []Skill
+	// Map is the arena; without an ID it is DefaultMap.
+	Map Map
+	// TeamSize splits the players into teams of that size, which win
+	// together once every other team is out; below 2 it is every player
+	// for themselves.
+	TeamSize int
+	// FriendlyFire lets skills harm teammates.
+	FriendlyFire bool
+	// FixedPoint simulates the match in fixed-point math so that the same
+	// inputs give the same state, and the same Hash, on every platform.
+	FixedPoint bool
+}
+
+// DefaultRules returns the rules used by matchmaking.
+func DefaultRules(players int) Rules {
+	return Rules{
+		MaxHP:            defaultHP,
+		DamageMultiplier: 1,
+		Players:          players,
+		Skills:           DefaultSkills(),
+	}
+}
+
 // State holds the mutable battle state.
 type State struct {
 	Players map[string]*PlayerState
 	Tick    int64
+	Rules   Rules
+	// Seed is chosen by the room and recorded in replays so randomized
+	// mechanics can be re-run. RNG is the state of the generator it
+	// seeds; randomness in the simulation comes only from there.
+	Seed int64
+	RNG  uint64
+	// Projectiles are in flight, in launch order.
+	Projectiles      []*Projectile
+	NextProjectileID int64
 }
 
 // PlayerState is the authoritative server state for a player.
 type PlayerState struct {
-	ID      string
-	X       float32
-	Y       float32
-	HP      int32
-	SkillCD int32
+	ID          string
+	Team        int32
+	X           float32
+	Y           float32
+	HP          int32
+	DamageDealt int32
+	Forfeited   bool
+	// Cooldowns are the ticks left per skill, in catalog order.
+	Cooldowns []int32
+	// Casting is the skill being cast, 0 if none. It lands on CastTarget
+	// at tick CastEnds.
+	Casting    int32
+	CastTarget string
+	CastEnds   int64
+	// Effects are the status effects on the player, oldest first.
+	Effects []StatusEffect
+
+	// Counters for PlayerStats.
+	DamageTaken  int32
+	SkillsCast   int32
+	SkillsLanded int32
+	Moved        float32
+	// DiedAt is the tick HP reached 0; only meaningful once it has.
+	DiedAt int64
 }
 
-func NewState(playerIDs []string) *State {
-	players := make(map[string]*PlayerState, len(playerIDs))
+type Outcome int
+
+const (
+	OutcomeWin Outcome = iota
+	OutcomeDraw
+	OutcomeTimeout
+	OutcomeAbandoned
+	// OutcomeAborted is a match the server gave up on after an internal
+	// error.
+	OutcomeAborted
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeWin:
+		return "win"
+	case OutcomeDraw:
+		return "draw"
+	case OutcomeTimeout:
+		return "timeout"
+	case OutcomeAbandoned:
+		return "abandoned"
+	case OutcomeAborted:
+		return "aborted"
+	default:
+		return "unknown"
+	}
+}
+
+// Result is how a match ended. A team match names the winning Team instead
+// of a Winner; both are empty for draws and abandoned matches.
+type Result struct {
+	Outcome Outcome
+	Winner  string
+	Team    int32
+	Reason  string
+}
+
+// PlayerStats summarize one player's match. Rooms send them in RoomOver and
+// hand the same values to persistence and metrics.
+type PlayerStats struct {
+	PlayerID string
+	// Placement is 1 for the winner; players who cannot be told apart
+	// share a placement.
+	Placement    int
+	DamageDealt  int32
+	DamageTaken  int32
+	SkillsCast   int32
+	SkillsLanded int32
+	Distance     float32
+	TicksAlive   int64
+	Forfeited    bool
+}
+
+// NewState sets up a match, with teams by seat as in Rules.TeamOf. Teams are
+// dealt neighbouring spawns in seat order; in fixed-point matches which team
+// gets which is drawn from seed instead.
+func NewState(playerIDs []string, rules Rules, seed int64) *State {
+	s := &State{Players: make(map[string]*PlayerState, len(playerIDs)), Rules: rules, Seed: seed, RNG: uint64(seed)}
+	arena, g := s.arena(), s.geom()
+	size := max(rules.TeamSize, 1)
+	n := (len(playerIDs) + size - 1) / size
+	groups := make([]int, n)
+	for i := range groups {
+		groups[i] = i
+	}
+	if rules.FixedPoint {
+		groups = s.perm(n)
+	}
 	for i, id := range playerIDs {
-		players[id] = &PlayerState{
-			ID: id,
-			X:  float32(-50 + i*100),
-			Y:  0,
-			HP: defaultHP,
+		at := arena.spawn(groups[i/size]*size+i%size, len(groups)*size)
+		s.Players[id] = &PlayerState{
+			ID:        id,
+			Team:      rules.TeamOf(i),
+			X:         g.snap(at.X),
+			Y:         g.snap(at.Y),
+			HP:        rules.MaxHP,
+			Cooldowns: make([]int32, len(rules.Skills)),
+		}
+	}
+	return s
+}
+
+// Clone returns a deep copy of the state.
+func (s *State) Clone() *State {
+	c := *s
+	c.Players = make(map[string]*PlayerState, len(s.Players))
+	for id, p := range s.Players {
+		cp := *p
+		cp.Cooldowns = append([]int32(nil), p.Cooldowns...)
+		cp.Effects = append([]StatusEffect(nil), p.Effects...)
+		c.Players[id] = &cp
+	}
+	c.Projectiles = nil
+	for _, pr := range s.Projectiles {
+		cp := *pr
+		c.Projectiles = append(c.Projectiles, &cp)
+	}
+	return &c
+}
+
+// RemovePlayer drops a player who never joined the match.
+func (s *State) RemovePlayer(playerID string) {
+	delete(s.Players, playerID)
+}
+
+// Forfeit kills a player who left the match.
+func (s *State) Forfeit(playerID string) {
+	if p := s.Players[playerID]; p != nil {
+		if p.HP > 0 {
+			p.DiedAt = s.Tick
 		}
+		p.HP = 0
+		p.Forfeited = true
 	}
-	return &State{Players: players}
 }
 
+// ApplyInput moves the player within the map bounds and around obstacles.
+// Stunned players do not move and slowed ones move less.
 func (s *State) ApplyInput(playerID string, input *protocol.PlayerInput) {
 	p := s.Players[playerID]
-	if p == nil || p.HP <= 0 || input == nil {
+	if p == nil || p.HP <= 0 || input == nil || p.stunned() {
 		return
 	}
 
-	dx := clampFloat32(input.Dx, -maxMovePerTick, maxMovePerTick)
-	dy := clampFloat32(input.Dy, -maxMovePerTick, maxMovePerTick)
+	g := s.geom()
+	limit := p.moveLimit(g)
+	dx := clampFloat32(g.snap(input.Dx), -limit, limit)
+	dy := clampFloat32(g.snap(input.Dy), -limit, limit)
 
-	p.X = clampFloat32(p.X+dx, arenaMin, arenaMax)
-	p.Y = clampFloat32(p.Y+dy, arenaMin, arenaMax)
+	arena := s.arena()
+	x := clampFloat32(p.X+dx, arena.MinX, arena.MaxX)
+	y := clampFloat32(p.Y+dy, arena.MinY, arena.MaxY)
+	arena.move(g, p, x, y)
 }
 
+// ApplySkill starts a cast. Casts of unknown skills, skills on cooldown, bad
+// targets and casts while stunned or with another one in progress are
+// ignored.
 func (s *State) ApplySkill(casterID string, skill *protocol.SkillCast) {
 	caster := s.Players[casterID]
-	if caster == nil || caster.HP <= 0 || skill == nil {
+	if caster == nil || caster.HP <= 0 || skill == nil || caster.Casting != 0 || caster.stunned() {
 		return
 	}
-	if caster.SkillCD > 0 {
+	i, sk, ok := s.Rules.Skill(skill.SkillId)
+	if !ok || caster.Cooldowns[i] > 0 {
 		return
 	}
-	if skill.TargetId == "" || skill.TargetId == casterID {
+	targetID := skill.TargetId
+	switch sk.Target {
+	case TargetSelf:
+		targetID = casterID
+	case TargetEnemy:
+		if t := s.Players[targetID]; targetID == casterID || (t != nil && s.spares(caster, t)) {
+			return
+		}
+	}
+	if targetID == "" {
 		return
 	}
 
-	target := s.Players[skill.TargetId]
-	if target == nil || target.HP <= 0 {
+	caster.SkillsCast++
+	caster.Cooldowns[i] = sk.Cooldown
+	if sk.CastTime > 0 {
+		caster.Casting = sk.ID
+		caster.CastTarget = targetID
+		caster.CastEnds = s.Tick + int64(sk.CastTime)
 		return
 	}
+	s.land(caster, sk, targetID)
+}
 
-	if distance(caster.X, caster.Y, target.X, target.Y) > skillRange {
+// land applies the skill's effect if the target is alive, in range and in
+// sight, or fires it at the target if it is a projectile.
+func (s *State) land(caster *PlayerState, sk Skill, targetID string) {
+	target := s.Players[targetID]
+	if target == nil || target.HP <= 0 {
 		return
 	}
+	if sk.Projectile() {
+		s.launch(caster, sk, target)
+		return
+	}
+	if target != caster {
+		if s.geom().dist(caster.X, caster.Y, target.X, target.Y) > sk.Range || !s.LineOfSight(caster.ID, target.ID) {
+			return
+		}
+	}
+	s.hit(caster, sk, target)
+}
 
-	target.HP -= skillDamage
-	if target.HP < 0 {
-		target.HP = 0
+// hit applies the skill's damage, healing and effects to the target. Without
+// friendly fire, teammates only get the helpful part.
+func (s *State) hit(caster *PlayerState, sk Skill, target *PlayerState) {
+	spared := s.spares(caster, target)
+	if sk.Damage > 0 && !spared {
+		s.dealDamage(caster, target, sk.Damage)
+	}
+	if sk.Heal > 0 {
+		target.HP += sk.Heal
+		if target.HP > s.Rules.MaxHP {
+			target.HP = s.Rules.MaxHP
+		}
+	}
+	if target.HP > 0 {
+		for _, spec := range sk.Effects {
+			if !spared || !spec.Kind.harmful() {
+				s.applyEffect(caster, sk, spec, target)
+			}
+		}
+	}
+	caster.SkillsLanded++
+}
+
+// dealDamage scales base damage, lets the target's shields absorb what they
+// can and credits the rest to source, which may be nil.
+func (s *State) dealDamage(source, target *PlayerState, base int32) {
+	if target.HP <= 0 {
+		return
+	}
+	dealt := min(target.absorb(s.damage(base)), target.HP)
+	target.HP -= dealt
+	target.DamageTaken += dealt
+	if target.HP == 0 {
+		target.DiedAt = s.Tick
+	}
+	if source != nil {
+		source.DamageDealt += dealt
 	}
-	caster.SkillCD = skillCooldown
 }
 
 func (s *State) TickForward() {
 	s.Tick++
-	for _, p := range s.Players {
-		if p.SkillCD > 0 {
-			p.SkillCD--
+	// Players go in ID order throughout so that nothing depends on map
+	// order: DoTs can kill, and casts landing on the same tick resolve
+	// one after another. A caster killed by an earlier one loses their
+	// cast.
+	players := s.sortedPlayers()
+	for _, p := range players {
+		s.tickEffects(p)
+	}
+	var landing []*PlayerState
+	for _, p := range players {
+		for i := range p.Cooldowns {
+			if p.Cooldowns[i] > 0 {
+				p.Cooldowns[i]--
+			}
+		}
+		if p.Casting != 0 && s.Tick >= p.CastEnds {
+			landing = append(landing, p)
+		}
+	}
+	for _, p := range landing {
+		_, sk, ok := s.Rules.Skill(p.Casting)
+		target := p.CastTarget
+		p.Casting, p.CastTarget, p.CastEnds = 0, "", 0
+		if ok && p.HP > 0 {
+			s.land(p, sk, target)
 		}
 	}
+	s.advanceProjectiles()
 }
 
+// Snapshot describes the state for clients, players in ID order. Fixed-point
+// matches include the state hash so clients can detect a desync.
 func (s *State) Snapshot(roomID string) *protocol.RoomSnapshot {
 	players := make([]*protocol.PlayerSnapshot, 0, len(s.Players))
-	for _, p := range s.Players {
-		players = append(players, &protocol.PlayerSnapshot{
+	for _, p := range s.sortedPlayers() {
+		ps := &protocol.PlayerSnapshot{
 			PlayerId: p.ID,
+			TeamId:   p.Team,
 			X:        p.X,
 			Y:        p.Y,
 			Hp:       p.HP,
-			SkillCd:  p.SkillCD,
-		})
+			Casting:  p.Casting,
+		}
+		if len(p.Cooldowns) > 0 {
+			ps.SkillCd = p.Cooldowns[0]
+		}
+		for _, cd := range s.ActiveCooldowns(p) {
+			ps.Cooldowns = append(ps.Cooldowns, &protocol.SkillCooldown{SkillId: cd.SkillID, Ticks: cd.Ticks})
+		}
+		ps.Effects = effectSnapshots(p)
+		players = append(players, ps)
+	}
+	snap := &protocol.RoomSnapshot{
+		RoomId:      roomID,
+		Tick:        s.Tick,
+		Players:     players,
+		Projectiles: s.projectileSnapshots(),
 	}
-	return &protocol.RoomSnapshot{
-		RoomId:  roomID,
-		Tick:    s.Tick,
-		Players: players,
+	if s.Rules.FixedPoint {
+		snap.StateHash = s.Hash()
 	}
+	return snap
 }
 
-func (s *State) Winner() (string, bool) {
-	alive := ""
-	count := 0
-	for _, p := range s.Players {
+// SuddenDeath reports whether the time limit has passed and the match is in
+// its sudden-death period.
+func (s *State) SuddenDeath() bool {
+	return s.Rules.TimeLimitTicks > 0 && s.Tick >= s.Rules.TimeLimitTicks
+}
+
+// EndTick is the last tick of a timed match, or 0 without a time limit.
+func (s *State) EndTick() int64 {
+	if s.Rules.TimeLimitTicks <= 0 {
+		return 0
+	}
+	return s.Rules.TimeLimitTicks + s.Rules.SuddenDeathTicks
+}
+
+// Result reports whether the match is over and how it ended. A side, a team
+// or a lone player in a free-for-all, is out once none of its players is
+// alive.
+func (s *State) Result() (Result, bool) {
+	sides := s.sides()
+	var alive []*side
+	forfeited := 0
+	for _, sd := range sides {
+		if sd.alive() {
+			alive = append(alive, sd)
+		}
+		if sd.forfeited() {
+			forfeited++
+		}
+	}
+
+	standing := "last player standing"
+	if s.Rules.TeamSize >= 2 {
+		standing = "last team standing"
+	}
+	switch {
+	case len(alive) == 1 && forfeited == len(sides)-1:
+		return alive[0].win(OutcomeWin, "opponents left"), true
+	case len(alive) == 1:
+		return alive[0].win(OutcomeWin, standing), true
+	case len(alive) == 0 && forfeited == len(sides):
+		return Result{Outcome: OutcomeAbandoned, Reason: "all players left"}, true
+	case len(alive) == 0:
+		// Every side still in the match fell on the same tick. Nobody is
+		// left to have won; Stats still ranks them.
+		return Result{Outcome: OutcomeDraw, Reason: "eliminated together"}, true
+	}
+
+	if end := s.EndTick(); end > 0 && s.Tick >= end {
+		return tieBreak(alive, OutcomeTimeout, "time limit"), true
+	}
+	return Result{}, false
+}
+
+// Stats returns every player's stats for a finished match, best placement
+// first. Placements go to sides, so teammates share one. The winner places
+// first; the rest are ranked by players still alive, HP left, how long they
+// lasted and damage dealt. Within a team, players are listed by the same
+// measures.
+func (s *State) Stats(res Result) []PlayerStats {
+	lasted := func(p *PlayerState) int64 {
 		if p.HP > 0 {
-			count++
-			alive = p.ID
-			if count > 1 {
-				return "", false
+			return s.Tick
+		}
+		return p.DiedAt
+	}
+	key := func(players []*PlayerState) [4]int64 {
+		var k [4]int64
+		for _, p := range players {
+			if p.HP > 0 {
+				k[0]++
 			}
+			k[1] += int64(p.HP)
+			k[2] = max(k[2], lasted(p))
+			k[3] += int64(p.DamageDealt)
+		}
+		return k
+	}
+	ahead := func(a, b []*PlayerState) bool {
+		ka, kb := key(a), key(b)
+		for i := range ka {
+			if ka[i] != kb[i] {
+				return ka[i] > kb[i]
+			}
+		}
+		return false
+	}
+	better := func(a, b *side) bool {
+		if res.won(a.players[0]) != res.won(b.players[0]) {
+			return res.won(a.players[0])
 		}
+		return ahead(a.players, b.players)
+	}
+
+	// Sides and their players start in ID order, which breaks ties.
+	sides := s.sides()
+	sort.SliceStable(sides, func(i, j int) bool { return better(sides[i], sides[j]) })
+
+	stats := make([]PlayerStats, 0, len(s.Players))
+	place := 0
+	for i, sd := range sides {
+		if i == 0 || better(sides[i-1], sd) {
+			place = i + 1
+		}
+		players := sd.players
+		sort.SliceStable(players, func(i, j int) bool {
+			return ahead(players[i:i+1], players[j:j+1])
+		})
+		for _, p := range players {
+			stats = append(stats, PlayerStats{
+				PlayerID:     p.ID,
+				Placement:    place,
+				DamageDealt:  p.DamageDealt,
+				DamageTaken:  p.DamageTaken,
+				SkillsCast:   p.SkillsCast,
+				SkillsLanded: p.SkillsLanded,
+				Distance:     p.Moved,
+				TicksAlive:   lasted(p),
+				Forfeited:    p.Forfeited,
+			})
+		}
+	}
+	return stats
+}
+
+// tieBreak picks the side with the most HP, then the most damage dealt. If
+// that still ties, the match is a draw.
+func tieBreak(sides []*side, outcome Outcome, reason string) Result {
+	var best *side
+	tied := false
+	for _, sd := range sides {
+		switch {
+		case best == nil || sd.hp() > best.hp() || (sd.hp() == best.hp() && sd.dealt() > best.dealt()):
+			best, tied = sd, false
+		case sd.hp() == best.hp() && sd.dealt() == best.dealt():
+			tied = true
+		}
+	}
+	if best == nil || tied {
+		return Result{Outcome: OutcomeDraw, Reason: reason + ": tied"}
+	}
+	for _, sd := range sides {
+		if sd != best && sd.hp() == best.hp() {
+			return best.win(outcome, reason+": most damage dealt")
+		}
+	}
+	return best.win(outcome, reason+": most HP left")
+}
+
+// damage scales base damage by the rules' multiplier, dealing at least 1.
+func (s *State) damage(base int32) int32 {
+	mult := s.Rules.DamageMultiplier
+	if s.SuddenDeath() {
+		mult *= suddenDeathDamage
+	}
+	d := int32(math.Round(float64(float32(base) * mult)))
+	if d < 1 {
+		return 1
+	}
+	return d
+}
+
+// sortedPlayers returns the players in ID order. Every step that visits more
+// than one player goes through it.
+func (s *State) sortedPlayers() []*PlayerState {
+	players := make([]*PlayerState, 0, len(s.Players))
+	for _, p := range s.Players {
+		players = append(players, p)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].ID < players[j].ID })
+	return players
+}
+
+// Distance returns how far apart two players are, or false if either is
+// missing.
+func (s *State) Distance(a, b string) (float64, bool) {
+	pa, pb := s.Players[a], s.Players[b]
+	if pa == nil || pb == nil {
+		return 0, false
+	}
+	return s.geom().dist(pa.X, pa.Y, pb.X, pb.Y), true
+}
+
+// intn returns a number in [0, n) from the state's generator, a splitmix64.
+func (s *State) intn(n int) int {
+	s.RNG += 0x9e3779b97f4a7c15
+	z := s.RNG
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return int(z % uint64(n))
+}
+
+// perm returns a random permutation of [0, n).
+func (s *State) perm(n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
 	}
-	if count == 0 {
-		return "", true
+	for i := n - 1; i > 0; i-- {
+		j := s.intn(i + 1)
+		p[i], p[j] = p[j], p[i]
 	}
-	return alive, true
+	return p
 }
 
 func distance(x1, y1, x2, y2 float32) float64 {
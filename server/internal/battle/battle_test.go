@@ -0,0 +1,307 @@
+package battle
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"miniarena/pkg/protocol"
+)
+
+// player sets the end-of-match numbers Result and Stats look at.
+type player struct {
+	id     string
+	hp     int32
+	dealt  int32
+	left   bool
+	diedAt int64
+}
+
+func newTestState(t *testing.T, rules Rules, players []player) *State {
+	t.Helper()
+	ids := make([]string, len(players))
+	for i, p := range players {
+		ids[i] = p.id
+	}
+	s := NewState(ids, rules, 1)
+	for _, p := range players {
+		ps := s.Players[p.id]
+		ps.HP = p.hp
+		ps.DamageDealt = p.dealt
+		ps.Forfeited = p.left
+		ps.DiedAt = p.diedAt
+	}
+	return s
+}
+
+func TestResult(t *testing.T) {
+	timed := DefaultRules(2)
+	timed.TimeLimitTicks = 10
+
+	cases := []struct {
+		name    string
+		rules   Rules
+		tick    int64
+		players []player
+		over    bool
+		want    Result
+	}{
+		{
+			name:    "in progress",
+			rules:   DefaultRules(2),
+			players: []player{{id: "a", hp: 50}, {id: "b", hp: 50}},
+		},
+		{
+			name:    "last player standing",
+			rules:   DefaultRules(3),
+			players: []player{{id: "a", hp: 10}, {id: "b"}, {id: "c"}},
+			over:    true,
+			want:    Result{Outcome: OutcomeWin, Winner: "a", Reason: "last player standing"},
+		},
+		{
+			name:    "opponents left",
+			rules:   DefaultRules(2),
+			players: []player{{id: "a", hp: 10}, {id: "b", left: true}},
+			over:    true,
+			want:    Result{Outcome: OutcomeWin, Winner: "a", Reason: "opponents left"},
+		},
+		{
+			name:    "all left",
+			rules:   DefaultRules(2),
+			players: []player{{id: "a", left: true}, {id: "b", left: true}},
+			over:    true,
+			want:    Result{Outcome: OutcomeAbandoned, Reason: "all players left"},
+		},
+		{
+			name:    "eliminated together is a draw",
+			rules:   DefaultRules(2),
+			players: []player{{id: "a", dealt: 90}, {id: "b", dealt: 30}},
+			over:    true,
+			want:    Result{Outcome: OutcomeDraw, Reason: "eliminated together"},
+		},
+		{
+			name:    "eliminated together after a forfeit",
+			rules:   DefaultRules(3),
+			players: []player{{id: "a", dealt: 90}, {id: "b"}, {id: "c", left: true}},
+			over:    true,
+			want:    Result{Outcome: OutcomeDraw, Reason: "eliminated together"},
+		},
+		{
+			name:    "time limit on HP",
+			rules:   timed,
+			tick:    10,
+			players: []player{{id: "a", hp: 40}, {id: "b", hp: 50}},
+			over:    true,
+			want:    Result{Outcome: OutcomeTimeout, Winner: "b", Reason: "time limit: most HP left"},
+		},
+		{
+			name:    "time limit on damage",
+			rules:   timed,
+			tick:    10,
+			players: []player{{id: "a", hp: 50, dealt: 20}, {id: "b", hp: 50, dealt: 10}},
+			over:    true,
+			want:    Result{Outcome: OutcomeTimeout, Winner: "a", Reason: "time limit: most damage dealt"},
+		},
+		{
+			name:    "time limit tied",
+			rules:   timed,
+			tick:    10,
+			players: []player{{id: "a", hp: 50, dealt: 10}, {id: "b", hp: 50, dealt: 10}},
+			over:    true,
+			want:    Result{Outcome: OutcomeDraw, Reason: "time limit: tied"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestState(t, tc.rules, tc.players)
+			s.Tick = tc.tick
+			got, over := s.Result()
+			if over != tc.over || got != tc.want {
+				t.Fatalf("Result() = %+v, %v; want %+v, %v", got, over, tc.want, tc.over)
+			}
+		})
+	}
+}
+
+func TestPlacements(t *testing.T) {
+	timed := DefaultRules(3)
+	timed.TimeLimitTicks = 10
+
+	cases := []struct {
+		name    string
+		rules   Rules
+		tick    int64
+		players []player
+		// want is every player with their placement, in the order Stats
+		// lists them.
+		want []string
+	}{
+		{
+			name:    "winner, then who lasted longest",
+			rules:   DefaultRules(3),
+			players: []player{{id: "a", diedAt: 20}, {id: "b", diedAt: 30}, {id: "c", hp: 10}},
+			want:    []string{"c:1", "b:2", "a:3"},
+		},
+		{
+			name:    "damage breaks a tie on time alive",
+			rules:   DefaultRules(3),
+			players: []player{{id: "a", diedAt: 20, dealt: 5}, {id: "b", diedAt: 20, dealt: 15}, {id: "c", hp: 10}},
+			want:    []string{"c:1", "b:2", "a:3"},
+		},
+		{
+			name:    "players that cannot be told apart share a placement",
+			rules:   DefaultRules(3),
+			players: []player{{id: "a", diedAt: 20}, {id: "b", diedAt: 20}, {id: "c", hp: 10}},
+			want:    []string{"c:1", "a:2", "b:2"},
+		},
+		{
+			name:    "a forfeit ranks by when they left",
+			rules:   DefaultRules(3),
+			players: []player{{id: "a", left: true, diedAt: 5}, {id: "b", diedAt: 8}, {id: "c", hp: 10}},
+			want:    []string{"c:1", "b:2", "a:3"},
+		},
+		{
+			name:    "eliminated together ranks by damage",
+			rules:   DefaultRules(2),
+			players: []player{{id: "a", diedAt: 30, dealt: 10}, {id: "b", diedAt: 30, dealt: 20}},
+			want:    []string{"b:1", "a:2"},
+		},
+		{
+			name:    "eliminated together and tied",
+			rules:   DefaultRules(2),
+			players: []player{{id: "a", diedAt: 30}, {id: "b", diedAt: 30}},
+			want:    []string{"a:1", "b:1"},
+		},
+		{
+			name:    "time limit on HP",
+			rules:   timed,
+			tick:    10,
+			players: []player{{id: "a", hp: 40, dealt: 50}, {id: "b", hp: 50}, {id: "c", diedAt: 4}},
+			want:    []string{"b:1", "a:2", "c:3"},
+		},
+		{
+			name:    "time limit on damage",
+			rules:   timed,
+			tick:    10,
+			players: []player{{id: "a", hp: 50, dealt: 10}, {id: "b", hp: 50, dealt: 20}, {id: "c", hp: 60}},
+			want:    []string{"c:1", "b:2", "a:3"},
+		},
+		{
+			name:    "time limit tied",
+			rules:   timed,
+			tick:    10,
+			players: []player{{id: "a", hp: 50}, {id: "b", hp: 50}, {id: "c", hp: 20}},
+			want:    []string{"a:1", "b:1", "c:3"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestState(t, tc.rules, tc.players)
+			s.Tick = tc.tick
+			res, over := s.Result()
+			if !over {
+				t.Fatal("match not over")
+			}
+			var got []string
+			for _, st := range s.Stats(res) {
+				got = append(got, fmt.Sprintf("%s:%d", st.PlayerID, st.Placement))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("placements %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	cases := []struct {
+		name string
+		// do plays a match of a at (0, 0) against b at (10, 0).
+		do   func(s *State)
+		want map[string]PlayerStats
+	}{
+		{
+			name: "hit",
+			do: func(s *State) {
+				s.ApplySkill("a", &protocol.SkillCast{SkillId: 1, TargetId: "b"})
+			},
+			want: map[string]PlayerStats{
+				"a": {DamageDealt: 10, SkillsCast: 1, SkillsLanded: 1, TicksAlive: 1},
+				"b": {DamageTaken: 10, TicksAlive: 1},
+			},
+		},
+		{
+			name: "out of range",
+			do: func(s *State) {
+				s.Players["b"].X = 30
+				s.ApplySkill("a", &protocol.SkillCast{SkillId: 1, TargetId: "b"})
+			},
+			want: map[string]PlayerStats{
+				"a": {SkillsCast: 1, TicksAlive: 1},
+				"b": {TicksAlive: 1},
+			},
+		},
+		{
+			name: "shield absorbs",
+			do: func(s *State) {
+				s.Players["b"].Effects = []StatusEffect{{Kind: EffectShield, Ticks: 10, Amount: 4}}
+				s.ApplySkill("a", &protocol.SkillCast{SkillId: 1, TargetId: "b"})
+			},
+			want: map[string]PlayerStats{
+				"a": {DamageDealt: 6, SkillsCast: 1, SkillsLanded: 1, TicksAlive: 1},
+				"b": {DamageTaken: 6, TicksAlive: 1},
+			},
+		},
+		{
+			name: "overkill counts the HP left",
+			do: func(s *State) {
+				s.Players["b"].HP = 4
+				s.ApplySkill("a", &protocol.SkillCast{SkillId: 1, TargetId: "b"})
+			},
+			want: map[string]PlayerStats{
+				"a": {DamageDealt: 4, SkillsCast: 1, SkillsLanded: 1, TicksAlive: 1},
+				"b": {DamageTaken: 4},
+			},
+		},
+		{
+			name: "moved",
+			do: func(s *State) {
+				s.ApplyInput("a", &protocol.PlayerInput{Dx: -3, Dy: 4})
+			},
+			want: map[string]PlayerStats{
+				"a": {Distance: 5, TicksAlive: 1},
+				"b": {TicksAlive: 1},
+			},
+		},
+		{
+			name: "forfeit",
+			do: func(s *State) {
+				s.TickForward()
+				s.Forfeit("b")
+			},
+			want: map[string]PlayerStats{
+				"a": {TicksAlive: 2},
+				"b": {TicksAlive: 1, Forfeited: true},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewState([]string{"a", "b"}, DefaultRules(2), 1)
+			s.Players["a"].X, s.Players["a"].Y = 0, 0
+			s.Players["b"].X, s.Players["b"].Y = 10, 0
+			tc.do(s)
+			s.TickForward()
+
+			res, _ := s.Result()
+			for _, st := range s.Stats(res) {
+				// Placements are covered by TestPlacements.
+				want := tc.want[st.PlayerID]
+				want.PlayerID, want.Placement = st.PlayerID, st.Placement
+				if st != want {
+					t.Fatalf("stats %+v, want %+v", st, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package battle
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"miniarena/pkg/protocol"
+)
+
+// EffectKind is what a status effect does. The values match
+// protocol.StatusKind.
+type EffectKind int
+
+const (
+	// EffectStun blocks movement and casting, and interrupts a cast in
+	// progress.
+	EffectStun EffectKind = iota
+	// EffectSlow takes a fraction of the player's movement away.
+	EffectSlow
+	// EffectDoT deals damage every Period ticks.
+	EffectDoT
+	// EffectShield absorbs damage until it is used up or expires.
+	EffectShield
+)
+
+func (k EffectKind) String() string {
+	switch k {
+	case EffectStun:
+		return "stun"
+	case EffectSlow:
+		return "slow"
+	case EffectDoT:
+		return "dot"
+	case EffectShield:
+		return "shield"
+	default:
+		return fmt.Sprintf("effect(%d)", int(k))
+	}
+}
+
+func parseEffectKind(s string) (EffectKind, error) {
+	for _, k := range []EffectKind{EffectStun, EffectSlow, EffectDoT, EffectShield} {
+		if k.String() == s {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown effect %q", s)
+}
+
+// harmful reports whether the effect hinders whoever it lands on.
+func (k EffectKind) harmful() bool {
+	return k != EffectShield
+}
+
+// EffectSpec is an effect a skill applies when it lands. Times are in
+// ticks.
+type EffectSpec struct {
+	Kind     EffectKind
+	Duration int32
+	// Amount is the damage per pulse of a DoT or how much a shield
+	// absorbs.
+	Amount int32
+	// Slow is the fraction of movement a slow takes away, up to 1.
+	Slow float32
+	// Period is the ticks between DoT pulses.
+	Period int32
+	// MaxStacks above 1 lets the effect stack that many times from the
+	// same skill; otherwise a new application replaces the old one.
+	MaxStacks int
+}
+
+func (e EffectSpec) validate() error {
+	switch {
+	case e.Duration <= 0:
+		return errors.New("duration must be positive")
+	case e.MaxStacks < 0:
+		return errors.New("negative max_stacks")
+	case e.Kind == EffectSlow && (e.Slow <= 0 || e.Slow > 1):
+		return errors.New("slow must be above 0 and at most 1")
+	case e.Kind == EffectDoT && (e.Amount <= 0 || e.Period <= 0):
+		return errors.New("dot needs a positive amount and period")
+	case e.Kind == EffectShield && e.Amount <= 0:
+		return errors.New("shield needs a positive amount")
+	}
+	return nil
+}
+
+// StatusEffect is an effect on a player.
+type StatusEffect struct {
+	Kind    EffectKind
+	SkillID int32
+	// Source is the player whose skill applied it; DoT damage is credited
+	// to them.
+	Source string
+	// Ticks is how long it has left; Elapsed how long it has run.
+	Ticks   int32
+	Elapsed int32
+	Amount  int32
+	Slow    float32
+	Period  int32
+}
+
+type effectJSON struct {
+	Kind       string  `json:"kind"`
+	DurationMs int     `json:"duration_ms"`
+	Amount     int32   `json:"amount"`
+	Slow       float32 `json:"slow"`
+	PeriodMs   int     `json:"period_ms"`
+	MaxStacks  int     `json:"max_stacks"`
+}
+
+func parseEffects(in []effectJSON, tick time.Duration) ([]EffectSpec, error) {
+	var out []EffectSpec
+	for _, j := range in {
+		kind, err := parseEffectKind(j.Kind)
+		if err != nil {
+			return nil, err
+		}
+		e := EffectSpec{
+			Kind:      kind,
+			Duration:  msToTicks(j.DurationMs, tick),
+			Amount:    j.Amount,
+			Slow:      j.Slow,
+			Period:    msToTicks(j.PeriodMs, tick),
+			MaxStacks: j.MaxStacks,
+		}
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", kind, err)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// applyEffect puts an effect from sk on the target. Effects of the same kind
+// from the same skill refresh each other unless the spec allows stacks; once
+// the stacks are full the one closest to running out is replaced.
+func (s *State) applyEffect(source *PlayerState, sk Skill, spec EffectSpec, target *PlayerState) {
+	e := StatusEffect{
+		Kind:    spec.Kind,
+		SkillID: sk.ID,
+		Source:  source.ID,
+		Ticks:   spec.Duration,
+		Amount:  spec.Amount,
+		Slow:    spec.Slow,
+		Period:  spec.Period,
+	}
+	if spec.Kind == EffectStun {
+		target.Casting, target.CastTarget, target.CastEnds = 0, "", 0
+	}
+
+	stacks, oldest := 0, -1
+	for i, cur := range target.Effects {
+		if cur.Kind != spec.Kind || cur.SkillID != sk.ID {
+			continue
+		}
+		stacks++
+		if oldest < 0 || cur.Ticks < target.Effects[oldest].Ticks {
+			oldest = i
+		}
+	}
+	if stacks > 0 && stacks >= max(spec.MaxStacks, 1) {
+		target.Effects[oldest] = e
+		return
+	}
+	target.Effects = append(target.Effects, e)
+}
+
+// tickEffects runs one tick of every effect on p: DoTs pulse and expired
+// effects and spent shields are dropped.
+func (s *State) tickEffects(p *PlayerState) {
+	if len(p.Effects) == 0 {
+		return
+	}
+	for i := range p.Effects {
+		e := &p.Effects[i]
+		e.Ticks--
+		e.Elapsed++
+		if e.Kind == EffectDoT && e.Elapsed%e.Period == 0 {
+			s.dealDamage(s.Players[e.Source], p, e.Amount)
+		}
+	}
+	// Pulses may have used up shields, so expired effects are dropped only
+	// once they have all run.
+	live := p.Effects[:0]
+	for _, e := range p.Effects {
+		if e.Ticks > 0 && (e.Kind != EffectShield || e.Amount > 0) {
+			live = append(live, e)
+		}
+	}
+	if len(live) == 0 {
+		// Keep the state equal to its gob round trip, which replays and
+		// checkpoints go through.
+		live = nil
+	}
+	p.Effects = live
+}
+
+// stunned reports whether a stun is on the player.
+func (p *PlayerState) stunned() bool {
+	for _, e := range p.Effects {
+		if e.Kind == EffectStun {
+			return true
+		}
+	}
+	return false
+}
+
+// moveLimit is how far the player may move this tick; the strongest slow
+// applies.
+func (p *PlayerState) moveLimit(g geometry) float32 {
+	var slow float32
+	for _, e := range p.Effects {
+		if e.Kind == EffectSlow && e.Slow > slow {
+			slow = e.Slow
+		}
+	}
+	return g.slowed(slow)
+}
+
+// absorb takes damage off the player's shields, oldest first, and returns
+// what gets through.
+func (p *PlayerState) absorb(dmg int32) int32 {
+	for i := range p.Effects {
+		e := &p.Effects[i]
+		if e.Kind != EffectShield || e.Amount <= 0 {
+			continue
+		}
+		took := min(dmg, e.Amount)
+		e.Amount -= took
+		dmg -= took
+		if dmg == 0 {
+			break
+		}
+	}
+	return dmg
+}
+
+func effectSnapshots(p *PlayerState) []*protocol.StatusEffect {
+	if len(p.Effects) == 0 {
+		return nil
+	}
+	out := make([]*protocol.StatusEffect, 0, len(p.Effects))
+	for _, e := range p.Effects {
+		out = append(out, &protocol.StatusEffect{
+			Kind:     protocol.StatusKind(e.Kind),
+			SkillId:  e.SkillID,
+			SourceId: e.Source,
+			Ticks:    e.Ticks,
+			Amount:   e.Amount,
+			Slow:     e.Slow,
+		})
+	}
+	return out
+}
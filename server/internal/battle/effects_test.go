@@ -0,0 +1,194 @@
+package battle
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"miniarena/pkg/protocol"
+)
+
+func TestEffects(t *testing.T) {
+	const (
+		bash    = 1 // stun for 3 ticks
+		frost   = 2 // slow by half for 4 ticks
+		chill   = 3 // slow by 0.8 for 2 ticks
+		poison  = 4 // 2 damage every 2 ticks for 6 ticks, up to 2 stacks
+		burn    = 5 // 3 damage every tick for 3 ticks, refreshes
+		barrier = 6 // self shield of 15 for 5 ticks
+		strike  = 7 // 10 damage
+		snipe   = 8 // 25 damage after 3 ticks
+	)
+	skills := []Skill{
+		{ID: bash, Range: 20, Target: TargetEnemy, Effects: []EffectSpec{{Kind: EffectStun, Duration: 3}}},
+		{ID: frost, Range: 20, Target: TargetEnemy, Effects: []EffectSpec{{Kind: EffectSlow, Duration: 4, Slow: 0.5}}},
+		{ID: chill, Range: 20, Target: TargetEnemy, Effects: []EffectSpec{{Kind: EffectSlow, Duration: 2, Slow: 0.8}}},
+		{ID: poison, Range: 20, Target: TargetEnemy, Effects: []EffectSpec{{Kind: EffectDoT, Duration: 6, Amount: 2, Period: 2, MaxStacks: 2}}},
+		{ID: burn, Range: 20, Target: TargetEnemy, Effects: []EffectSpec{{Kind: EffectDoT, Duration: 3, Amount: 3, Period: 1}}},
+		{ID: barrier, Target: TargetSelf, Effects: []EffectSpec{{Kind: EffectShield, Duration: 5, Amount: 15}}},
+		{ID: strike, Damage: 10, Range: 20, Target: TargetEnemy},
+		{ID: snipe, Damage: 25, Range: 60, CastTime: 3, Target: TargetEnemy},
+	}
+	cast := func(s *State, caster string, skill int32) {
+		target := "b"
+		if caster == "b" {
+			target = "a"
+		}
+		s.ApplySkill(caster, &protocol.SkillCast{SkillId: skill, TargetId: target})
+	}
+	ticks := func(s *State, n int) {
+		for i := 0; i < n; i++ {
+			s.TickForward()
+		}
+	}
+	move := func(s *State) { s.ApplyInput("b", &protocol.PlayerInput{Dx: MaxMovePerTick}) }
+
+	cases := []struct {
+		name string
+		// do plays with a at (0, 0) and b at (10, 0). Skills have no
+		// cooldown.
+		do func(s *State)
+		// lost is the HP each player lost.
+		lost map[string]int32
+		// moved is how far b moved.
+		moved float32
+		// effects are b's, as "kind:skill:ticks:amount".
+		effects []string
+	}{
+		{
+			name:    "stun blocks movement",
+			do:      func(s *State) { cast(s, "a", bash); move(s) },
+			effects: []string{"stun:1:3:0"},
+		},
+		{
+			name:    "stun blocks casting",
+			do:      func(s *State) { cast(s, "a", bash); cast(s, "b", strike) },
+			effects: []string{"stun:1:3:0"},
+		},
+		{
+			name: "stun interrupts a cast",
+			do:   func(s *State) { cast(s, "b", snipe); cast(s, "a", bash); ticks(s, 3) },
+		},
+		{
+			name:  "stun wears off",
+			do:    func(s *State) { cast(s, "a", bash); ticks(s, 3); move(s) },
+			moved: MaxMovePerTick,
+		},
+		{
+			name:    "stun refreshes",
+			do:      func(s *State) { cast(s, "a", bash); ticks(s, 2); cast(s, "a", bash) },
+			effects: []string{"stun:1:3:0"},
+		},
+		{
+			name:    "slow scales the move cap",
+			do:      func(s *State) { cast(s, "a", frost); move(s) },
+			moved:   MaxMovePerTick * 0.5,
+			effects: []string{"slow:2:4:0"},
+		},
+		{
+			name:    "strongest slow applies",
+			do:      func(s *State) { cast(s, "a", frost); cast(s, "a", chill); move(s) },
+			moved:   MaxMovePerTick * 0.2,
+			effects: []string{"slow:2:4:0", "slow:3:2:0"},
+		},
+		{
+			name:    "weaker slow outlasts a stronger one",
+			do:      func(s *State) { cast(s, "a", frost); cast(s, "a", chill); ticks(s, 2); move(s) },
+			moved:   MaxMovePerTick * 0.5,
+			effects: []string{"slow:2:2:0"},
+		},
+		{
+			name:  "slow wears off",
+			do:    func(s *State) { cast(s, "a", frost); ticks(s, 4); move(s) },
+			moved: MaxMovePerTick,
+		},
+		{
+			name:    "dot pulses every period",
+			do:      func(s *State) { cast(s, "a", poison); ticks(s, 5) },
+			lost:    map[string]int32{"b": 4},
+			effects: []string{"dot:4:1:2"},
+		},
+		{
+			name: "dot expires after its last pulse",
+			do:   func(s *State) { cast(s, "a", poison); ticks(s, 10) },
+			lost: map[string]int32{"b": 6},
+		},
+		{
+			name:    "dot stacks up to its max",
+			do:      func(s *State) { cast(s, "a", poison); cast(s, "a", poison); cast(s, "a", poison); ticks(s, 2) },
+			lost:    map[string]int32{"b": 4},
+			effects: []string{"dot:4:4:2", "dot:4:4:2"},
+		},
+		{
+			name: "full stacks replace the one closest to running out",
+			do: func(s *State) {
+				cast(s, "a", poison)
+				ticks(s, 2)
+				cast(s, "a", poison)
+				ticks(s, 1)
+				cast(s, "a", poison)
+			},
+			lost:    map[string]int32{"b": 2},
+			effects: []string{"dot:4:6:2", "dot:4:5:2"},
+		},
+		{
+			name:    "dot without stacks refreshes",
+			do:      func(s *State) { cast(s, "a", burn); ticks(s, 2); cast(s, "a", burn); ticks(s, 1) },
+			lost:    map[string]int32{"b": 9},
+			effects: []string{"dot:5:2:3"},
+		},
+		{
+			name:    "shield absorbs",
+			do:      func(s *State) { cast(s, "b", barrier); cast(s, "a", strike) },
+			effects: []string{"shield:6:5:5"},
+		},
+		{
+			name: "shield overflow gets through",
+			do: func(s *State) {
+				cast(s, "b", barrier)
+				cast(s, "a", strike)
+				cast(s, "a", strike)
+				ticks(s, 1)
+			},
+			lost: map[string]int32{"b": 5},
+		},
+		{
+			name:    "shield absorbs a dot",
+			do:      func(s *State) { cast(s, "b", barrier); cast(s, "a", burn); ticks(s, 1) },
+			effects: []string{"shield:6:4:12", "dot:5:2:3"},
+		},
+		{
+			name: "shield expires",
+			do:   func(s *State) { cast(s, "b", barrier); ticks(s, 5); cast(s, "a", strike) },
+			lost: map[string]int32{"b": 10},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules := DefaultRules(2)
+			rules.Skills = skills
+			s := NewState([]string{"a", "b"}, rules, 1)
+			s.Players["a"].X, s.Players["a"].Y = 0, 0
+			s.Players["b"].X, s.Players["b"].Y = 10, 0
+
+			tc.do(s)
+
+			for id, p := range s.Players {
+				if lost := rules.MaxHP - p.HP; lost != tc.lost[id] {
+					t.Fatalf("%s lost %d HP, want %d", id, lost, tc.lost[id])
+				}
+			}
+			if moved := s.Players["b"].X - 10; math.Abs(float64(moved-tc.moved)) > 1e-4 {
+				t.Fatalf("b moved %v, want %v", moved, tc.moved)
+			}
+			var effects []string
+			for _, e := range s.Players["b"].Effects {
+				effects = append(effects, fmt.Sprintf("%s:%d:%d:%d", e.Kind, e.SkillID, e.Ticks, e.Amount))
+			}
+			if !reflect.DeepEqual(effects, tc.effects) {
+				t.Fatalf("b's effects %v, want %v", effects, tc.effects)
+			}
+		})
+	}
+}
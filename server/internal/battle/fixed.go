@@ -0,0 +1,152 @@
+package battle
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Fixed is a Q47.16 fixed-point number: the arena math fixed-point matches
+// are simulated with. Integer arithmetic gives the same bits on every
+// platform, which float math does not promise: Go may fuse a multiply and an
+// add into one instruction on some architectures and not on others.
+type Fixed int64
+
+const (
+	fixedShift       = 16
+	fixedOne   Fixed = 1 << fixedShift
+	// gridShift is the precision positions and velocities are kept at
+	// between ticks, 1/256 of a unit. float32 holds every point of that
+	// grid exactly within ±65536 units, so state can stay float32 without
+	// losing anything.
+	gridShift = 8
+	// maxCoord bounds map coordinates so squared distances fit in an
+	// int64.
+	maxCoord = 10000
+)
+
+func toFixed(v float64) Fixed { return Fixed(math.Round(v * float64(fixedOne))) }
+
+func fx(v float32) Fixed { return toFixed(float64(v)) }
+
+func (f Fixed) float() float64 { return float64(f) / float64(fixedOne) }
+
+// grid rounds f to the nearest grid point.
+func (f Fixed) grid() float32 {
+	const half = 1 << (fixedShift - gridShift - 1)
+	g := (f + half) >> (fixedShift - gridShift) << (fixedShift - gridShift)
+	return float32(g.float())
+}
+
+func fmul(a, b Fixed) Fixed { return a * b >> fixedShift }
+
+func fdiv(a, b Fixed) Fixed { return a << fixedShift / b }
+
+// fhypot returns the length of (dx, dy).
+func fhypot(dx, dy Fixed) Fixed {
+	return Fixed(isqrt(uint64(dx*dx + dy*dy)))
+}
+
+// fratio returns num/den for 0 <= num <= den, where both are products of two
+// Fixed values.
+func fratio(num, den int64) Fixed {
+	hi, lo := bits.Mul64(uint64(num), uint64(fixedOne))
+	q, _ := bits.Div64(hi, lo, uint64(den))
+	return Fixed(q)
+}
+
+func isqrt(n uint64) uint64 {
+	var r uint64
+	bit := uint64(1) << 62
+	for bit > n {
+		bit >>= 2
+	}
+	for bit != 0 {
+		if n >= r+bit {
+			n -= r + bit
+			r = r>>1 + bit
+		} else {
+			r >>= 1
+		}
+		bit >>= 2
+	}
+	return r
+}
+
+// fixedGeom does the arena math in Fixed. Results come back as float32 on
+// the grid, or as float64 holding a Fixed value exactly.
+type fixedGeom struct{}
+
+func (fixedGeom) dist(x1, y1, x2, y2 float32) float64 {
+	return fhypot(fx(x2)-fx(x1), fx(y2)-fx(y1)).float()
+}
+
+func (fixedGeom) cross(px1, py1, px2, py2, qx1, qy1, qx2, qy2 float32) (float64, bool) {
+	rx, ry := int64(fx(px2)-fx(px1)), int64(fx(py2)-fx(py1))
+	sx, sy := int64(fx(qx2)-fx(qx1)), int64(fx(qy2)-fx(qy1))
+	wx, wy := int64(fx(qx1)-fx(px1)), int64(fx(qy1)-fx(py1))
+	denom := rx*sy - ry*sx
+	if denom == 0 {
+		if wx*ry-wy*rx != 0 {
+			return 0, false
+		}
+		l := rx*rx + ry*ry
+		if l == 0 {
+			return 0, false
+		}
+		a0 := wx*rx + wy*ry
+		a1 := a0 + sx*rx + sy*ry
+		lo, hi := min(a0, a1), max(a0, a1)
+		if hi < 0 || lo > l {
+			return 0, false
+		}
+		return fratio(max(lo, 0), l).float(), true
+	}
+	tn := wx*sy - wy*sx
+	un := wx*ry - wy*rx
+	if denom < 0 {
+		denom, tn, un = -denom, -tn, -un
+	}
+	if tn < 0 || tn > denom || un < 0 || un > denom {
+		return 0, false
+	}
+	return fratio(tn, denom).float(), true
+}
+
+func (fixedGeom) approach(x1, y1, x2, y2, px, py float32) float64 {
+	dx, dy := int64(fx(x2)-fx(x1)), int64(fx(y2)-fx(y1))
+	l := dx*dx + dy*dy
+	n := int64(fx(px)-fx(x1))*dx + int64(fx(py)-fx(y1))*dy
+	switch {
+	case l == 0 || n <= 0:
+		return 0
+	case n >= l:
+		return 1
+	}
+	return fratio(n, l).float()
+}
+
+func (fixedGeom) along(a, b float32, t float64) float32 {
+	return (fx(a) + fmul(toFixed(t), fx(b)-fx(a))).grid()
+}
+
+func (g fixedGeom) stopShort(x1, y1, x2, y2 float32, t float64) (float32, float32) {
+	dx, dy := fx(x2)-fx(x1), fx(y2)-fx(y1)
+	l := fhypot(dx, dy)
+	if l == 0 {
+		return x1, y1
+	}
+	back := max(0, toFixed(t)-fdiv(toFixed(wallMargin), l)).float()
+	return g.along(x1, x2, back), g.along(y1, y2, back)
+}
+
+func (fixedGeom) heading(dx, dy float32, speed float64) (float32, float32) {
+	x, y, v := fx(dx), fx(dy), toFixed(speed)
+	l := fhypot(x, y)
+	return fdiv(fmul(x, v), l).grid(), fdiv(fmul(y, v), l).grid()
+}
+
+func (fixedGeom) slowed(slow float32) float32 {
+	return fmul(toFixed(MaxMovePerTick), fixedOne-fx(slow)).grid()
+}
+
+func (fixedGeom) snap(v float32) float32 { return fx(v).grid() }
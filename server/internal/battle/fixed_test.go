@@ -0,0 +1,109 @@
+package battle
+
+import (
+	"testing"
+
+	"miniarena/pkg/protocol"
+)
+
+func TestFixedGridSnap(t *testing.T) {
+	cases := []struct {
+		in   float32
+		want float32
+	}{
+		{in: 0, want: 0},
+		{in: 1, want: 1},
+		{in: 0.1, want: 26.0 / 256},
+		{in: -0.1, want: -26.0 / 256},
+		{in: 1.0 / 512, want: 1.0 / 256}, // halves round up
+		{in: -1.0 / 512, want: 0},
+		{in: 0.99 / 512, want: 0},
+		{in: 1234.5678, want: 316049.0 / 256},
+		{in: -maxCoord, want: -maxCoord},
+	}
+	for _, tc := range cases {
+		if got := (fixedGeom{}).snap(tc.in); got != tc.want {
+			t.Errorf("snap(%v) = %v, want %v", tc.in, got, tc.want)
+		}
+		// Grid points are kept as they are.
+		if got := (fixedGeom{}).snap(tc.want); got != tc.want {
+			t.Errorf("snap(%v) moved a grid point to %v", tc.want, got)
+		}
+	}
+}
+
+// play runs a scripted match: the players walk toward each other and strike
+// every tick. It returns the state after the given number of ticks.
+func play(rules Rules, seed int64, ticks int) *State {
+	s := NewState([]string{"a", "b", "c"}, rules, seed)
+	for s.Tick < int64(ticks) {
+		for i, id := range []string{"a", "b", "c"} {
+			p := s.Players[id]
+			s.ApplyInput(id, &protocol.PlayerInput{Dx: -p.X / 7.3, Dy: -p.Y/9.1 + float32(i)*0.37})
+			s.ApplySkill(id, &protocol.SkillCast{SkillId: 1, TargetId: []string{"b", "c", "a"}[i]})
+		}
+		s.TickForward()
+	}
+	return s
+}
+
+func TestHashReproducible(t *testing.T) {
+	fixed := DefaultRules(3)
+	fixed.FixedPoint = true
+	cases := []struct {
+		name  string
+		rules Rules
+	}{
+		{name: "float", rules: DefaultRules(3)},
+		{name: "fixed point", rules: fixed},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			first, second := play(tc.rules, 7, 200), play(tc.rules, 7, 200)
+			if first.Hash() != second.Hash() {
+				t.Fatalf("same seed and inputs gave hashes %016x and %016x", first.Hash(), second.Hash())
+			}
+			if first.Players["a"].HP == tc.rules.MaxHP && first.Players["b"].HP == tc.rules.MaxHP {
+				t.Fatal("scripted match dealt no damage")
+			}
+			if first.Hash() == play(tc.rules, 7, 199).Hash() {
+				t.Fatal("hash did not change over a tick")
+			}
+		})
+	}
+}
+
+func TestSpawnOrder(t *testing.T) {
+	spawns := func(rules Rules, seed int64) [3][2]float32 {
+		s := NewState([]string{"a", "b", "c"}, rules, seed)
+		var out [3][2]float32
+		for i, id := range []string{"a", "b", "c"} {
+			out[i] = [2]float32{s.Players[id].X, s.Players[id].Y}
+		}
+		return out
+	}
+	fixed := DefaultRules(3)
+	fixed.FixedPoint = true
+	cases := []struct {
+		name   string
+		rules  Rules
+		seeded bool
+	}{
+		{name: "float keeps seat order", rules: DefaultRules(3)},
+		{name: "fixed point draws from the seed", rules: fixed, seeded: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			first := spawns(tc.rules, 1)
+			differ := false
+			for seed := int64(2); seed < 20; seed++ {
+				if spawns(tc.rules, seed) != first {
+					differ = true
+				}
+			}
+			if differ != tc.seeded {
+				t.Fatalf("spawns depend on the seed = %v, want %v", differ, tc.seeded)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package battle
+
+import "math"
+
+// geometry is the arena math whose results could differ between platforms.
+// Every step of the simulation that depends on it goes through s.geom(), so
+// fixed-point matches swap in integer math in one place.
+type geometry interface {
+	// dist is the distance between two points.
+	dist(x1, y1, x2, y2 float32) float64
+	// cross reports whether segment p1-p2 touches segment q1-q2 and where
+	// along p1-p2 it does, from 0 to 1.
+	cross(px1, py1, px2, py2, qx1, qy1, qx2, qy2 float32) (float64, bool)
+	// approach is how far along the segment (x1, y1)-(x2, y2), from 0 to 1,
+	// it passes closest to (px, py).
+	approach(x1, y1, x2, y2, px, py float32) float64
+	// along is the point t of the way from a to b.
+	along(a, b float32, t float64) float32
+	// stopShort is the point wallMargin short of t of the way from
+	// (x1, y1) to (x2, y2), but no further back than the start.
+	stopShort(x1, y1, x2, y2 float32, t float64) (float32, float32)
+	// heading scales the direction (dx, dy) to length speed.
+	heading(dx, dy float32, speed float64) (float32, float32)
+	// slowed is MaxMovePerTick with a slow taken off.
+	slowed(slow float32) float32
+	// snap rounds an input to the precision state is kept at.
+	snap(v float32) float32
+}
+
+func (s *State) geom() geometry {
+	if s.Rules.FixedPoint {
+		return fixedGeom{}
+	}
+	return floatGeom{}
+}
+
+// floatGeom is the default float math.
+type floatGeom struct{}
+
+func (floatGeom) dist(x1, y1, x2, y2 float32) float64 { return distance(x1, y1, x2, y2) }
+
+func (floatGeom) cross(px1, py1, px2, py2, qx1, qy1, qx2, qy2 float32) (float64, bool) {
+	return segmentsCross(px1, py1, px2, py2, qx1, qy1, qx2, qy2)
+}
+
+func (floatGeom) approach(x1, y1, x2, y2, px, py float32) float64 {
+	return closestApproach(x1, y1, x2, y2, px, py)
+}
+
+func (floatGeom) along(a, b float32, t float64) float32 { return a + float32(t)*(b-a) }
+
+func (g floatGeom) stopShort(x1, y1, x2, y2 float32, t float64) (float32, float32) {
+	l := distance(x1, y1, x2, y2)
+	if l == 0 {
+		return x1, y1
+	}
+	t = math.Max(0, t-wallMargin/l)
+	return g.along(x1, x2, t), g.along(y1, y2, t)
+}
+
+func (floatGeom) heading(dx, dy float32, speed float64) (float32, float32) {
+	d := distance(0, 0, dx, dy)
+	return float32(float64(dx) / d * speed), float32(float64(dy) / d * speed)
+}
+
+func (floatGeom) slowed(slow float32) float32 { return MaxMovePerTick * (1 - slow) }
+
+func (floatGeom) snap(v float32) float32 { return v }
@@ -0,0 +1,94 @@
+package battle
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+)
+
+// Hash returns an FNV-1a hash of everything the simulation carries from one
+// tick to the next. Two runs of a fixed-point match that agree on the hash
+// at a tick have not diverged up to it. Rules are left out since they never
+// change during a match.
+func (s *State) Hash() uint64 {
+	h := stateHasher{h: fnv.New64a()}
+	h.int(s.Tick)
+	h.uint(s.RNG)
+	h.int(s.NextProjectileID)
+	players := s.sortedPlayers()
+	h.int(int64(len(players)))
+	for _, p := range players {
+		h.str(p.ID)
+		h.int(int64(p.Team))
+		h.float(p.X)
+		h.float(p.Y)
+		h.int(int64(p.HP))
+		h.int(int64(p.DamageDealt))
+		h.bool(p.Forfeited)
+		h.int(int64(len(p.Cooldowns)))
+		for _, cd := range p.Cooldowns {
+			h.int(int64(cd))
+		}
+		h.int(int64(p.Casting))
+		h.str(p.CastTarget)
+		h.int(p.CastEnds)
+		h.int(int64(len(p.Effects)))
+		for _, e := range p.Effects {
+			h.int(int64(e.Kind))
+			h.int(int64(e.SkillID))
+			h.str(e.Source)
+			h.int(int64(e.Ticks))
+			h.int(int64(e.Elapsed))
+			h.int(int64(e.Amount))
+			h.float(e.Slow)
+			h.int(int64(e.Period))
+		}
+		h.int(int64(p.DamageTaken))
+		h.int(int64(p.SkillsCast))
+		h.int(int64(p.SkillsLanded))
+		h.float(p.Moved)
+		h.int(p.DiedAt)
+	}
+	h.int(int64(len(s.Projectiles)))
+	for _, pr := range s.Projectiles {
+		h.int(pr.ID)
+		h.str(pr.Owner)
+		h.int(int64(pr.SkillID))
+		h.float(pr.X)
+		h.float(pr.Y)
+		h.float(pr.VX)
+		h.float(pr.VY)
+		h.float(pr.Radius)
+		h.int(int64(pr.TTL))
+	}
+	return h.h.Sum64()
+}
+
+type stateHasher struct {
+	h   hash.Hash64
+	buf [8]byte
+}
+
+func (h *stateHasher) uint(v uint64) {
+	binary.LittleEndian.PutUint64(h.buf[:], v)
+	h.h.Write(h.buf[:])
+}
+
+func (h *stateHasher) int(v int64) { h.uint(uint64(v)) }
+
+func (h *stateHasher) float(v float32) { h.uint(uint64(math.Float32bits(v))) }
+
+func (h *stateHasher) bool(v bool) {
+	if v {
+		h.uint(1)
+	} else {
+		h.uint(0)
+	}
+}
+
+// str writes the length first so adjacent strings cannot run together.
+func (h *stateHasher) str(v string) {
+	h.int(int64(len(v)))
+	h.h.Write([]byte(v))
+}
@@ -0,0 +1,134 @@
+package battle
+
+import (
+	"math"
+
+	"miniarena/pkg/protocol"
+)
+
+// Projectile is a skill shot in flight. It moves by its velocity every tick
+// and hits the first player other than its owner that comes within Radius of
+// its path.
+type Projectile struct {
+	ID      int64
+	Owner   string
+	SkillID int32
+	X, Y    float32
+	// VX and VY are in arena units per tick.
+	VX, VY float32
+	Radius float32
+	// TTL is how many more ticks it flies before it expires.
+	TTL int32
+}
+
+// launch fires sk from the caster toward where the target stands now. A
+// target already inside the hit radius is hit on the spot.
+func (s *State) launch(caster *PlayerState, sk Skill, target *PlayerState) {
+	g := s.geom()
+	if g.dist(caster.X, caster.Y, target.X, target.Y) <= sk.Radius {
+		s.hit(caster, sk, target)
+		return
+	}
+	vx, vy := g.heading(target.X-caster.X, target.Y-caster.Y, sk.Speed)
+	s.NextProjectileID++
+	s.Projectiles = append(s.Projectiles, &Projectile{
+		ID:      s.NextProjectileID,
+		Owner:   caster.ID,
+		SkillID: sk.ID,
+		X:       caster.X,
+		Y:       caster.Y,
+		VX:      vx,
+		VY:      vy,
+		Radius:  float32(sk.Radius),
+		TTL:     int32(math.Ceil(sk.Range / sk.Speed)),
+	})
+}
+
+// advanceProjectiles moves every projectile one tick in launch order,
+// resolving hits along the way. Projectiles that hit a player or an
+// obstacle, run out of range or leave the arena are removed.
+func (s *State) advanceProjectiles() {
+	if len(s.Projectiles) == 0 {
+		return
+	}
+	targets := s.sortedPlayers()
+	arena := s.arena()
+	g := s.geom()
+
+	live := s.Projectiles[:0]
+	for _, pr := range s.Projectiles {
+		x, y := pr.X+pr.VX, pr.Y+pr.VY
+		wall, blocked := arena.blockedAt(g, pr.X, pr.Y, x, y)
+		if victim, at := s.sweep(g, pr, x, y, targets); victim != nil && (!blocked || at <= wall) {
+			owner := s.Players[pr.Owner]
+			_, sk, ok := s.Rules.Skill(pr.SkillID)
+			if owner != nil && ok {
+				s.hit(owner, sk, victim)
+			}
+			continue
+		}
+		pr.X, pr.Y = x, y
+		pr.TTL--
+		if blocked || pr.TTL <= 0 || !arena.inBounds(x, y) {
+			continue
+		}
+		live = append(live, pr)
+	}
+	for i := len(live); i < len(s.Projectiles); i++ {
+		s.Projectiles[i] = nil
+	}
+	s.Projectiles = live
+}
+
+// sweep returns the living player the projectile reaches first on its way
+// to (x, y) and how far along the way that is. Players hit at the same point
+// are taken in ID order. Without friendly fire it flies through the owner's
+// teammates.
+func (s *State) sweep(g geometry, pr *Projectile, x, y float32, targets []*PlayerState) (*PlayerState, float64) {
+	var victim *PlayerState
+	first := math.Inf(1)
+	owner := s.Players[pr.Owner]
+	for _, p := range targets {
+		if p.ID == pr.Owner || p.HP <= 0 || (owner != nil && s.spares(owner, p)) {
+			continue
+		}
+		t := g.approach(pr.X, pr.Y, x, y, p.X, p.Y)
+		cx, cy := g.along(pr.X, x, t), g.along(pr.Y, y, t)
+		if g.dist(cx, cy, p.X, p.Y) <= float64(pr.Radius) && t < first {
+			victim, first = p, t
+		}
+	}
+	return victim, first
+}
+
+// closestApproach returns how far along the segment (x1, y1)-(x2, y2), from
+// 0 to 1, it passes closest to (px, py).
+func closestApproach(x1, y1, x2, y2, px, py float32) float64 {
+	dx, dy := float64(x2-x1), float64(y2-y1)
+	l := dx*dx + dy*dy
+	if l == 0 {
+		return 0
+	}
+	t := (float64(px-x1)*dx + float64(py-y1)*dy) / l
+	return math.Max(0, math.Min(1, t))
+}
+
+func (s *State) projectileSnapshots() []*protocol.ProjectileSnapshot {
+	if len(s.Projectiles) == 0 {
+		return nil
+	}
+	out := make([]*protocol.ProjectileSnapshot, 0, len(s.Projectiles))
+	for _, pr := range s.Projectiles {
+		out = append(out, &protocol.ProjectileSnapshot{
+			Id:      pr.ID,
+			OwnerId: pr.Owner,
+			SkillId: pr.SkillID,
+			X:       pr.X,
+			Y:       pr.Y,
+			Vx:      pr.VX,
+			Vy:      pr.VY,
+			Radius:  pr.Radius,
+		})
+	}
+	return out
+}
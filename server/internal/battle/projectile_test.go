@@ -0,0 +1,198 @@
+package battle
+
+import (
+	"reflect"
+	"testing"
+
+	"miniarena/pkg/protocol"
+)
+
+// rect is an axis-aligned obstacle.
+func rect(minX, minY, maxX, maxY float32) Obstacle {
+	return Obstacle{Points: []Point{{minX, minY}, {maxX, minY}, {maxX, maxY}, {minX, maxY}}}
+}
+
+// testMap is the default arena with obstacles in it.
+func testMap(obstacles ...Obstacle) Map {
+	m := DefaultMap()
+	m.ID = "test"
+	m.Obstacles = obstacles
+	return m
+}
+
+// bolt flies 10 units a tick for 6 ticks.
+var bolt = Skill{ID: 1, Damage: 10, Range: 60, Speed: 10, Radius: 2, Target: TargetEnemy}
+
+// newProjectileState puts a at (0, 0), b where given and c out of the way.
+func newProjectileState(t *testing.T, rules Rules, b Point) *State {
+	t.Helper()
+	rules.Skills = []Skill{bolt}
+	s := NewState([]string{"a", "b", "c"}, rules, 1)
+	s.Players["a"].X, s.Players["a"].Y = 0, 0
+	s.Players["b"].X, s.Players["b"].Y = b.X, b.Y
+	s.Players["c"].X, s.Players["c"].Y = 0, -80
+	return s
+}
+
+func TestLaunch(t *testing.T) {
+	s := newProjectileState(t, DefaultRules(3), Point{30, 40})
+	s.ApplySkill("a", &protocol.SkillCast{SkillId: bolt.ID, TargetId: "b"})
+
+	want := []*Projectile{{ID: 1, Owner: "a", SkillID: bolt.ID, X: 0, Y: 0, VX: 6, VY: 8, Radius: 2, TTL: 6}}
+	if !reflect.DeepEqual(s.Projectiles, want) {
+		t.Fatalf("projectiles %+v, want %+v", s.Projectiles, want)
+	}
+
+	// A target already within the radius is hit without a projectile.
+	s = newProjectileState(t, DefaultRules(3), Point{1, 1})
+	s.ApplySkill("a", &protocol.SkillCast{SkillId: bolt.ID, TargetId: "b"})
+	if len(s.Projectiles) != 0 || s.Players["b"].HP != defaultHP-10 {
+		t.Fatalf("point blank: projectiles %+v, b has %d HP", s.Projectiles, s.Players["b"].HP)
+	}
+}
+
+func TestProjectiles(t *testing.T) {
+	teams := DefaultRules(3)
+	teams.TeamSize = 2
+
+	cases := []struct {
+		name  string
+		rules Rules
+		b     Point
+		// before runs before a fires at target, b unless set; then runs
+		// after.
+		before func(s *State)
+		target string
+		then   func(s *State)
+		ticks  int
+		// hp is every player's HP lost.
+		hp          map[string]int32
+		projectiles int
+	}{
+		{
+			name:        "in flight",
+			b:           Point{35, 0},
+			ticks:       2,
+			projectiles: 1,
+		},
+		{
+			// The ends of the second tick's path are 5 from b; the path
+			// passes through it.
+			name:  "hit between ticks",
+			b:     Point{15, 0},
+			ticks: 2,
+			hp:    map[string]int32{"b": 10},
+		},
+		{
+			name:        "not yet reached between ticks",
+			b:           Point{15, 0},
+			ticks:       1,
+			projectiles: 1,
+		},
+		{
+			name:  "target moved off the path",
+			b:     Point{35, 0},
+			then:  func(s *State) { s.Players["b"].Y = 10 },
+			ticks: 10,
+		},
+		{
+			name:  "first player in the way",
+			b:     Point{40, 0},
+			then:  func(s *State) { s.Players["c"].X, s.Players["c"].Y = 20, 1 },
+			ticks: 10,
+			hp:    map[string]int32{"c": 10},
+		},
+		{
+			name:        "owner is not hit",
+			b:           Point{50, 0},
+			then:        func(s *State) { s.Players["a"].X = 5 },
+			ticks:       1,
+			projectiles: 1,
+		},
+		{
+			name:        "flies for its range",
+			b:           Point{50, 0},
+			then:        func(s *State) { s.Players["b"].X = 80 },
+			ticks:       5,
+			projectiles: 1,
+		},
+		{
+			name:  "expires at its range",
+			b:     Point{50, 0},
+			then:  func(s *State) { s.Players["b"].X = 80 },
+			ticks: 6,
+		},
+		{
+			name:  "blocked by an obstacle",
+			b:     Point{30, 0},
+			then:  func(s *State) { s.Rules.Map = testMap(rect(14, -5, 16, 5)) },
+			ticks: 10,
+		},
+		{
+			name:  "hits in front of an obstacle",
+			b:     Point{12, 0},
+			then:  func(s *State) { s.Rules.Map = testMap(rect(15, -5, 17, 5)) },
+			ticks: 10,
+			hp:    map[string]int32{"b": 10},
+		},
+		{
+			name:  "flies through teammates",
+			rules: teams,
+			// b is a's teammate, c is not.
+			b:      Point{15, 0},
+			before: func(s *State) { s.Players["c"].X, s.Players["c"].Y = 40, 0 },
+			target: "c",
+			ticks:  10,
+			hp:     map[string]int32{"c": 10},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules := tc.rules
+			if rules.Players == 0 {
+				rules = DefaultRules(3)
+			}
+			s := newProjectileState(t, rules, tc.b)
+			if tc.before != nil {
+				tc.before(s)
+			}
+			target := tc.target
+			if target == "" {
+				target = "b"
+			}
+			s.ApplySkill("a", &protocol.SkillCast{SkillId: bolt.ID, TargetId: target})
+			if len(s.Projectiles) != 1 {
+				t.Fatalf("%d projectiles launched", len(s.Projectiles))
+			}
+			if tc.then != nil {
+				tc.then(s)
+			}
+			for i := 0; i < tc.ticks; i++ {
+				s.TickForward()
+			}
+
+			for id, p := range s.Players {
+				if lost := defaultHP - p.HP; lost != tc.hp[id] {
+					t.Fatalf("%s lost %d HP, want %d", id, lost, tc.hp[id])
+				}
+			}
+			if len(s.Projectiles) != tc.projectiles {
+				t.Fatalf("%d projectiles left, want %d", len(s.Projectiles), tc.projectiles)
+			}
+		})
+	}
+}
+
+func TestProjectileSnapshot(t *testing.T) {
+	s := newProjectileState(t, DefaultRules(3), Point{50, 0})
+	if snap := s.Snapshot("r"); snap.Projectiles != nil {
+		t.Fatalf("projectiles before a launch: %+v", snap.Projectiles)
+	}
+	s.ApplySkill("a", &protocol.SkillCast{SkillId: bolt.ID, TargetId: "b"})
+	s.TickForward()
+
+	want := []*protocol.ProjectileSnapshot{{Id: 1, OwnerId: "a", SkillId: bolt.ID, X: 10, Y: 0, Vx: 10, Vy: 0, Radius: 2}}
+	if got := s.Snapshot("r").Projectiles; !reflect.DeepEqual(got, want) {
+		t.Fatalf("projectiles %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+package battle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Targeting is who a skill can be aimed at.
+type Targeting int
+
+const (
+	// TargetEnemy needs another living player as the target.
+	TargetEnemy Targeting = iota
+	// TargetSelf always hits the caster; the cast's target is ignored.
+	TargetSelf
+	// TargetAny takes any living player, the caster included.
+	TargetAny
+)
+
+func (t Targeting) String() string {
+	switch t {
+	case TargetEnemy:
+		return "enemy"
+	case TargetSelf:
+		return "self"
+	case TargetAny:
+		return "any"
+	default:
+		return fmt.Sprintf("targeting(%d)", int(t))
+	}
+}
+
+func parseTargeting(s string) (Targeting, error) {
+	for _, t := range []Targeting{TargetEnemy, TargetSelf, TargetAny} {
+		if t.String() == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown target %q", s)
+}
+
+// Skill is one entry of the skill catalog. Times are in ticks.
+type Skill struct {
+	ID     int32
+	Name   string
+	Damage int32
+	Heal   int32
+	Range  float64
+	// Cooldown starts when the cast starts.
+	Cooldown int32
+	// CastTime delays the effect; the target must still be in range when
+	// it lands.
+	CastTime int32
+	Target   Targeting
+	// Speed makes the skill a projectile moving this far per tick; 0 hits
+	// instantly. Projectiles fly for Range and hit the first enemy within
+	// Radius of their path.
+	Speed  float64
+	Radius float64
+	// Effects are put on the target when the skill lands.
+	Effects []EffectSpec
+}
+
+// harmful reports whether the skill damages or hinders its target.
+func (sk Skill) harmful() bool {
+	if sk.Damage > 0 {
+		return true
+	}
+	for _, e := range sk.Effects {
+		if e.Kind.harmful() {
+			return true
+		}
+	}
+	return false
+}
+
+func (sk Skill) applies(kind EffectKind) bool {
+	for _, e := range sk.Effects {
+		if e.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Projectile reports whether the skill fires a projectile.
+func (sk Skill) Projectile() bool {
+	return sk.Speed > 0
+}
+
+// DefaultSkills is the catalog used without a skills file: a single strike.
+func DefaultSkills() []Skill {
+	return []Skill{
+		{ID: 1, Name: "strike", Damage: 10, Range: 20, Cooldown: 20, Target: TargetEnemy},
+	}
+}
+
+// Skill looks up a skill by ID and returns its index in the catalog.
+func (r Rules) Skill(id int32) (int, Skill, bool) {
+	for i, sk := range r.Skills {
+		if sk.ID == id {
+			return i, sk, true
+		}
+	}
+	return 0, Skill{}, false
+}
+
+type skillFile struct {
+	Skills []skillJSON `json:"skills"`
+}
+
+type skillJSON struct {
+	ID         int32        `json:"id"`
+	Name       string       `json:"name"`
+	Damage     int32        `json:"damage"`
+	Heal       int32        `json:"heal"`
+	Range      float64      `json:"range"`
+	CooldownMs int          `json:"cooldown_ms"`
+	CastMs     int          `json:"cast_ms"`
+	Target     string       `json:"target"`
+	Speed      float64      `json:"speed"`
+	Radius     float64      `json:"radius"`
+	Effects    []effectJSON `json:"effects"`
+}
+
+// ParseSkills reads a skill catalog in JSON. Times in the file are in
+// milliseconds and are rounded up to whole ticks; projectile speed is in
+// arena units per second.
+func ParseSkills(data []byte, tick time.Duration) ([]Skill, error) {
+	var f skillFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if len(f.Skills) == 0 {
+		return nil, errors.New("no skills")
+	}
+
+	skills := make([]Skill, 0, len(f.Skills))
+	seen := make(map[int32]bool, len(f.Skills))
+	for _, j := range f.Skills {
+		target, err := parseTargeting(j.Target)
+		if err != nil {
+			return nil, fmt.Errorf("skill %d: %w", j.ID, err)
+		}
+		effects, err := parseEffects(j.Effects, tick)
+		if err != nil {
+			return nil, fmt.Errorf("skill %d: %w", j.ID, err)
+		}
+		sk := Skill{
+			ID:       j.ID,
+			Name:     j.Name,
+			Damage:   j.Damage,
+			Heal:     j.Heal,
+			Range:    j.Range,
+			Cooldown: msToTicks(j.CooldownMs, tick),
+			CastTime: msToTicks(j.CastMs, tick),
+			Target:   target,
+			Speed:    j.Speed * tick.Seconds(),
+			Radius:   j.Radius,
+			Effects:  effects,
+		}
+		if err := sk.validate(); err != nil {
+			return nil, fmt.Errorf("skill %d: %w", j.ID, err)
+		}
+		if seen[sk.ID] {
+			return nil, fmt.Errorf("skill %d: duplicate id", sk.ID)
+		}
+		seen[sk.ID] = true
+		skills = append(skills, sk)
+	}
+	return skills, nil
+}
+
+func msToTicks(ms int, tick time.Duration) int32 {
+	d := time.Duration(ms) * time.Millisecond
+	if d < 0 {
+		// Round away from zero so validation still sees a negative time.
+		return -int32((-d + tick - 1) / tick)
+	}
+	return int32((d + tick - 1) / tick)
+}
+
+func (sk Skill) validate() error {
+	switch {
+	case sk.ID <= 0:
+		return errors.New("id must be positive")
+	case sk.Damage < 0 || sk.Heal < 0 || sk.Cooldown < 0 || sk.CastTime < 0:
+		return errors.New("negative value")
+	case sk.Damage == 0 && sk.Heal == 0 && len(sk.Effects) == 0:
+		return errors.New("needs damage, heal or an effect")
+	case sk.Target == TargetEnemy && (sk.Heal > 0 || sk.applies(EffectShield)):
+		return errors.New("enemy skills cannot heal or shield")
+	case sk.Target == TargetSelf && sk.harmful():
+		return errors.New("self skills cannot deal damage or hinder")
+	case sk.Target != TargetSelf && sk.Range <= 0:
+		return errors.New("range must be positive")
+	case sk.Speed < 0 || sk.Radius < 0:
+		return errors.New("negative value")
+	case sk.Projectile() && sk.Target != TargetEnemy:
+		return errors.New("projectiles must target enemies")
+	case sk.Projectile() && sk.Radius == 0:
+		return errors.New("projectiles need a radius")
+	}
+	return nil
+}
+
+// SkillCooldown is a skill that is not ready yet.
+type SkillCooldown struct {
+	SkillID int32
+	Ticks   int32
+}
+
+// ActiveCooldowns lists p's skills that are still cooling down, in catalog
+// order.
+func (s *State) ActiveCooldowns(p *PlayerState) []SkillCooldown {
+	var out []SkillCooldown
+	for i, cd := range p.Cooldowns {
+		if cd > 0 {
+			out = append(out, SkillCooldown{SkillID: s.Rules.Skills[i].ID, Ticks: cd})
+		}
+	}
+	return out
+}
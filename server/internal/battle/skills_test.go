@@ -0,0 +1,232 @@
+package battle
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"miniarena/pkg/protocol"
+)
+
+func TestParseSkills(t *testing.T) {
+	cases := []struct {
+		name string
+		json string
+		// err is part of the error; "" expects the catalog to parse.
+		err string
+	}{
+		{name: "valid", json: `{"skills": [
+			{"id": 1, "name": "strike", "damage": 10, "range": 20, "cooldown_ms": 1000, "target": "enemy"},
+			{"id": 2, "name": "heal", "heal": 15, "cooldown_ms": 5000, "cast_ms": 120, "target": "self"},
+			{"id": 3, "name": "bolt", "damage": 8, "range": 80, "target": "enemy", "speed": 60, "radius": 3,
+			 "effects": [{"kind": "slow", "duration_ms": 2000, "slow": 0.5}]}]}`},
+		{name: "bad json", json: `{"skills": [`, err: "unexpected end"},
+		{name: "no skills", json: `{"skills": []}`, err: "no skills"},
+		{name: "duplicate id", json: `{"skills": [
+			{"id": 1, "damage": 10, "range": 20, "target": "enemy"},
+			{"id": 1, "damage": 5, "range": 20, "target": "enemy"}]}`, err: "skill 1: duplicate id"},
+		{name: "zero id", json: `{"skills": [{"id": 0, "damage": 10, "range": 20, "target": "enemy"}]}`, err: "id must be positive"},
+		{name: "negative id", json: `{"skills": [{"id": -1, "damage": 10, "range": 20, "target": "enemy"}]}`, err: "id must be positive"},
+		{name: "negative damage", json: `{"skills": [{"id": 1, "damage": -10, "range": 20, "target": "enemy"}]}`, err: "negative value"},
+		{name: "negative heal", json: `{"skills": [{"id": 1, "heal": -10, "target": "self"}]}`, err: "negative value"},
+		{name: "negative cooldown", json: `{"skills": [{"id": 1, "damage": 10, "range": 20, "cooldown_ms": -50, "target": "enemy"}]}`, err: "negative value"},
+		{name: "negative cast time", json: `{"skills": [{"id": 1, "damage": 10, "range": 20, "cast_ms": -50, "target": "enemy"}]}`, err: "negative value"},
+		{name: "zero range", json: `{"skills": [{"id": 1, "damage": 10, "target": "enemy"}]}`, err: "range must be positive"},
+		{name: "does nothing", json: `{"skills": [{"id": 1, "range": 20, "target": "enemy"}]}`, err: "needs damage, heal or an effect"},
+		{name: "unknown targeting", json: `{"skills": [{"id": 1, "damage": 10, "range": 20, "target": "ally"}]}`, err: `unknown target "ally"`},
+		{name: "missing targeting", json: `{"skills": [{"id": 1, "damage": 10, "range": 20}]}`, err: `unknown target ""`},
+		{name: "enemy heal", json: `{"skills": [{"id": 1, "heal": 10, "range": 20, "target": "enemy"}]}`, err: "enemy skills cannot heal"},
+		{name: "self damage", json: `{"skills": [{"id": 1, "damage": 10, "target": "self"}]}`, err: "self skills cannot deal damage"},
+		{name: "projectile at any", json: `{"skills": [{"id": 1, "damage": 10, "range": 20, "target": "any", "speed": 60, "radius": 3}]}`, err: "projectiles must target enemies"},
+		{name: "projectile without radius", json: `{"skills": [{"id": 1, "damage": 10, "range": 20, "target": "enemy", "speed": 60}]}`, err: "projectiles need a radius"},
+		{name: "negative speed", json: `{"skills": [{"id": 1, "damage": 10, "range": 20, "target": "enemy", "speed": -1}]}`, err: "negative value"},
+		{name: "bad effect", json: `{"skills": [{"id": 1, "damage": 10, "range": 20, "target": "enemy",
+			"effects": [{"kind": "stun"}]}]}`, err: "skill 1: stun: duration must be positive"},
+		{name: "negative effect duration", json: `{"skills": [{"id": 1, "damage": 10, "range": 20, "target": "enemy",
+			"effects": [{"kind": "stun", "duration_ms": -10}]}]}`, err: "duration must be positive"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			skills, err := ParseSkills([]byte(tc.json), 50*time.Millisecond)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("ParseSkills() error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Times round up to whole 50ms ticks; speed is per tick.
+			want := []Skill{
+				{ID: 1, Name: "strike", Damage: 10, Range: 20, Cooldown: 20, Target: TargetEnemy},
+				{ID: 2, Name: "heal", Heal: 15, Cooldown: 100, CastTime: 3, Target: TargetSelf},
+				{ID: 3, Name: "bolt", Damage: 8, Range: 80, Target: TargetEnemy, Speed: 3, Radius: 3,
+					Effects: []EffectSpec{{Kind: EffectSlow, Duration: 40, Slow: 0.5}}},
+			}
+			if !reflect.DeepEqual(skills, want) {
+				t.Fatalf("ParseSkills() = %+v, want %+v", skills, want)
+			}
+		})
+	}
+}
+
+func TestDeploySkills(t *testing.T) {
+	data, err := os.ReadFile("../../../deploy/skills.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	skills, err := ParseSkills(data, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skills) == 0 {
+		t.Fatal("no skills")
+	}
+}
+
+func TestSkillCasts(t *testing.T) {
+	const (
+		strike = 1 // instant, 5 tick cooldown
+		mend   = 2 // instant self heal, 8 tick cooldown
+		snipe  = 3 // lands after 3 ticks, 10 tick cooldown
+	)
+	skills := []Skill{
+		{ID: strike, Damage: 10, Range: 20, Cooldown: 5, Target: TargetEnemy},
+		{ID: mend, Heal: 10, Cooldown: 8, Target: TargetSelf},
+		{ID: snipe, Damage: 25, Range: 60, Cooldown: 10, CastTime: 3, Target: TargetEnemy},
+	}
+	cast := func(s *State, caster string, skill int32, target string) {
+		s.ApplySkill(caster, &protocol.SkillCast{SkillId: skill, TargetId: target})
+	}
+	ticks := func(s *State, n int) {
+		for i := 0; i < n; i++ {
+			s.TickForward()
+		}
+	}
+
+	cases := []struct {
+		name string
+		// do plays with a at (0, 0), b at (10, 0) and c at (20, 0), all at
+		// 80 HP.
+		do   func(s *State)
+		hp   map[string]int32
+		cast map[string]int32
+		// cooldowns are a's in the snapshot, as "skill:ticks".
+		cooldowns []string
+	}{
+		{
+			name: "unknown skill",
+			do:   func(s *State) { cast(s, "a", 9, "b") },
+			hp:   map[string]int32{"b": 80},
+			cast: map[string]int32{"a": 0},
+		},
+		{
+			name:      "cooldown blocks a recast",
+			do:        func(s *State) { cast(s, "a", strike, "b"); ticks(s, 4); cast(s, "a", strike, "b") },
+			hp:        map[string]int32{"b": 70},
+			cast:      map[string]int32{"a": 1},
+			cooldowns: []string{"1:1"},
+		},
+		{
+			name: "ready after the cooldown",
+			do:   func(s *State) { cast(s, "a", strike, "b"); ticks(s, 5); cast(s, "a", strike, "b") },
+			hp:   map[string]int32{"b": 60},
+			cast: map[string]int32{"a": 2},
+			// Cast on the tick it came off cooldown.
+			cooldowns: []string{"1:5"},
+		},
+		{
+			name:      "cooldowns are per skill",
+			do:        func(s *State) { cast(s, "a", strike, "b"); cast(s, "a", mend, "") },
+			hp:        map[string]int32{"a": 90, "b": 70},
+			cast:      map[string]int32{"a": 2},
+			cooldowns: []string{"1:5", "2:8"},
+		},
+		{
+			name: "cooldowns are per player",
+			do:   func(s *State) { cast(s, "a", strike, "b"); cast(s, "c", strike, "b") },
+			hp:   map[string]int32{"b": 60},
+			cast: map[string]int32{"a": 1, "c": 1},
+			// c's cooldown is not a's.
+			cooldowns: []string{"1:5"},
+		},
+		{
+			name:      "cast time delays the effect",
+			do:        func(s *State) { cast(s, "a", snipe, "c"); ticks(s, 2) },
+			hp:        map[string]int32{"c": 80},
+			cast:      map[string]int32{"a": 1},
+			cooldowns: []string{"3:8"},
+		},
+		{
+			name:      "cast lands after the cast time",
+			do:        func(s *State) { cast(s, "a", snipe, "c"); ticks(s, 3) },
+			hp:        map[string]int32{"c": 55},
+			cast:      map[string]int32{"a": 1},
+			cooldowns: []string{"3:7"},
+		},
+		{
+			name:      "no cast while casting",
+			do:        func(s *State) { cast(s, "a", snipe, "c"); cast(s, "a", strike, "b"); ticks(s, 3) },
+			hp:        map[string]int32{"b": 80, "c": 55},
+			cast:      map[string]int32{"a": 1},
+			cooldowns: []string{"3:7"},
+		},
+		{
+			name: "target out of range when the cast lands",
+			do: func(s *State) {
+				cast(s, "a", snipe, "c")
+				s.Players["c"].X = 90
+				ticks(s, 3)
+			},
+			hp:        map[string]int32{"c": 80},
+			cast:      map[string]int32{"a": 1},
+			cooldowns: []string{"3:7"},
+		},
+		{
+			name: "cooldowns run out",
+			do:   func(s *State) { cast(s, "a", strike, "b"); ticks(s, 5) },
+			hp:   map[string]int32{"b": 70},
+			cast: map[string]int32{"a": 1},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules := DefaultRules(3)
+			rules.Skills = skills
+			s := NewState([]string{"a", "b", "c"}, rules, 1)
+			for i, p := range s.sortedPlayers() {
+				p.X, p.Y = float32(10*i), 0
+				p.HP = 80
+			}
+
+			tc.do(s)
+
+			for id, want := range tc.hp {
+				if got := s.Players[id].HP; got != want {
+					t.Fatalf("%s has %d HP, want %d", id, got, want)
+				}
+			}
+			for id, want := range tc.cast {
+				if got := s.Players[id].SkillsCast; got != want {
+					t.Fatalf("%s cast %d skills, want %d", id, got, want)
+				}
+			}
+			var cooldowns []string
+			for _, p := range s.Snapshot("r").Players {
+				if p.PlayerId != "a" {
+					continue
+				}
+				for _, cd := range p.Cooldowns {
+					cooldowns = append(cooldowns, fmt.Sprintf("%d:%d", cd.SkillId, cd.Ticks))
+				}
+			}
+			if !reflect.DeepEqual(cooldowns, tc.cooldowns) {
+				t.Fatalf("a's cooldowns %v, want %v", cooldowns, tc.cooldowns)
+			}
+		})
+	}
+}
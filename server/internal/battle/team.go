@@ -0,0 +1,111 @@
+package battle
+
+// TeamOf returns the team of the player in seat i, counting from 1, or 0 in
+// a free-for-all. Seats fill one team before the next, so players queued or
+// listed together play together.
+func (r Rules) TeamOf(i int) int32 {
+	if r.TeamSize < 2 {
+		return 0
+	}
+	return int32(i/r.TeamSize) + 1
+}
+
+// Allies reports whether a and b are different players on the same team.
+func (s *State) Allies(a, b string) bool {
+	pa, pb := s.Players[a], s.Players[b]
+	return pa != nil && pb != nil && a != b && allies(pa, pb)
+}
+
+func allies(a, b *PlayerState) bool {
+	return a.Team != 0 && a.Team == b.Team && a != b
+}
+
+// spares reports whether friendly fire keeps the caster's skill from harming
+// the target.
+func (s *State) spares(caster, target *PlayerState) bool {
+	return !s.Rules.FriendlyFire && allies(caster, target)
+}
+
+// side is what wins or loses a match: a team, or a single player in a
+// free-for-all.
+type side struct {
+	team    int32
+	players []*PlayerState
+}
+
+// sides groups the players, in order of their lowest player ID.
+func (s *State) sides() []*side {
+	var out []*side
+	byTeam := make(map[int32]*side)
+	for _, p := range s.sortedPlayers() {
+		if p.Team == 0 {
+			out = append(out, &side{players: []*PlayerState{p}})
+			continue
+		}
+		sd := byTeam[p.Team]
+		if sd == nil {
+			sd = &side{team: p.Team}
+			byTeam[p.Team] = sd
+			out = append(out, sd)
+		}
+		sd.players = append(sd.players, p)
+	}
+	return out
+}
+
+// Sides returns how many teams, or players in a free-for-all, are in the
+// match.
+func (s *State) Sides() int {
+	return len(s.sides())
+}
+
+func (sd *side) alive() bool {
+	for _, p := range sd.players {
+		if p.HP > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (sd *side) forfeited() bool {
+	for _, p := range sd.players {
+		if !p.Forfeited {
+			return false
+		}
+	}
+	return true
+}
+
+// hp and dealt are what tie-breaks compare.
+func (sd *side) hp() int64 {
+	var hp int64
+	for _, p := range sd.players {
+		hp += int64(p.HP)
+	}
+	return hp
+}
+
+func (sd *side) dealt() int64 {
+	var dealt int64
+	for _, p := range sd.players {
+		dealt += int64(p.DamageDealt)
+	}
+	return dealt
+}
+
+// win is the result of sd winning the match.
+func (sd *side) win(outcome Outcome, reason string) Result {
+	if sd.team != 0 {
+		return Result{Outcome: outcome, Team: sd.team, Reason: reason}
+	}
+	return Result{Outcome: outcome, Winner: sd.players[0].ID, Reason: reason}
+}
+
+// won reports whether the result names p or p's team as the winner.
+func (res Result) won(p *PlayerState) bool {
+	if res.Team != 0 {
+		return p.Team == res.Team
+	}
+	return res.Winner != "" && p.ID == res.Winner
+}
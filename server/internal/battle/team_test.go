@@ -0,0 +1,208 @@
+package battle
+
+import (
+	"testing"
+
+	"miniarena/pkg/protocol"
+)
+
+func teamRules(players int) Rules {
+	rules := DefaultRules(players)
+	rules.TeamSize = 2
+	return rules
+}
+
+func TestTeamResult(t *testing.T) {
+	timed := teamRules(4)
+	timed.TimeLimitTicks = 10
+
+	// Seats a and b are team 1, c and d team 2.
+	cases := []struct {
+		name    string
+		rules   Rules
+		tick    int64
+		players []player
+		over    bool
+		want    Result
+	}{
+		{
+			name:    "one of each team alive",
+			rules:   teamRules(4),
+			players: []player{{id: "a", hp: 10}, {id: "b"}, {id: "c"}, {id: "d", hp: 10}},
+		},
+		{
+			name:    "last team standing",
+			rules:   teamRules(4),
+			players: []player{{id: "a"}, {id: "b", hp: 10}, {id: "c"}, {id: "d"}},
+			over:    true,
+			want:    Result{Outcome: OutcomeWin, Team: 1, Reason: "last team standing"},
+		},
+		{
+			name:    "one player of a team left",
+			rules:   teamRules(4),
+			players: []player{{id: "a", hp: 10}, {id: "b", hp: 10}, {id: "c", left: true}, {id: "d", hp: 10}},
+		},
+		{
+			name:    "whole team left",
+			rules:   teamRules(4),
+			players: []player{{id: "a", hp: 10}, {id: "b", hp: 10}, {id: "c", left: true}, {id: "d", left: true}},
+			over:    true,
+			want:    Result{Outcome: OutcomeWin, Team: 1, Reason: "opponents left"},
+		},
+		{
+			name:    "teams eliminated together",
+			rules:   teamRules(4),
+			players: []player{{id: "a"}, {id: "b"}, {id: "c"}, {id: "d"}},
+			over:    true,
+			want:    Result{Outcome: OutcomeDraw, Reason: "eliminated together"},
+		},
+		{
+			name:    "time limit on summed HP",
+			rules:   timed,
+			tick:    10,
+			players: []player{{id: "a", hp: 60}, {id: "b", hp: 10}, {id: "c", hp: 40}, {id: "d", hp: 40}},
+			over:    true,
+			want:    Result{Outcome: OutcomeTimeout, Team: 2, Reason: "time limit: most HP left"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestState(t, tc.rules, tc.players)
+			s.Tick = tc.tick
+			got, over := s.Result()
+			if over != tc.over || got != tc.want {
+				t.Fatalf("Result() = %+v, %v; want %+v, %v", got, over, tc.want, tc.over)
+			}
+		})
+	}
+}
+
+func TestFriendlyFire(t *testing.T) {
+	const (
+		strike = 1 // enemy only: damage
+		splash = 2 // any target: damage, heal, a stun and a shield
+	)
+	skills := []Skill{
+		{ID: strike, Damage: 10, Range: 20, Cooldown: 20, Target: TargetEnemy},
+		{ID: splash, Damage: 10, Heal: 5, Range: 20, Cooldown: 20, Target: TargetAny, Effects: []EffectSpec{
+			{Kind: EffectStun, Duration: 10},
+			{Kind: EffectShield, Duration: 10, Amount: 5},
+		}},
+	}
+	cases := []struct {
+		name         string
+		friendlyFire bool
+		skill        int32
+		target       string
+		hp           int32
+		cast         bool
+		stunned      bool
+		shielded     bool
+	}{
+		{name: "enemy skill on an enemy", skill: strike, target: "c", hp: 70, cast: true},
+		{name: "enemy skill on a teammate", skill: strike, target: "b", hp: 80},
+		{name: "enemy skill on a teammate with friendly fire", friendlyFire: true, skill: strike, target: "b", hp: 70, cast: true},
+		{name: "any skill on an enemy", skill: splash, target: "c", hp: 75, cast: true, stunned: true, shielded: true},
+		{name: "any skill on a teammate helps only", skill: splash, target: "b", hp: 85, cast: true, shielded: true},
+		{name: "any skill on a teammate with friendly fire", friendlyFire: true, skill: splash, target: "b", hp: 75, cast: true, stunned: true, shielded: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules := teamRules(4)
+			rules.Skills = skills
+			rules.FriendlyFire = tc.friendlyFire
+			s := NewState([]string{"a", "b", "c", "d"}, rules, 1)
+			for i, p := range s.sortedPlayers() {
+				p.X, p.Y = float32(i), 0
+				p.HP = 80
+			}
+
+			s.ApplySkill("a", &protocol.SkillCast{SkillId: tc.skill, TargetId: tc.target})
+
+			target := s.Players[tc.target]
+			var shielded bool
+			for _, e := range target.Effects {
+				shielded = shielded || e.Kind == EffectShield
+			}
+			caster := s.Players["a"]
+			if target.HP != tc.hp || (caster.SkillsCast == 1) != tc.cast || target.stunned() != tc.stunned || shielded != tc.shielded {
+				t.Fatalf("hp %d, cast %v, stunned %v, shielded %v; want %d, %v, %v, %v",
+					target.HP, caster.SkillsCast == 1, target.stunned(), shielded, tc.hp, tc.cast, tc.stunned, tc.shielded)
+			}
+		})
+	}
+}
+
+func TestTeamPlacements(t *testing.T) {
+	// Seats a and b are team 1, c and d team 2, e and f team 3.
+	cases := []struct {
+		name    string
+		tick    int64
+		players []player
+		want    map[string]int
+	}{
+		{
+			name: "teammates share a placement",
+			players: []player{
+				{id: "a", diedAt: 50}, {id: "b", diedAt: 40},
+				{id: "c", diedAt: 30}, {id: "d", diedAt: 30},
+				{id: "e", hp: 10}, {id: "f", diedAt: 20},
+			},
+			want: map[string]int{"e": 1, "f": 1, "a": 2, "b": 2, "c": 3, "d": 3},
+		},
+		{
+			name: "tied teams share a placement",
+			players: []player{
+				{id: "a", diedAt: 30, dealt: 5}, {id: "b", diedAt: 30},
+				{id: "c", diedAt: 30}, {id: "d", diedAt: 30, dealt: 5},
+				{id: "e", hp: 10}, {id: "f", hp: 10},
+			},
+			want: map[string]int{"e": 1, "f": 1, "a": 2, "b": 2, "c": 2, "d": 2},
+		},
+		{
+			name: "time limit ranks teams by HP",
+			tick: 10,
+			players: []player{
+				{id: "a", hp: 30}, {id: "b", hp: 30},
+				{id: "c", hp: 50}, {id: "d", hp: 20},
+				{id: "e", hp: 10, dealt: 40}, {id: "f", diedAt: 5},
+			},
+			want: map[string]int{"c": 1, "d": 1, "a": 2, "b": 2, "e": 3, "f": 3},
+		},
+		{
+			name: "time limit tied",
+			tick: 10,
+			players: []player{
+				{id: "a", hp: 30}, {id: "b", hp: 30},
+				{id: "c", hp: 40}, {id: "d", hp: 20},
+				{id: "e", hp: 10}, {id: "f", hp: 10},
+			},
+			want: map[string]int{"a": 1, "b": 1, "c": 1, "d": 1, "e": 3, "f": 3},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules := teamRules(6)
+			rules.TimeLimitTicks = 10
+			s := newTestState(t, rules, tc.players)
+			s.Tick = tc.tick
+			res, over := s.Result()
+			if !over {
+				t.Fatal("match not over")
+			}
+			stats := s.Stats(res)
+			got := make(map[string]int, len(stats))
+			for i, st := range stats {
+				got[st.PlayerID] = st.Placement
+				if i > 0 && st.Placement < stats[i-1].Placement {
+					t.Fatalf("stats not ordered by placement: %+v", stats)
+				}
+			}
+			for id, want := range tc.want {
+				if got[id] != want {
+					t.Fatalf("placements %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
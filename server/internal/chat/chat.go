@@ -0,0 +1,147 @@
+package chat
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"miniarena/pkg/protocol"
+)
+
+// Settings bound room chat. They are shared by every room of a manager.
+type Settings struct {
+	// MaxLength is the longest accepted message in characters.
+	MaxLength int
+	// RateLimit messages are allowed per RateWindow for each sender.
+	RateLimit  int
+	RateWindow time.Duration
+	// History is how many recent lines a room keeps for reconnecting players.
+	History int
+	Filter  *Filter
+}
+
+// Filter masks blocked words, ignoring case. Only whole words match, so a
+// blocked word inside a longer one is left alone. The zero value and a nil
+// Filter let everything through.
+type Filter struct {
+	words [][]rune
+}
+
+func NewFilter(words []string) *Filter {
+	f := &Filter{}
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		f.words = append(f.words, []rune(strings.ToLower(w)))
+	}
+	return f
+}
+
+// Mask replaces every character of each blocked word in text with '*' and
+// reports whether anything was masked.
+func (f *Filter) Mask(text string) (string, bool) {
+	if f == nil || len(f.words) == 0 {
+		return text, false
+	}
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	masked := false
+	for _, w := range f.words {
+		for i := 0; i+len(w) <= len(lower); i++ {
+			if !hasPrefix(lower[i:], w) || !boundary(lower, i-1) || !boundary(lower, i+len(w)) {
+				continue
+			}
+			for j := i; j < i+len(w); j++ {
+				runes[j] = '*'
+			}
+			masked = true
+			i += len(w) - 1
+		}
+	}
+	if !masked {
+		return text, false
+	}
+	return string(runes), true
+}
+
+// boundary reports whether position i, which may be just outside text, does
+// not continue a word.
+func boundary(text []rune, i int) bool {
+	if i < 0 || i >= len(text) {
+		return true
+	}
+	return !unicode.IsLetter(text[i]) && !unicode.IsDigit(text[i])
+}
+
+func hasPrefix(s, prefix []rune) bool {
+	for i, r := range prefix {
+		if s[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// Limiter counts messages per sender in fixed windows. It is owned by a room
+// loop and is not safe for concurrent use.
+type Limiter struct {
+	limit   int
+	window  time.Duration
+	senders map[string]*senderWindow
+}
+
+type senderWindow struct {
+	start time.Time
+	count int
+}
+
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{limit: limit, window: window, senders: make(map[string]*senderWindow)}
+}
+
+func (l *Limiter) Allow(senderID string, now time.Time) bool {
+	if l.limit <= 0 {
+		return true
+	}
+	w := l.senders[senderID]
+	if w == nil {
+		w = &senderWindow{start: now}
+		l.senders[senderID] = w
+	}
+	if now.Sub(w.start) >= l.window {
+		w.start = now
+		w.count = 0
+	}
+	w.count++
+	return w.count <= l.limit
+}
+
+// History keeps the most recent lines of a room.
+type History struct {
+	max   int
+	lines []*protocol.ChatMessage
+}
+
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+func (h *History) Add(msg *protocol.ChatMessage) {
+	if h.max <= 0 {
+		return
+	}
+	if len(h.lines) == h.max {
+		h.lines = append(h.lines[:0], h.lines[1:]...)
+	}
+	h.lines = append(h.lines, msg)
+}
+
+// Lines returns the stored lines, oldest first.
+func (h *History) Lines() []*protocol.ChatMessage {
+	return append([]*protocol.ChatMessage(nil), h.lines...)
+}
@@ -0,0 +1,145 @@
+package chat
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"miniarena/pkg/protocol"
+)
+
+func TestMask(t *testing.T) {
+	cases := []struct {
+		name   string
+		words  []string
+		in     string
+		want   string
+		masked bool
+	}{
+		{name: "no words", in: "darn", want: "darn"},
+		{name: "blank words", words: []string{" ", ""}, in: "darn", want: "darn"},
+		{name: "plain", words: []string{"darn"}, in: "oh darn", want: "oh ****", masked: true},
+		{name: "text case", words: []string{"darn"}, in: "DaRn it", want: "**** it", masked: true},
+		{name: "word case", words: []string{" DARN "}, in: "darn", want: "****", masked: true},
+		{name: "every time", words: []string{"darn"}, in: "darn darn", want: "**** ****", masked: true},
+		{name: "punctuation", words: []string{"darn"}, in: "(darn)!", want: "(****)!", masked: true},
+		{name: "inside a word", words: []string{"darn"}, in: "darned undarn darn2", want: "darned undarn darn2"},
+		{name: "longer word first", words: []string{"darn", "darned"}, in: "darned darn", want: "****** ****", masked: true},
+		{name: "overlapping phrases", words: []string{"oh no", "no way"}, in: "oh no way", want: "*********", masked: true},
+		{name: "multibyte", words: []string{"ärger"}, in: "so ÄRGER!", want: "so *****!", masked: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var f *Filter
+			if tc.words != nil {
+				f = NewFilter(tc.words)
+			}
+			got, masked := f.Mask(tc.in)
+			if got != tc.want || masked != tc.masked {
+				t.Fatalf("Mask(%q) = %q, %v; want %q, %v", tc.in, got, masked, tc.want, tc.masked)
+			}
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	type send struct {
+		sender string
+		at     time.Duration
+	}
+	cases := []struct {
+		name    string
+		limit   int
+		sends   []send
+		allowed []bool
+	}{
+		{
+			name:    "under the limit",
+			limit:   2,
+			sends:   []send{{"a", 0}, {"a", time.Second}},
+			allowed: []bool{true, true},
+		},
+		{
+			name:    "over the limit",
+			limit:   2,
+			sends:   []send{{"a", 0}, {"a", time.Second}, {"a", 2 * time.Second}},
+			allowed: []bool{true, true, false},
+		},
+		{
+			name:    "window rolls over",
+			limit:   1,
+			sends:   []send{{"a", 0}, {"a", 9 * time.Second}, {"a", 10 * time.Second}, {"a", 11 * time.Second}},
+			allowed: []bool{true, false, true, false},
+		},
+		{
+			// A window starts at its first message, not on a fixed grid.
+			name:    "window starts with the sender",
+			limit:   1,
+			sends:   []send{{"a", 0}, {"a", 15 * time.Second}, {"a", 21 * time.Second}, {"a", 25 * time.Second}},
+			allowed: []bool{true, true, false, true},
+		},
+		{
+			name:    "senders counted apart",
+			limit:   1,
+			sends:   []send{{"a", 0}, {"b", 0}, {"a", time.Second}},
+			allowed: []bool{true, true, false},
+		},
+		{
+			name:    "no limit",
+			sends:   []send{{"a", 0}, {"a", 0}, {"a", 0}},
+			allowed: []bool{true, true, true},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLimiter(tc.limit, 10*time.Second)
+			start := time.Now()
+			var got []bool
+			for _, s := range tc.sends {
+				got = append(got, l.Allow(s.sender, start.Add(s.at)))
+			}
+			if !reflect.DeepEqual(got, tc.allowed) {
+				t.Fatalf("allowed %v, want %v", got, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	cases := []struct {
+		name  string
+		max   int
+		added int
+		want  []string
+	}{
+		{name: "empty", max: 3},
+		{name: "under capacity", max: 3, added: 2, want: []string{"1", "2"}},
+		{name: "at capacity", max: 3, added: 3, want: []string{"1", "2", "3"}},
+		{name: "drops the oldest", max: 3, added: 5, want: []string{"3", "4", "5"}},
+		{name: "disabled", max: 0, added: 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHistory(tc.max)
+			for i := 1; i <= tc.added; i++ {
+				h.Add(&protocol.ChatMessage{Text: strconv.Itoa(i)})
+			}
+			lines := h.Lines()
+			var got []string
+			for _, l := range lines {
+				got = append(got, l.Text)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("lines %v, want %v", got, tc.want)
+			}
+			// Lines is a copy the caller may keep while more are added.
+			if len(lines) > 0 {
+				lines[0] = nil
+				if h.Lines()[0] == nil {
+					t.Fatal("Lines shares its slice with the history")
+				}
+			}
+		})
+	}
+}
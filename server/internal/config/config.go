@@ -8,20 +8,49 @@ import (
 )
 
 type Config struct {
-	HTTPAddr         string
-	JWTSecret        string
-	RedisAddr        string
-	RedisPassword    string
-	RedisDB          int
-	MySQLDSN         string
-	TickMS           int
-	PlayersPerRoom   int
-	ReconnectTTL     time.Duration
-	LogLevel         string
-	SendQueueSize    int
-	ReadLimitBytes   int64
-	MatchQueueSize   int
-	MaxMsgPerSecond  int
+	HTTPAddr           string
+	JWTSecret          string
+	RedisAddr          string
+	RedisPassword      string
+	RedisDB            int
+	MySQLDSN           string
+	TickMS             int
+	PlayersPerRoom     int
+	FriendlyFireModes  []string
+	ReconnectTTL       time.Duration
+	IdentityTTL        time.Duration
+	LogLevel           string
+	SendQueueSize      int
+	ReadLimitBytes     int64
+	MatchQueueSize     int
+	MaxMsgPerSecond    int
+	ReliableBufferSize int
+	ReadyTimeout       time.Duration
+	Countdown          time.Duration
+	MaxSpectators      int
+	SpectatorDelay     time.Duration
+	ChatMaxLength      int
+	ChatRateLimit      int
+	ChatRateWindow     time.Duration
+	ChatHistory        int
+	ChatBlockedWords   []string
+	DisconnectGrace    time.Duration
+	RematchWindow      time.Duration
+	MatchTimeLimit     time.Duration
+	SuddenDeath        time.Duration
+	SkillsFile         string
+	MapsDir            string
+	FixedPoint         bool
+	ReplayStore        string
+	ReplayDir          string
+	ReplayTTL          time.Duration
+	AIDifficulty       string
+	AITakeOver         bool
+	BotFillAfter       time.Duration
+	RoomShards         int
+	RoomStallAfter     time.Duration
+	CheckpointEvery    time.Duration
+	AdminToken         string
 }
 
 func Load() (Config, error) {
@@ -38,28 +67,86 @@ func Load() (Config, error) {
 	v.SetDefault("MYSQL_DSN", "")
 	v.SetDefault("TICK_MS", 50)
 	v.SetDefault("PLAYERS_PER_ROOM", 2)
+	v.SetDefault("FRIENDLY_FIRE_MODES", "")
 	v.SetDefault("RECONNECT_TTL_SEC", 30)
+	v.SetDefault("IDENTITY_TTL_HOURS", 720)
 	v.SetDefault("LOG_LEVEL", "info")
 	v.SetDefault("SEND_QUEUE_SIZE", 256)
 	v.SetDefault("READ_LIMIT_BYTES", 1048576)
 	v.SetDefault("MATCH_QUEUE_SIZE", 10240)
 	v.SetDefault("MAX_MSG_PER_SECOND", 60)
+	v.SetDefault("RELIABLE_BUFFER_SIZE", 64)
+	v.SetDefault("READY_TIMEOUT_SEC", 10)
+	v.SetDefault("COUNTDOWN_SEC", 3)
+	v.SetDefault("MAX_SPECTATORS", 16)
+	v.SetDefault("SPECTATOR_DELAY_MS", 0)
+	v.SetDefault("CHAT_MAX_LENGTH", 200)
+	v.SetDefault("CHAT_RATE_LIMIT", 5)
+	v.SetDefault("CHAT_RATE_WINDOW_SEC", 5)
+	v.SetDefault("CHAT_HISTORY", 20)
+	v.SetDefault("CHAT_BLOCKED_WORDS", "")
+	v.SetDefault("DISCONNECT_GRACE_SEC", 10)
+	v.SetDefault("REMATCH_SEC", 10)
+	v.SetDefault("MATCH_TIME_LIMIT_SEC", 180)
+	v.SetDefault("SUDDEN_DEATH_SEC", 30)
+	v.SetDefault("SKILLS_FILE", "")
+	v.SetDefault("MAPS_DIR", "")
+	v.SetDefault("FIXED_POINT", false)
+	v.SetDefault("REPLAY_STORE", "file")
+	v.SetDefault("REPLAY_DIR", "replays")
+	v.SetDefault("REPLAY_TTL_HOURS", 72)
+	v.SetDefault("AI_DIFFICULTY", "normal")
+	v.SetDefault("AI_TAKEOVER", true)
+	v.SetDefault("BOT_FILL_SEC", 0)
+	v.SetDefault("ROOM_SHARDS", 0)
+	v.SetDefault("ROOM_STALL_MS", 2000)
+	v.SetDefault("CHECKPOINT_SEC", 5)
+	v.SetDefault("ADMIN_TOKEN", "")
 
 	cfg := Config{
-		HTTPAddr:        v.GetString("HTTP_ADDR"),
-		JWTSecret:       v.GetString("JWT_SECRET"),
-		RedisAddr:       v.GetString("REDIS_ADDR"),
-		RedisPassword:   v.GetString("REDIS_PASSWORD"),
-		RedisDB:         v.GetInt("REDIS_DB"),
-		MySQLDSN:        v.GetString("MYSQL_DSN"),
-		TickMS:          v.GetInt("TICK_MS"),
-		PlayersPerRoom:  v.GetInt("PLAYERS_PER_ROOM"),
-		ReconnectTTL:    time.Duration(v.GetInt("RECONNECT_TTL_SEC")) * time.Second,
-		LogLevel:        v.GetString("LOG_LEVEL"),
-		SendQueueSize:   v.GetInt("SEND_QUEUE_SIZE"),
-		ReadLimitBytes:  v.GetInt64("READ_LIMIT_BYTES"),
-		MatchQueueSize:  v.GetInt("MATCH_QUEUE_SIZE"),
-		MaxMsgPerSecond: v.GetInt("MAX_MSG_PER_SECOND"),
+		HTTPAddr:           v.GetString("HTTP_ADDR"),
+		JWTSecret:          v.GetString("JWT_SECRET"),
+		RedisAddr:          v.GetString("REDIS_ADDR"),
+		RedisPassword:      v.GetString("REDIS_PASSWORD"),
+		RedisDB:            v.GetInt("REDIS_DB"),
+		MySQLDSN:           v.GetString("MYSQL_DSN"),
+		TickMS:             v.GetInt("TICK_MS"),
+		PlayersPerRoom:     v.GetInt("PLAYERS_PER_ROOM"),
+		FriendlyFireModes:  strings.Split(v.GetString("FRIENDLY_FIRE_MODES"), ","),
+		ReconnectTTL:       time.Duration(v.GetInt("RECONNECT_TTL_SEC")) * time.Second,
+		IdentityTTL:        time.Duration(v.GetInt("IDENTITY_TTL_HOURS")) * time.Hour,
+		LogLevel:           v.GetString("LOG_LEVEL"),
+		SendQueueSize:      v.GetInt("SEND_QUEUE_SIZE"),
+		ReadLimitBytes:     v.GetInt64("READ_LIMIT_BYTES"),
+		MatchQueueSize:     v.GetInt("MATCH_QUEUE_SIZE"),
+		MaxMsgPerSecond:    v.GetInt("MAX_MSG_PER_SECOND"),
+		ReliableBufferSize: v.GetInt("RELIABLE_BUFFER_SIZE"),
+		ReadyTimeout:       time.Duration(v.GetInt("READY_TIMEOUT_SEC")) * time.Second,
+		Countdown:          time.Duration(v.GetInt("COUNTDOWN_SEC")) * time.Second,
+		MaxSpectators:      v.GetInt("MAX_SPECTATORS"),
+		SpectatorDelay:     time.Duration(v.GetInt("SPECTATOR_DELAY_MS")) * time.Millisecond,
+		ChatMaxLength:      v.GetInt("CHAT_MAX_LENGTH"),
+		ChatRateLimit:      v.GetInt("CHAT_RATE_LIMIT"),
+		ChatRateWindow:     time.Duration(v.GetInt("CHAT_RATE_WINDOW_SEC")) * time.Second,
+		ChatHistory:        v.GetInt("CHAT_HISTORY"),
+		ChatBlockedWords:   strings.Split(v.GetString("CHAT_BLOCKED_WORDS"), ","),
+		DisconnectGrace:    time.Duration(v.GetInt("DISCONNECT_GRACE_SEC")) * time.Second,
+		RematchWindow:      time.Duration(v.GetInt("REMATCH_SEC")) * time.Second,
+		MatchTimeLimit:     time.Duration(v.GetInt("MATCH_TIME_LIMIT_SEC")) * time.Second,
+		SuddenDeath:        time.Duration(v.GetInt("SUDDEN_DEATH_SEC")) * time.Second,
+		SkillsFile:         v.GetString("SKILLS_FILE"),
+		MapsDir:            v.GetString("MAPS_DIR"),
+		FixedPoint:         v.GetBool("FIXED_POINT"),
+		ReplayStore:        v.GetString("REPLAY_STORE"),
+		ReplayDir:          v.GetString("REPLAY_DIR"),
+		ReplayTTL:          time.Duration(v.GetInt("REPLAY_TTL_HOURS")) * time.Hour,
+		AIDifficulty:       v.GetString("AI_DIFFICULTY"),
+		AITakeOver:         v.GetBool("AI_TAKEOVER"),
+		BotFillAfter:       time.Duration(v.GetInt("BOT_FILL_SEC")) * time.Second,
+		RoomShards:         v.GetInt("ROOM_SHARDS"),
+		RoomStallAfter:     time.Duration(v.GetInt("ROOM_STALL_MS")) * time.Millisecond,
+		CheckpointEvery:    time.Duration(v.GetInt("CHECKPOINT_SEC")) * time.Second,
+		AdminToken:         v.GetString("ADMIN_TOKEN"),
 	}
 
 	return cfg, nil
@@ -0,0 +1,348 @@
+package lobby
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/room"
+	"miniarena/server/internal/session"
+)
+
+var (
+	ErrNotFound      = errors.New("room code not found")
+	ErrFull          = errors.New("room is full")
+	ErrNotFull       = errors.New("room is not full")
+	ErrNotHost       = errors.New("only the host can do that")
+	ErrNotInLobby    = errors.New("not in a private room")
+	ErrAlreadyJoined = errors.New("already in a private room")
+	ErrBusy          = errors.New("already queued or in a match")
+	ErrBadRules      = errors.New("invalid room rules")
+)
+
+const (
+	codeLength   = 6
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+	minPlayers       = 2
+	maxPlayers       = 8
+	maxHP            = 1000
+	minDamage        = 0.1
+	maxDamage        = 10
+	maxTimeLimitSecs = 3600
+)
+
+// Lobby is a host-owned private room waiting to start.
+type Lobby struct {
+	Code    string
+	Host    string
+	Players []string
+	Rules   battle.Rules
+}
+
+// Manager owns private lobbies. Players join with a short invite code and the
+// host starts the match once the lobby is full, bypassing matchmaking.
+type Manager struct {
+	mu       sync.Mutex
+	lobbies  map[string]*Lobby
+	byPlayer map[string]string
+	rooms    *room.Manager
+	sessions *session.Manager
+	tick     time.Duration
+	log      *zap.Logger
+	// random feeds invite codes.
+	random io.Reader
+}
+
+func NewManager(rooms *room.Manager, sessions *session.Manager, tick time.Duration, log *zap.Logger) *Manager {
+	return &Manager{
+		lobbies:  make(map[string]*Lobby),
+		byPlayer: make(map[string]string),
+		rooms:    rooms,
+		sessions: sessions,
+		tick:     tick,
+		log:      log,
+		random:   rand.Reader,
+	}
+}
+
+// InLobby reports whether the player is a member of a private lobby.
+func (m *Manager) InLobby(playerID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.byPlayer[playerID]
+	return ok
+}
+
+// Create opens a lobby hosted by playerID. Nil rules use the matchmaking
+// defaults.
+func (m *Manager) Create(playerID string, rules *protocol.RoomRules) error {
+	r := m.rooms.DefaultRules()
+	if rules != nil {
+		var err error
+		if r, err = m.toBattleRules(rules); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	if err := m.checkIdleLocked(playerID); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	code := m.newCodeLocked()
+	l := &Lobby{Code: code, Host: playerID, Players: []string{playerID}, Rules: r}
+	m.lobbies[code] = l
+	m.byPlayer[playerID] = code
+	state := m.stateLocked(l)
+	m.mu.Unlock()
+
+	m.broadcast(state)
+	return nil
+}
+
+func (m *Manager) Join(playerID, code string) error {
+	m.mu.Lock()
+	if err := m.checkIdleLocked(playerID); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	l := m.lobbies[code]
+	if l == nil {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	if len(l.Players) >= l.Rules.Players {
+		m.mu.Unlock()
+		return ErrFull
+	}
+	l.Players = append(l.Players, playerID)
+	m.byPlayer[playerID] = code
+	state := m.stateLocked(l)
+	m.mu.Unlock()
+
+	m.broadcast(state)
+	return nil
+}
+
+// Leave removes the player from its lobby. A leaving host hands the lobby to
+// the next member; the last member to leave closes it.
+func (m *Manager) Leave(playerID string) error {
+	m.mu.Lock()
+	l := m.lobbyLocked(playerID)
+	if l == nil {
+		m.mu.Unlock()
+		return ErrNotInLobby
+	}
+	delete(m.byPlayer, playerID)
+	for i, pid := range l.Players {
+		if pid == playerID {
+			l.Players = append(l.Players[:i], l.Players[i+1:]...)
+			break
+		}
+	}
+	var state *protocol.LobbyState
+	if len(l.Players) == 0 {
+		delete(m.lobbies, l.Code)
+	} else {
+		if l.Host == playerID {
+			l.Host = l.Players[0]
+		}
+		state = m.stateLocked(l)
+	}
+	m.mu.Unlock()
+
+	_ = m.sessions.Send(playerID, protocol.MsgLobbyState, &protocol.LobbyState{})
+	if state != nil {
+		m.broadcast(state)
+	}
+	return nil
+}
+
+// UpdateRules lets the host change the rules. Lowering the player count below
+// the current member count is rejected.
+func (m *Manager) UpdateRules(playerID string, rules *protocol.RoomRules) error {
+	if rules == nil {
+		return ErrBadRules
+	}
+	r, err := m.toBattleRules(rules)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	l := m.lobbyLocked(playerID)
+	if l == nil {
+		m.mu.Unlock()
+		return ErrNotInLobby
+	}
+	if l.Host != playerID {
+		m.mu.Unlock()
+		return ErrNotHost
+	}
+	if r.Players < len(l.Players) {
+		m.mu.Unlock()
+		return ErrBadRules
+	}
+	l.Rules = r
+	state := m.stateLocked(l)
+	m.mu.Unlock()
+
+	m.broadcast(state)
+	return nil
+}
+
+// Start creates the room for a full lobby and sends MatchResp to every
+// member.
+func (m *Manager) Start(playerID string) error {
+	m.mu.Lock()
+	l := m.lobbyLocked(playerID)
+	if l == nil {
+		m.mu.Unlock()
+		return ErrNotInLobby
+	}
+	if l.Host != playerID {
+		m.mu.Unlock()
+		return ErrNotHost
+	}
+	if len(l.Players) < l.Rules.Players {
+		m.mu.Unlock()
+		return ErrNotFull
+	}
+	delete(m.lobbies, l.Code)
+	for _, pid := range l.Players {
+		delete(m.byPlayer, pid)
+	}
+	m.mu.Unlock()
+
+	matchID := uuid.NewString()
+	rules := l.Rules
+	if rules.Map.ID == "" {
+		rules.Map = m.rooms.PickMap(len(l.Players))
+	}
+	spec := room.Spec{MatchID: matchID, Players: l.Players, Rules: rules}
+	roomID := m.rooms.CreateRoom(spec)
+	resp := &protocol.MatchResp{
+		MatchId: matchID,
+		RoomId:  roomID,
+		Players: l.Players,
+		MapId:   rules.Map.ID,
+		Teams:   spec.Teams(),
+	}
+	for _, pid := range l.Players {
+		m.sessions.SetRoom(pid, roomID)
+		_ = m.sessions.SendReliable(pid, protocol.MsgMatchResp, resp)
+	}
+	m.log.Info("private room started", zap.String("code", l.Code), zap.String("room", roomID))
+	return nil
+}
+
+// OnSessionEvent removes players whose session expired.
+func (m *Manager) OnSessionEvent(ev session.Event) {
+	if ev.Type == session.EventExpired {
+		_ = m.Leave(ev.PlayerID)
+	}
+}
+
+// checkIdleLocked rejects a player who is already in a lobby, queued or in
+// a match. It runs under m.mu, which the lobby is then added under: the
+// matcher marks a player queued before it asks InLobby, so one of the two
+// always sees the other.
+func (m *Manager) checkIdleLocked(playerID string) error {
+	if _, ok := m.byPlayer[playerID]; ok {
+		return ErrAlreadyJoined
+	}
+	sess, ok := m.sessions.Get(playerID)
+	if !ok {
+		return session.ErrNotFound
+	}
+	if _, roomID, queued := sess.Presence(); roomID != "" || queued {
+		return ErrBusy
+	}
+	return nil
+}
+
+func (m *Manager) lobbyLocked(playerID string) *Lobby {
+	code, ok := m.byPlayer[playerID]
+	if !ok {
+		return nil
+	}
+	return m.lobbies[code]
+}
+
+func (m *Manager) newCodeLocked() string {
+	buf := make([]byte, codeLength)
+	for {
+		_, _ = io.ReadFull(m.random, buf)
+		for i, b := range buf {
+			buf[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+		}
+		if _, taken := m.lobbies[string(buf)]; !taken {
+			return string(buf)
+		}
+	}
+}
+
+func (m *Manager) stateLocked(l *Lobby) *protocol.LobbyState {
+	return &protocol.LobbyState{
+		Code:    l.Code,
+		HostId:  l.Host,
+		Players: append([]string(nil), l.Players...),
+		Rules:   m.toProtoRules(l.Rules),
+	}
+}
+
+func (m *Manager) broadcast(state *protocol.LobbyState) {
+	m.sessions.Broadcast(state.Players, protocol.MsgLobbyState, state)
+}
+
+func (m *Manager) toBattleRules(r *protocol.RoomRules) (battle.Rules, error) {
+	if r.MaxHp < 1 || r.MaxHp > maxHP ||
+		r.DamageMultiplier < minDamage || r.DamageMultiplier > maxDamage ||
+		r.TimeLimitSec < 0 || r.TimeLimitSec > maxTimeLimitSecs ||
+		r.Players < minPlayers || r.Players > maxPlayers {
+		return battle.Rules{}, ErrBadRules
+	}
+	// Teams must split the room evenly, and into at least two.
+	if r.TeamSize >= 2 && (r.TeamSize*2 > r.Players || r.Players%r.TeamSize != 0) {
+		return battle.Rules{}, ErrBadRules
+	}
+	rules := m.rooms.DefaultRules()
+	rules.MaxHP = r.MaxHp
+	rules.DamageMultiplier = r.DamageMultiplier
+	// 0 plays without a time limit; nil rules are how a host keeps the
+	// server default.
+	rules.TimeLimitTicks = int64(time.Duration(r.TimeLimitSec) * time.Second / m.tick)
+	rules.Players = int(r.Players)
+	if r.TeamSize >= 2 {
+		rules.TeamSize = int(r.TeamSize)
+	}
+	rules.FriendlyFire = r.FriendlyFire
+	if r.MapId != "" {
+		mp, ok := m.rooms.Map(r.MapId)
+		if !ok || len(mp.Spawns) < rules.Players {
+			return battle.Rules{}, ErrBadRules
+		}
+		rules.Map = mp
+	}
+	return rules, nil
+}
+
+func (m *Manager) toProtoRules(r battle.Rules) *protocol.RoomRules {
+	return &protocol.RoomRules{
+		MaxHp:            r.MaxHP,
+		DamageMultiplier: r.DamageMultiplier,
+		TimeLimitSec:     int32(time.Duration(r.TimeLimitTicks) * m.tick / time.Second),
+		Players:          int32(r.Players),
+		MapId:            r.Map.ID,
+		TeamSize:         int32(r.TeamSize),
+		FriendlyFire:     r.FriendlyFire,
+	}
+}
@@ -0,0 +1,400 @@
+package lobby
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/room"
+	"miniarena/server/internal/session"
+	"miniarena/server/internal/store"
+)
+
+const testTick = 50 * time.Millisecond
+
+// lobbySender keeps the last LobbyState and MatchResp a player receives.
+type lobbySender struct {
+	mu    sync.Mutex
+	state *protocol.LobbyState
+	match *protocol.MatchResp
+}
+
+func (s *lobbySender) Send(data []byte) error {
+	env, err := protocol.DecodeEnvelope(data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch env.Type {
+	case protocol.MsgLobbyState:
+		s.state = &protocol.LobbyState{}
+		return proto.Unmarshal(env.Body, s.state)
+	case protocol.MsgMatchResp:
+		s.match = &protocol.MatchResp{}
+		return proto.Unmarshal(env.Body, s.match)
+	}
+	return nil
+}
+
+func (s *lobbySender) Close() error { return nil }
+
+func (s *lobbySender) lobby() *protocol.LobbyState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *lobbySender) matched() *protocol.MatchResp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.match
+}
+
+// newTestLobbies returns a lobby manager with a session for each player. The
+// server default time limit is 999 ticks and there is a two-spawn map,
+// "duel", besides the default one.
+func newTestLobbies(t *testing.T, players ...string) (*Manager, *session.Manager, map[string]*lobbySender) {
+	t.Helper()
+	log := zap.NewNop()
+	sessions := session.NewManager(time.Minute, 0, nil, log)
+	rules := battle.DefaultRules(2)
+	rules.TimeLimitTicks = 999
+	rooms := room.NewManager(room.Settings{
+		Tick:         time.Hour,
+		ReadyTimeout: time.Hour,
+		Rules:        rules,
+		Maps: []battle.Map{
+			battle.DefaultMap(),
+			{ID: "duel", MinX: -10, MinY: -10, MaxX: 10, MaxY: 10, Spawns: []battle.Point{{X: -5}, {X: 5}}},
+		},
+	}, sessions, store.NewMemoryIdem(), nil, log, room.Hooks{})
+	t.Cleanup(func() {
+		rooms.Stop()
+		sessions.Stop()
+	})
+
+	senders := make(map[string]*lobbySender, len(players))
+	for _, pid := range players {
+		senders[pid] = &lobbySender{}
+		sessions.Create(pid, pid, "", senders[pid])
+	}
+	return NewManager(rooms, sessions, testTick, log), sessions, senders
+}
+
+func roomRules(players int32) *protocol.RoomRules {
+	return &protocol.RoomRules{MaxHp: 100, DamageMultiplier: 1, TimeLimitSec: 60, Players: players}
+}
+
+// codeOf returns the invite code of the lobby the player is in.
+func codeOf(m *Manager, playerID string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.byPlayer[playerID]
+}
+
+func TestInviteCode(t *testing.T) {
+	m, _, _ := newTestLobbies(t, "h1", "h2")
+	// The second lobby draws the first one's code before a free one.
+	m.random = bytes.NewReader(append(make([]byte, 2*codeLength), bytes.Repeat([]byte{33}, codeLength)...))
+
+	for _, pid := range []string{"h1", "h2"} {
+		if err := m.Create(pid, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := codeOf(m, "h1"), "AAAAAA"; got != want {
+		t.Fatalf("first code %q, want %q", got, want)
+	}
+	if got, want := codeOf(m, "h2"), "BBBBBB"; got != want {
+		t.Fatalf("second code %q, want %q", got, want)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	cases := []struct {
+		name   string
+		setup  func(t *testing.T, m *Manager, sessions *session.Manager, code string)
+		player string
+		code   string
+		err    error
+		// members is who is in the lobby afterwards.
+		members []string
+	}{
+		{name: "joins", player: "a", members: []string{"h", "a"}},
+		{name: "unknown code", player: "a", code: "ZZZZZZ", err: ErrNotFound, members: []string{"h"}},
+		{
+			name: "full",
+			setup: func(t *testing.T, m *Manager, sessions *session.Manager, code string) {
+				if err := m.Join("a", code); err != nil {
+					t.Fatal(err)
+				}
+			},
+			player:  "b",
+			err:     ErrFull,
+			members: []string{"h", "a"},
+		},
+		{name: "already in it", player: "h", err: ErrAlreadyJoined, members: []string{"h"}},
+		{
+			name: "queued",
+			setup: func(t *testing.T, m *Manager, sessions *session.Manager, code string) {
+				sessions.SetQueued("a", true)
+			},
+			player:  "a",
+			err:     ErrBusy,
+			members: []string{"h"},
+		},
+		{
+			name: "in a match",
+			setup: func(t *testing.T, m *Manager, sessions *session.Manager, code string) {
+				sessions.SetRoom("a", "r1")
+			},
+			player:  "a",
+			err:     ErrBusy,
+			members: []string{"h"},
+		},
+		{name: "no session", player: "ghost", err: session.ErrNotFound, members: []string{"h"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, sessions, senders := newTestLobbies(t, "h", "a", "b")
+			if err := m.Create("h", roomRules(2)); err != nil {
+				t.Fatal(err)
+			}
+			code := codeOf(m, "h")
+			if tc.setup != nil {
+				tc.setup(t, m, sessions, code)
+			}
+			if tc.code != "" {
+				code = tc.code
+			}
+
+			if err := m.Join(tc.player, code); !errors.Is(err, tc.err) {
+				t.Fatalf("Join = %v, want %v", err, tc.err)
+			}
+			for _, pid := range tc.members {
+				if got := senders[pid].lobby(); got == nil || !reflect.DeepEqual(got.Players, tc.members) {
+					t.Fatalf("%s sees lobby %+v, want members %v", pid, got, tc.members)
+				}
+			}
+		})
+	}
+}
+
+func TestLeave(t *testing.T) {
+	cases := []struct {
+		name    string
+		leave   []string
+		err     error
+		host    string
+		members []string
+	}{
+		{name: "host hands over", leave: []string{"h"}, host: "a", members: []string{"a", "b"}},
+		{name: "member", leave: []string{"a"}, host: "h", members: []string{"h", "b"}},
+		{name: "last one closes it", leave: []string{"h", "a", "b"}},
+		{name: "not in a lobby", leave: []string{"c"}, err: ErrNotInLobby, host: "h", members: []string{"h", "a", "b"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _, senders := newTestLobbies(t, "h", "a", "b", "c")
+			if err := m.Create("h", roomRules(3)); err != nil {
+				t.Fatal(err)
+			}
+			code := codeOf(m, "h")
+			for _, pid := range []string{"a", "b"} {
+				if err := m.Join(pid, code); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var err error
+			for _, pid := range tc.leave {
+				err = m.Leave(pid)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Leave = %v, want %v", err, tc.err)
+			}
+			for _, pid := range tc.members {
+				got := senders[pid].lobby()
+				if got.HostId != tc.host || !reflect.DeepEqual(got.Players, tc.members) {
+					t.Fatalf("%s sees host %s, members %v; want %s, %v", pid, got.HostId, got.Players, tc.host, tc.members)
+				}
+			}
+			if tc.err == nil {
+				for _, pid := range tc.leave {
+					if got := senders[pid].lobby(); got.Code != "" || m.InLobby(pid) {
+						t.Fatalf("%s still sees lobby %+v after leaving", pid, got)
+					}
+				}
+			}
+			m.mu.Lock()
+			open := len(m.lobbies)
+			m.mu.Unlock()
+			if want := len(tc.members) > 0; (open == 1) != want || open > 1 {
+				t.Fatalf("%d lobbies open with members %v", open, tc.members)
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(r *protocol.RoomRules)
+		err    error
+		// ticks is the time limit the rules end up with.
+		ticks int64
+		mapID string
+	}{
+		{name: "valid", ticks: 1200},
+		{name: "no time limit", change: func(r *protocol.RoomRules) { r.TimeLimitSec = 0 }},
+		{name: "longest time limit", change: func(r *protocol.RoomRules) { r.TimeLimitSec = 3600 }, ticks: 72000},
+		{name: "negative time limit", change: func(r *protocol.RoomRules) { r.TimeLimitSec = -1 }, err: ErrBadRules},
+		{name: "time limit too long", change: func(r *protocol.RoomRules) { r.TimeLimitSec = 3601 }, err: ErrBadRules},
+		{name: "no HP", change: func(r *protocol.RoomRules) { r.MaxHp = 0 }, err: ErrBadRules},
+		{name: "too much HP", change: func(r *protocol.RoomRules) { r.MaxHp = 1001 }, err: ErrBadRules},
+		{name: "damage too low", change: func(r *protocol.RoomRules) { r.DamageMultiplier = 0.05 }, err: ErrBadRules},
+		{name: "damage too high", change: func(r *protocol.RoomRules) { r.DamageMultiplier = 11 }, err: ErrBadRules},
+		{name: "one player", change: func(r *protocol.RoomRules) { r.Players = 1 }, err: ErrBadRules},
+		{name: "nine players", change: func(r *protocol.RoomRules) { r.Players = 9 }, err: ErrBadRules},
+		{name: "two teams", change: func(r *protocol.RoomRules) { r.Players, r.TeamSize = 4, 2 }, ticks: 1200},
+		{name: "uneven teams", change: func(r *protocol.RoomRules) { r.Players, r.TeamSize = 3, 2 }, err: ErrBadRules},
+		{name: "one team", change: func(r *protocol.RoomRules) { r.Players, r.TeamSize = 2, 2 }, err: ErrBadRules},
+		{name: "known map", change: func(r *protocol.RoomRules) { r.MapId = "duel" }, ticks: 1200, mapID: "duel"},
+		{name: "unknown map", change: func(r *protocol.RoomRules) { r.MapId = "nope" }, err: ErrBadRules},
+		{name: "map too small", change: func(r *protocol.RoomRules) { r.MapId, r.Players = "duel", 3 }, err: ErrBadRules},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _, senders := newTestLobbies(t, "h")
+			rules := roomRules(2)
+			if tc.change != nil {
+				tc.change(rules)
+			}
+			err := m.Create("h", rules)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Create = %v, want %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			m.mu.Lock()
+			got := m.lobbyLocked("h").Rules
+			m.mu.Unlock()
+			if got.TimeLimitTicks != tc.ticks || got.Map.ID != tc.mapID {
+				t.Fatalf("time limit %d ticks, map %q; want %d, %q", got.TimeLimitTicks, got.Map.ID, tc.ticks, tc.mapID)
+			}
+			// Members see the rules as sent.
+			if state := senders["h"].lobby(); !proto.Equal(state.Rules, rules) {
+				t.Fatalf("members see rules %+v, want %+v", state.Rules, rules)
+			}
+		})
+	}
+}
+
+func TestDefaultRules(t *testing.T) {
+	m, _, _ := newTestLobbies(t, "h")
+	if err := m.Create("h", nil); err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	got := m.lobbyLocked("h").Rules
+	m.mu.Unlock()
+	if got.TimeLimitTicks != 999 {
+		t.Fatalf("time limit %d ticks, want the server default 999", got.TimeLimitTicks)
+	}
+}
+
+func TestUpdateRules(t *testing.T) {
+	cases := []struct {
+		name    string
+		player  string
+		players int32
+		err     error
+	}{
+		{name: "host", player: "h", players: 4},
+		{name: "not the host", player: "a", players: 4, err: ErrNotHost},
+		{name: "fewer seats than members", player: "h", players: 2, err: ErrBadRules},
+		{name: "not in a lobby", player: "b", players: 4, err: ErrNotInLobby},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _, senders := newTestLobbies(t, "h", "a", "b", "c")
+			if err := m.Create("h", roomRules(3)); err != nil {
+				t.Fatal(err)
+			}
+			for _, pid := range []string{"a", "c"} {
+				if err := m.Join(pid, codeOf(m, "h")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := m.UpdateRules(tc.player, roomRules(tc.players)); !errors.Is(err, tc.err) {
+				t.Fatalf("UpdateRules = %v, want %v", err, tc.err)
+			}
+			want := int32(3)
+			if tc.err == nil {
+				want = tc.players
+			}
+			if got := senders["a"].lobby().Rules.Players; got != want {
+				t.Fatalf("members see %d seats, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	cases := []struct {
+		name    string
+		members []string
+		player  string
+		err     error
+	}{
+		{name: "full", members: []string{"h", "a", "b"}, player: "h"},
+		{name: "not full", members: []string{"h", "a"}, player: "h", err: ErrNotFull},
+		{name: "not the host", members: []string{"h", "a", "b"}, player: "a", err: ErrNotHost},
+		{name: "not in a lobby", members: []string{"h", "a"}, player: "b", err: ErrNotInLobby},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, sessions, senders := newTestLobbies(t, "h", "a", "b")
+			rules := roomRules(3)
+			rules.TeamSize = 0
+			if err := m.Create("h", rules); err != nil {
+				t.Fatal(err)
+			}
+			for _, pid := range tc.members[1:] {
+				if err := m.Join(pid, codeOf(m, "h")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := m.Start(tc.player); !errors.Is(err, tc.err) {
+				t.Fatalf("Start = %v, want %v", err, tc.err)
+			}
+			for _, pid := range tc.members {
+				resp := senders[pid].matched()
+				if (resp != nil) != (tc.err == nil) || m.InLobby(pid) != (tc.err != nil) {
+					t.Fatalf("%s matched %+v, in lobby %v", pid, resp, m.InLobby(pid))
+				}
+				if resp == nil {
+					continue
+				}
+				if !reflect.DeepEqual(resp.Players, tc.members) {
+					t.Fatalf("%s matched with %v, want %v", pid, resp.Players, tc.members)
+				}
+				if sess, _ := sessions.Get(pid); sess.GetRoomID() != resp.RoomId {
+					t.Fatalf("%s session is in room %q, want %q", pid, sess.GetRoomID(), resp.RoomId)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package match
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,92 +13,272 @@ import (
 	"miniarena/server/internal/session"
 )
 
+var (
+	ErrUnknownMode = errors.New("unknown mode")
+	ErrQueueFull   = errors.New("match queue full")
+)
+
+// DefaultMode is the free-for-all queue, used when MatchReq names no mode.
+const DefaultMode = "default"
+
+// Mode is a matchmaking queue and the kind of match it makes.
+type Mode struct {
+	Name    string
+	Players int
+	// TeamSize of 2 or more plays the match in teams of that size.
+	TeamSize     int
+	FriendlyFire bool
+}
+
+// Modes returns the queues the server offers: the free-for-all with
+// playersPerRoom seats, 2v2 and 3v3. Friendly fire is on in the modes named
+// in friendlyFire.
+func Modes(playersPerRoom int, friendlyFire []string) []Mode {
+	modes := []Mode{
+		{Name: DefaultMode, Players: playersPerRoom},
+		{Name: "2v2", Players: 4, TeamSize: 2},
+		{Name: "3v3", Players: 6, TeamSize: 3},
+	}
+	for i := range modes {
+		for _, name := range friendlyFire {
+			if name == modes[i].Name {
+				modes[i].FriendlyFire = true
+			}
+		}
+	}
+	return modes
+}
+
+type queued struct {
+	playerID string
+	mode     string
+}
+
+// Matcher keeps a queue per mode. A player waits in one queue at a time.
 type Matcher struct {
-	enqueueCh      chan string
-	playersPerRoom int
-	enqueuedAt     map[string]time.Time
-	roomMgr        *room.Manager
-	sessionMgr     *session.Manager
-	metrics        *metrics.Metrics
-	log            *zap.Logger
+	enqueueCh chan queued
+	cancelCh  chan string
+	modes     map[string]Mode
+	// botFillAfter is how long the oldest queued player waits before the
+	// remaining seats go to bots; 0 disables bot fill.
+	botFillAfter time.Duration
+	enqueuedAt   map[string]time.Time
+	// modeOf is the queue each waiting player is in.
+	modeOf     map[string]string
+	roomMgr    *room.Manager
+	sessionMgr *session.Manager
+	// inLobby reports players in a private room, who may not queue; nil
+	// allows everyone.
+	inLobby func(playerID string) bool
+	metrics *metrics.Metrics
+	log     *zap.Logger
 }
 
-func NewMatcher(playersPerRoom int, queueSize int, roomMgr *room.Manager, sessionMgr *session.Manager, metrics *metrics.Metrics, log *zap.Logger) *Matcher {
+func NewMatcher(modes []Mode, queueSize int, botFillAfter time.Duration, roomMgr *room.Manager, sessionMgr *session.Manager, inLobby func(playerID string) bool, metrics *metrics.Metrics, log *zap.Logger) *Matcher {
 	m := &Matcher{
-		enqueueCh:      make(chan string, queueSize),
-		playersPerRoom: playersPerRoom,
-		enqueuedAt:     make(map[string]time.Time),
-		roomMgr:        roomMgr,
-		sessionMgr:     sessionMgr,
-		metrics:        metrics,
-		log:            log,
+		enqueueCh:    make(chan queued, queueSize),
+		cancelCh:     make(chan string, queueSize),
+		modes:        make(map[string]Mode, len(modes)),
+		botFillAfter: botFillAfter,
+		enqueuedAt:   make(map[string]time.Time),
+		modeOf:       make(map[string]string),
+		roomMgr:      roomMgr,
+		sessionMgr:   sessionMgr,
+		inLobby:      inLobby,
+		metrics:      metrics,
+		log:          log,
+	}
+	for _, mode := range modes {
+		m.modes[mode.Name] = mode
 	}
 	go m.loop()
 	return m
 }
 
-func (m *Matcher) Enqueue(playerID string) bool {
+// Enqueue puts playerID in the queue for mode, or the default queue if mode
+// is empty.
+func (m *Matcher) Enqueue(playerID, mode string) error {
+	if mode == "" {
+		mode = DefaultMode
+	}
+	if _, ok := m.modes[mode]; !ok {
+		return ErrUnknownMode
+	}
 	select {
-	case m.enqueueCh <- playerID:
-		return true
+	case m.enqueueCh <- queued{playerID: playerID, mode: mode}:
+		return nil
 	default:
-		return false
+		return ErrQueueFull
+	}
+}
+
+// Cancel removes playerID from the queue if it is still waiting.
+func (m *Matcher) Cancel(playerID string) {
+	select {
+	case m.cancelCh <- playerID:
+	default:
+		m.log.Warn("match cancel dropped", zap.String("player", playerID))
+	}
+}
+
+// OnSessionEvent dequeues players whose connection is gone.
+func (m *Matcher) OnSessionEvent(ev session.Event) {
+	switch ev.Type {
+	case session.EventDisconnected, session.EventExpired:
+		m.Cancel(ev.PlayerID)
 	}
 }
 
 func (m *Matcher) loop() {
-	queue := make([]string, 0, m.playersPerRoom*2)
-	for pid := range m.enqueueCh {
-		if _, ok := m.enqueuedAt[pid]; ok {
-			continue
+	queues := make(map[string][]string, len(m.modes))
+	var fillC <-chan time.Time
+	if m.botFillAfter > 0 {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		fillC = ticker.C
+	}
+	for {
+		select {
+		case q := <-m.enqueueCh:
+			queues[q.mode] = m.enqueue(m.modes[q.mode], queues[q.mode], q.playerID)
+		case pid := <-m.cancelCh:
+			if mode, ok := m.modeOf[pid]; ok {
+				queues[mode] = m.dequeue(queues[mode], pid)
+			}
+		case <-fillC:
+			for mode, queue := range queues {
+				queues[mode] = m.fillWithBots(m.modes[mode], queue)
+			}
 		}
-		m.enqueuedAt[pid] = time.Now()
-		queue = append(queue, pid)
-		if m.metrics != nil {
-			m.metrics.MatchQueueGauge.Set(float64(len(queue)))
+		m.setQueueGauge(queues)
+	}
+}
+
+func (m *Matcher) setQueueGauge(queues map[string][]string) {
+	if m.metrics == nil {
+		return
+	}
+	n := 0
+	for _, queue := range queues {
+		n += len(queue)
+	}
+	m.metrics.MatchQueueGauge.Set(float64(n))
+}
+
+// forget drops a player who left the queue for good.
+func (m *Matcher) forget(pid string) {
+	delete(m.enqueuedAt, pid)
+	delete(m.modeOf, pid)
+	m.sessionMgr.SetQueued(pid, false)
+}
+
+func (m *Matcher) dequeue(queue []string, pid string) []string {
+	m.forget(pid)
+	for i, p := range queue {
+		if p == pid {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
 		}
+	}
+	return queue
+}
 
-		for len(queue) >= m.playersPerRoom {
-			players := make([]string, 0, m.playersPerRoom)
-			for len(queue) > 0 && len(players) < m.playersPerRoom {
-				p := queue[0]
-				queue = queue[1:]
-				if m.sessionMgr.IsOnline(p) {
-					players = append(players, p)
-				} else {
-					delete(m.enqueuedAt, p)
-				}
-			}
+func (m *Matcher) enqueue(mode Mode, queue []string, pid string) []string {
+	if _, ok := m.enqueuedAt[pid]; ok {
+		return queue
+	}
+	m.enqueuedAt[pid] = time.Now()
+	m.modeOf[pid] = mode.Name
+	m.sessionMgr.SetQueued(pid, true)
+	// The player is marked queued before the lobby check, and a lobby checks
+	// for a queued player under the lock it adds members under, so a private
+	// room joined meanwhile is seen here or sees the queue.
+	if m.inLobby != nil && m.inLobby(pid) {
+		m.forget(pid)
+		_ = m.sessionMgr.Send(pid, protocol.MsgErrorResp, &protocol.ErrorResp{Code: 409, Message: "in a private room"})
+		return queue
+	}
+	queue = append(queue, pid)
 
-			if len(players) < m.playersPerRoom {
-				queue = append(players, queue...)
-				if m.metrics != nil {
-					m.metrics.MatchQueueGauge.Set(float64(len(queue)))
-				}
-				break
+	for len(queue) >= mode.Players {
+		players := make([]string, 0, mode.Players)
+		for len(queue) > 0 && len(players) < mode.Players {
+			p := queue[0]
+			queue = queue[1:]
+			if m.sessionMgr.IsOnline(p) {
+				players = append(players, p)
+			} else {
+				m.forget(p)
 			}
+		}
 
-			if m.metrics != nil {
-				m.metrics.MatchQueueGauge.Set(float64(len(queue)))
-			}
+		if len(players) < mode.Players {
+			queue = append(players, queue...)
+			break
+		}
+		m.startMatch(mode, players, nil)
+	}
+	return queue
+}
+
+// fillWithBots starts a match for everyone still queued once the oldest of
+// them has waited botFillAfter, giving the empty seats to bots.
+func (m *Matcher) fillWithBots(mode Mode, queue []string) []string {
+	if len(queue) == 0 || time.Since(m.enqueuedAt[queue[0]]) < m.botFillAfter {
+		return queue
+	}
+	var players []string
+	for _, p := range queue {
+		if m.sessionMgr.IsOnline(p) {
+			players = append(players, p)
+		} else {
+			m.forget(p)
+		}
+	}
+	if len(players) == 0 {
+		return queue[:0]
+	}
+	bots := make([]string, 0, mode.Players-len(players))
+	for len(players)+len(bots) < mode.Players {
+		bots = append(bots, room.NewBotID())
+	}
+	if m.metrics != nil {
+		m.metrics.BotSeats.Add(float64(len(bots)))
+	}
+	m.log.Info("filling match with bots", zap.String("mode", mode.Name), zap.Int("players", len(players)), zap.Int("bots", len(bots)))
+	m.startMatch(mode, players, bots)
+	return queue[:0]
+}
 
-			matchID := uuid.NewString()
-			roomID := m.roomMgr.CreateRoom(matchID, players)
-			for _, p := range players {
-				m.sessionMgr.SetRoom(p, roomID)
-				if ts, ok := m.enqueuedAt[p]; ok {
-					if m.metrics != nil {
-						m.metrics.MatchDuration.Observe(float64(time.Since(ts).Milliseconds()))
-					}
-					delete(m.enqueuedAt, p)
-				}
-				resp := &protocol.MatchResp{
-					MatchId: matchID,
-					RoomId:  roomID,
-					Players: players,
-				}
-				_ = m.sessionMgr.Send(p, protocol.MsgMatchResp, resp)
+func (m *Matcher) startMatch(mode Mode, players, bots []string) {
+	matchID := uuid.NewString()
+	rules := m.roomMgr.DefaultRules()
+	rules.Players = mode.Players
+	rules.TeamSize = mode.TeamSize
+	rules.FriendlyFire = mode.FriendlyFire
+	rules.Map = m.roomMgr.PickMap(len(players) + len(bots))
+	spec := room.Spec{
+		MatchID: matchID,
+		Players: players,
+		Bots:    bots,
+		Rules:   rules,
+	}
+	roomID := m.roomMgr.CreateRoom(spec)
+	resp := &protocol.MatchResp{
+		MatchId: matchID,
+		RoomId:  roomID,
+		Players: append(append([]string(nil), players...), bots...),
+		MapId:   rules.Map.ID,
+		Teams:   spec.Teams(),
+	}
+	for _, p := range players {
+		m.sessionMgr.SetRoom(p, roomID)
+		if ts, ok := m.enqueuedAt[p]; ok {
+			if m.metrics != nil {
+				m.metrics.MatchDuration.Observe(float64(time.Since(ts).Milliseconds()))
 			}
 		}
+		m.forget(p)
+		_ = m.sessionMgr.SendReliable(p, protocol.MsgMatchResp, resp)
 	}
 }
@@ -0,0 +1,208 @@
+package match
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/room"
+	"miniarena/server/internal/session"
+	"miniarena/server/internal/store"
+)
+
+// matchSender keeps the MatchResp a player's connection receives.
+type matchSender struct {
+	mu   sync.Mutex
+	resp *protocol.MatchResp
+}
+
+func (s *matchSender) Send(data []byte) error {
+	env, err := protocol.DecodeEnvelope(data)
+	if err != nil || env.Type != protocol.MsgMatchResp {
+		return err
+	}
+	var resp protocol.MatchResp
+	if err := proto.Unmarshal(env.Body, &resp); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.resp = &resp
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *matchSender) Close() error { return nil }
+
+func (s *matchSender) matched() *protocol.MatchResp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resp
+}
+
+func TestModes(t *testing.T) {
+	cases := []struct {
+		name         string
+		friendlyFire []string
+		want         []Mode
+	}{
+		{
+			name: "defaults",
+			want: []Mode{{Name: DefaultMode, Players: 3}, {Name: "2v2", Players: 4, TeamSize: 2}, {Name: "3v3", Players: 6, TeamSize: 3}},
+		},
+		{
+			name:         "friendly fire in 3v3",
+			friendlyFire: []string{"3v3", "nope"},
+			want:         []Mode{{Name: DefaultMode, Players: 3}, {Name: "2v2", Players: 4, TeamSize: 2}, {Name: "3v3", Players: 6, TeamSize: 3, FriendlyFire: true}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Modes(3, tc.friendlyFire); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Modes() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	cases := []struct {
+		name    string
+		mode    string
+		queue   []string
+		offline []string
+		// lobby holds players in a private room.
+		lobby []string
+		// fill lets the bot fill run after the queue is in.
+		fill bool
+		// matched maps each matched player to the seats of their match,
+		// with bots as "bot".
+		matched map[string][]string
+		teams   []int32
+		left    int
+	}{
+		{
+			name:    "full free-for-all",
+			mode:    DefaultMode,
+			queue:   []string{"a", "b"},
+			matched: map[string][]string{"a": {"a", "b"}, "b": {"a", "b"}},
+		},
+		{
+			name:  "not enough players",
+			mode:  "2v2",
+			queue: []string{"a", "b", "c"},
+			left:  3,
+		},
+		{
+			name:    "offline players are skipped",
+			mode:    DefaultMode,
+			queue:   []string{"a", "b", "c"},
+			offline: []string{"a"},
+			matched: map[string][]string{"b": {"b", "c"}, "c": {"b", "c"}},
+		},
+		{
+			name:    "players in a private room are turned away",
+			mode:    DefaultMode,
+			queue:   []string{"a", "b", "c"},
+			lobby:   []string{"b"},
+			matched: map[string][]string{"a": {"a", "c"}, "c": {"a", "c"}},
+		},
+		{
+			name:    "teams fill in queue order",
+			mode:    "2v2",
+			queue:   []string{"a", "b", "c", "d", "e"},
+			matched: map[string][]string{"a": {"a", "b", "c", "d"}, "b": {"a", "b", "c", "d"}, "c": {"a", "b", "c", "d"}, "d": {"a", "b", "c", "d"}},
+			teams:   []int32{1, 1, 2, 2},
+			left:    1,
+		},
+		{
+			name:    "bots fill the empty seats",
+			mode:    "2v2",
+			queue:   []string{"a"},
+			fill:    true,
+			matched: map[string][]string{"a": {"a", "bot", "bot", "bot"}},
+			teams:   []int32{1, 1, 2, 2},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			log := zap.NewNop()
+			sessions := session.NewManager(time.Minute, 0, nil, log)
+			defer sessions.Stop()
+			rooms := room.NewManager(room.Settings{
+				Tick:         time.Hour,
+				ReadyTimeout: time.Hour,
+				Rules:        battle.DefaultRules(2),
+			}, sessions, store.NewMemoryIdem(), nil, log, room.Hooks{})
+			defer rooms.Stop()
+			inLobby := func(pid string) bool {
+				for _, p := range tc.lobby {
+					if p == pid {
+						return true
+					}
+				}
+				return false
+			}
+			m := NewMatcher(Modes(2, nil), 16, time.Nanosecond, rooms, sessions, inLobby, nil, log)
+
+			senders := make(map[string]*matchSender)
+			for _, pid := range tc.queue {
+				senders[pid] = &matchSender{}
+				sessions.Create(pid, pid, "", senders[pid])
+			}
+			for _, pid := range tc.offline {
+				sessions.MarkOffline(pid, senders[pid])
+			}
+
+			// The test drives the queue itself instead of through the
+			// matcher's loop.
+			mode := m.modes[tc.mode]
+			var queue []string
+			for _, pid := range tc.queue {
+				queue = m.enqueue(mode, queue, pid)
+			}
+			if tc.fill {
+				queue = m.fillWithBots(mode, queue)
+			}
+
+			if len(queue) != tc.left {
+				t.Fatalf("%d left in the queue, want %d", len(queue), tc.left)
+			}
+			for _, pid := range tc.queue {
+				resp := senders[pid].matched()
+				want, ok := tc.matched[pid]
+				if (resp != nil) != ok {
+					t.Fatalf("%s matched = %v, want %v", pid, resp != nil, ok)
+				}
+				if resp == nil {
+					continue
+				}
+				seats := make([]string, len(resp.Players))
+				for i, p := range resp.Players {
+					seats[i] = p
+					if strings.HasPrefix(p, "bot-") {
+						seats[i] = "bot"
+					}
+				}
+				if !reflect.DeepEqual(seats, want) || !reflect.DeepEqual(resp.Teams, tc.teams) {
+					t.Fatalf("%s got seats %v teams %v, want %v %v", pid, seats, resp.Teams, want, tc.teams)
+				}
+				if sess, _ := sessions.Get(pid); sess.GetRoomID() != resp.RoomId {
+					t.Fatalf("%s session is in room %q, want %q", pid, sess.GetRoomID(), resp.RoomId)
+				}
+			}
+			for _, pid := range tc.lobby {
+				sess, _ := sessions.Get(pid)
+				if _, _, queued := sess.Presence(); queued {
+					t.Fatalf("%s is queued while in a private room", pid)
+				}
+			}
+		})
+	}
+}
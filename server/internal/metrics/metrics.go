@@ -8,13 +8,29 @@ import (
 )
 
 type Metrics struct {
-	OnlineGauge      prometheus.Gauge
-	MatchQueueGauge  prometheus.Gauge
-	MatchDuration    prometheus.Histogram
-	RoomTickDelay    prometheus.Histogram
-	SendBytes        prometheus.Counter
-	RecvBytes        prometheus.Counter
-	DroppedMessages  prometheus.Counter
+	OnlineGauge       prometheus.Gauge
+	MatchQueueGauge   prometheus.Gauge
+	MatchDuration     prometheus.Histogram
+	RoomTickDelay     prometheus.Histogram
+	SendBytes         prometheus.Counter
+	RecvBytes         prometheus.Counter
+	DroppedMessages   prometheus.Counter
+	ReliableOverflow  prometheus.Counter
+	ReliableReplayed  prometheus.Counter
+	SessionEvents     *prometheus.CounterVec
+	ChatMessages      prometheus.Counter
+	ChatMasked        prometheus.Counter
+	ChatRejected      *prometheus.CounterVec
+	BotSeats          prometheus.Counter
+	MatchResults      *prometheus.CounterVec
+	PlayerDamage      prometheus.Histogram
+	SkillsCast        prometheus.Counter
+	SkillsLanded      prometheus.Counter
+	PlayerTimeAlive   prometheus.Histogram
+	RoomPanics        *prometheus.CounterVec
+	RoomEventsDropped *prometheus.CounterVec
+	RoomStalls        prometheus.Counter
+	StalledRooms      prometheus.Gauge
 }
 
 func NewMetrics() *Metrics {
@@ -43,7 +59,7 @@ func NewMetrics() *Metrics {
 			Subsystem: "room",
 			Name:      "tick_delay_ms",
 			Help:      "Room tick delay in ms",
-			Buckets:   []float64{1, 2, 5, 10, 20, 50, 100},
+			Buckets:   []float64{0.25, 0.5, 1, 2, 5, 10, 20, 50, 100},
 		}),
 		SendBytes: prometheus.NewCounter(prometheus.CounterOpts{
 			Namespace: "arena",
@@ -63,6 +79,104 @@ func NewMetrics() *Metrics {
 			Name:      "dropped_messages_total",
 			Help:      "Dropped outbound messages due to backpressure",
 		}),
+		ReliableOverflow: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "net",
+			Name:      "reliable_overflow_total",
+			Help:      "Unacknowledged reliable messages evicted from a full retransmit buffer",
+		}),
+		ReliableReplayed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "net",
+			Name:      "reliable_replayed_total",
+			Help:      "Reliable messages resent after reconnect or a missed ack",
+		}),
+		SessionEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "sessions",
+			Name:      "events_total",
+			Help:      "Session lifecycle events by type",
+		}, []string{"type"}),
+		ChatMessages: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "chat",
+			Name:      "messages_total",
+			Help:      "Chat messages relayed to rooms",
+		}),
+		ChatMasked: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "chat",
+			Name:      "masked_total",
+			Help:      "Chat messages with blocked words masked",
+		}),
+		ChatRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "chat",
+			Name:      "rejected_total",
+			Help:      "Chat messages rejected by reason",
+		}, []string{"reason"}),
+		BotSeats: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "match",
+			Name:      "bot_seats_total",
+			Help:      "Match seats filled by bots",
+		}),
+		MatchResults: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "match",
+			Name:      "results_total",
+			Help:      "Finished matches by outcome",
+		}, []string{"outcome"}),
+		PlayerDamage: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "arena",
+			Subsystem: "match",
+			Name:      "player_damage",
+			Help:      "Damage dealt per player per match",
+			Buckets:   []float64{0, 10, 25, 50, 100, 200, 400},
+		}),
+		SkillsCast: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "match",
+			Name:      "skills_cast_total",
+			Help:      "Skills cast in finished matches",
+		}),
+		SkillsLanded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "match",
+			Name:      "skills_landed_total",
+			Help:      "Skills that hit in finished matches",
+		}),
+		PlayerTimeAlive: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "arena",
+			Subsystem: "match",
+			Name:      "player_alive_seconds",
+			Help:      "Time each player stayed alive per match",
+			Buckets:   []float64{10, 30, 60, 120, 180, 300},
+		}),
+		RoomPanics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "room",
+			Name:      "panics_total",
+			Help:      "Panics recovered in room loops by where they happened",
+		}, []string{"in"}),
+		RoomEventsDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "room",
+			Name:      "events_dropped_total",
+			Help:      "Room events dropped because their lane was full, by type",
+		}, []string{"type"}),
+		RoomStalls: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "arena",
+			Subsystem: "room",
+			Name:      "stalls_total",
+			Help:      "Rooms flagged by the watchdog for not ticking",
+		}),
+		StalledRooms: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "arena",
+			Subsystem: "room",
+			Name:      "stalled",
+			Help:      "Rooms currently not ticking",
+		}),
 	}
 
 	prometheus.MustRegister(
@@ -73,6 +187,22 @@ func NewMetrics() *Metrics {
 		m.SendBytes,
 		m.RecvBytes,
 		m.DroppedMessages,
+		m.ReliableOverflow,
+		m.ReliableReplayed,
+		m.SessionEvents,
+		m.ChatMessages,
+		m.ChatMasked,
+		m.ChatRejected,
+		m.BotSeats,
+		m.MatchResults,
+		m.PlayerDamage,
+		m.SkillsCast,
+		m.SkillsLanded,
+		m.PlayerTimeAlive,
+		m.RoomPanics,
+		m.RoomEventsDropped,
+		m.RoomStalls,
+		m.StalledRooms,
 	)
 
 	return m
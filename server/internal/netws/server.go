@@ -1,7 +1,9 @@
 package netws
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
@@ -12,10 +14,13 @@ import (
 	"miniarena/pkg/protocol"
 	"miniarena/server/internal/auth"
 	"miniarena/server/internal/config"
+	"miniarena/server/internal/lobby"
 	"miniarena/server/internal/match"
 	"miniarena/server/internal/metrics"
 	"miniarena/server/internal/room"
 	"miniarena/server/internal/session"
+	"miniarena/server/internal/social"
+	"miniarena/server/internal/store"
 )
 
 type Server struct {
@@ -27,9 +32,11 @@ type Server struct {
 	sessions *session.Manager
 	matcher  *match.Matcher
 	rooms    *room.Manager
+	social   *social.Service
+	lobbies  *lobby.Manager
 }
 
-func NewServer(cfg config.Config, log *zap.Logger, metrics *metrics.Metrics, auth *auth.Manager, sessions *session.Manager, matcher *match.Matcher, rooms *room.Manager) *Server {
+func NewServer(cfg config.Config, log *zap.Logger, metrics *metrics.Metrics, auth *auth.Manager, sessions *session.Manager, matcher *match.Matcher, rooms *room.Manager, social *social.Service, lobbies *lobby.Manager) *Server {
 	return &Server{
 		cfg:     cfg,
 		log:     log,
@@ -45,6 +52,8 @@ func NewServer(cfg config.Config, log *zap.Logger, metrics *metrics.Metrics, aut
 		sessions: sessions,
 		matcher:  matcher,
 		rooms:    rooms,
+		social:   social,
+		lobbies:  lobbies,
 	}
 }
 
@@ -63,12 +72,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	client.CloseSend()
 	_ = client.Close()
 	if pid := client.PlayerID(); pid != "" {
-		if sess, ok := s.sessions.Get(pid); ok {
-			if roomID := sess.GetRoomID(); roomID != "" {
-				s.rooms.SendEvent(roomID, room.Event{Type: room.EventLeave, PlayerID: pid})
-			}
-		}
-		s.sessions.MarkOffline(pid)
+		s.sessions.MarkOffline(pid, client)
 	}
 }
 
@@ -113,8 +117,29 @@ func (s *Server) handleMessage(c *Client, data []byte) {
 	}
 
 	switch env.Type {
+	case protocol.MsgAck:
+		var ack protocol.Ack
+		if err := proto.Unmarshal(env.Body, &ack); err != nil {
+			s.sendError(c, 400, "bad ack")
+			return
+		}
+		s.sessions.Ack(playerID, ack.Seq)
 	case protocol.MsgMatchReq:
-		s.handleMatch(playerID)
+		var req protocol.MatchReq
+		if err := proto.Unmarshal(env.Body, &req); err != nil {
+			s.sendError(c, 400, "bad match request")
+			return
+		}
+		s.handleMatch(playerID, req.Mode)
+	case protocol.MsgSpectateReq:
+		var req protocol.SpectateReq
+		if err := proto.Unmarshal(env.Body, &req); err != nil {
+			s.sendError(c, 400, "bad spectate")
+			return
+		}
+		s.handleSpectate(c, playerID, req.RoomId)
+	case protocol.MsgPlayerReady:
+		s.forwardEvent(playerID, room.Event{Type: room.EventReady, PlayerID: playerID})
 	case protocol.MsgPlayerInput:
 		var input protocol.PlayerInput
 		if err := proto.Unmarshal(env.Body, &input); err != nil {
@@ -129,6 +154,82 @@ func (s *Server) handleMessage(c *Client, data []byte) {
 			return
 		}
 		s.forwardSkill(playerID, &skill)
+	case protocol.MsgRematchVote:
+		var vote protocol.RematchVote
+		if err := proto.Unmarshal(env.Body, &vote); err != nil {
+			s.sendError(c, 400, "bad rematch vote")
+			return
+		}
+		s.forwardEvent(playerID, room.Event{Type: room.EventRematchVote, PlayerID: playerID, Accept: vote.Accept})
+	case protocol.MsgChatSend:
+		var req protocol.ChatSend
+		if err := proto.Unmarshal(env.Body, &req); err != nil {
+			s.sendError(c, 400, "bad chat")
+			return
+		}
+		s.forwardChat(playerID, req.Text)
+	case protocol.MsgFriendAddReq:
+		var req protocol.FriendAddReq
+		if err := proto.Unmarshal(env.Body, &req); err != nil {
+			s.sendError(c, 400, "bad friend request")
+			return
+		}
+		s.replySocial(c, s.social.AddFriend(playerID, req.PlayerId))
+	case protocol.MsgFriendAcceptReq:
+		var req protocol.FriendAcceptReq
+		if err := proto.Unmarshal(env.Body, &req); err != nil {
+			s.sendError(c, 400, "bad friend accept")
+			return
+		}
+		s.replySocial(c, s.social.AcceptFriend(playerID, req.PlayerId))
+	case protocol.MsgFriendRemoveReq:
+		var req protocol.FriendRemoveReq
+		if err := proto.Unmarshal(env.Body, &req); err != nil {
+			s.sendError(c, 400, "bad friend remove")
+			return
+		}
+		s.replySocial(c, s.social.RemoveFriend(playerID, req.PlayerId))
+	case protocol.MsgFriendListReq:
+		s.replySocial(c, s.social.SendFriendList(playerID))
+	case protocol.MsgPresenceSubReq:
+		var req protocol.PresenceSubReq
+		if err := proto.Unmarshal(env.Body, &req); err != nil {
+			s.sendError(c, 400, "bad presence subscribe")
+			return
+		}
+		s.replySocial(c, s.social.Subscribe(playerID, req.PlayerIds))
+	case protocol.MsgCreateRoomReq:
+		var req protocol.CreateRoomReq
+		if err := proto.Unmarshal(env.Body, &req); err != nil {
+			s.sendError(c, 400, "bad create room")
+			return
+		}
+		s.replyLobby(c, s.lobbies.Create(playerID, req.Rules))
+	case protocol.MsgJoinRoomReq:
+		var req protocol.JoinRoomReq
+		if err := proto.Unmarshal(env.Body, &req); err != nil {
+			s.sendError(c, 400, "bad join room")
+			return
+		}
+		s.replyLobby(c, s.lobbies.Join(playerID, strings.ToUpper(req.Code)))
+	case protocol.MsgLeaveRoomReq:
+		s.replyLobby(c, s.lobbies.Leave(playerID))
+	case protocol.MsgUpdateRulesReq:
+		var req protocol.UpdateRulesReq
+		if err := proto.Unmarshal(env.Body, &req); err != nil {
+			s.sendError(c, 400, "bad update rules")
+			return
+		}
+		s.replyLobby(c, s.lobbies.UpdateRules(playerID, req.Rules))
+	case protocol.MsgStartRoomReq:
+		s.replyLobby(c, s.lobbies.Start(playerID))
+	case protocol.MsgPresenceUnsubReq:
+		var req protocol.PresenceUnsubReq
+		if err := proto.Unmarshal(env.Body, &req); err != nil {
+			s.sendError(c, 400, "bad presence unsubscribe")
+			return
+		}
+		s.social.Unsubscribe(playerID, req.PlayerIds)
 	default:
 		s.sendError(c, 400, "unknown message")
 	}
@@ -144,9 +245,20 @@ func (s *Server) handleLogin(c *Client, body []byte) {
 		req.Username = "player-" + uuid.NewString()[:8]
 	}
 
-	playerID := uuid.NewString()
+	// An identity token from an earlier login keeps the player ID, and with
+	// it the player's friends; without one the player is new. The token
+	// lasts far longer than a reconnect token, so it never attaches to a
+	// session that is still alive: that takes ReconnectReq.
+	playerID, err := s.auth.ParseIdentityToken(req.IdentityToken)
+	if err != nil {
+		playerID = uuid.NewString()
+	} else if _, ok := s.sessions.Get(playerID); ok {
+		s.sendError(c, 409, "already logged in")
+		return
+	}
 	accessToken, _ := s.auth.GenerateAccessToken(playerID, req.Username, 10*time.Minute)
 	reconnectToken, _ := s.auth.GenerateReconnectToken(playerID, s.cfg.ReconnectTTL)
+	identityToken, _ := s.auth.GenerateIdentityToken(playerID, s.cfg.IdentityTTL)
 
 	s.sessions.Create(playerID, req.Username, reconnectToken, c)
 	c.SetPlayerID(playerID)
@@ -155,6 +267,7 @@ func (s *Server) handleLogin(c *Client, body []byte) {
 		PlayerId:       playerID,
 		AccessToken:    accessToken,
 		ReconnectToken: reconnectToken,
+		IdentityToken:  identityToken,
 	}
 	_ = s.sessions.Send(playerID, protocol.MsgLoginResp, resp)
 }
@@ -171,7 +284,7 @@ func (s *Server) handleReconnect(c *Client, body []byte) {
 		return
 	}
 
-	sess, ok := s.sessions.Bind(playerID, c)
+	sess, ok := s.sessions.Bind(playerID, c, req.LastAckedSeq)
 	if !ok {
 		s.sendDirect(c, protocol.MsgReconnectResp, &protocol.ReconnectResp{Ok: false, Reason: "session not found"})
 		return
@@ -188,26 +301,70 @@ func (s *Server) handleReconnect(c *Client, body []byte) {
 	}
 }
 
-func (s *Server) handleMatch(playerID string) {
-	ok := s.matcher.Enqueue(playerID)
-	if !ok {
+func (s *Server) handleMatch(playerID, mode string) {
+	if s.lobbies.InLobby(playerID) {
+		_ = s.sessions.Send(playerID, protocol.MsgErrorResp, &protocol.ErrorResp{Code: 409, Message: "in a private room"})
+		return
+	}
+	// Queueing again while a rematch vote is open counts as declining it.
+	s.forwardEvent(playerID, room.Event{Type: room.EventRematchVote, PlayerID: playerID})
+	switch err := s.matcher.Enqueue(playerID, mode); {
+	case errors.Is(err, match.ErrUnknownMode):
+		_ = s.sessions.Send(playerID, protocol.MsgErrorResp, &protocol.ErrorResp{Code: 400, Message: "unknown mode"})
+	case err != nil:
 		_ = s.sessions.Send(playerID, protocol.MsgErrorResp, &protocol.ErrorResp{Code: 429, Message: "match queue full"})
 	}
 }
 
+// handleSpectate switches the player to watching roomID, or stops watching
+// when roomID is empty. The room itself answers with SpectateResp.
+func (s *Server) handleSpectate(c *Client, playerID, roomID string) {
+	sess, ok := s.sessions.Get(playerID)
+	if !ok {
+		return
+	}
+	if roomID != "" && sess.GetRoomID() != "" {
+		s.sendDirect(c, protocol.MsgSpectateResp, &protocol.SpectateResp{RoomId: roomID, Reason: "in a match"})
+		return
+	}
+	if prev := s.sessions.SetSpectating(playerID, roomID); prev != "" && prev != roomID {
+		s.rooms.SendEvent(prev, room.Event{Type: room.EventUnspectate, PlayerID: playerID})
+	}
+	if roomID == "" {
+		s.sendDirect(c, protocol.MsgSpectateResp, &protocol.SpectateResp{Ok: true})
+		return
+	}
+	if !s.rooms.SendEvent(roomID, room.Event{Type: room.EventSpectate, PlayerID: playerID}) {
+		s.sessions.ClearSpectating(playerID, roomID)
+		s.sendDirect(c, protocol.MsgSpectateResp, &protocol.SpectateResp{RoomId: roomID, Reason: "room not found"})
+	}
+}
+
 func (s *Server) forwardInput(playerID string, input *protocol.PlayerInput) {
+	s.forwardEvent(playerID, room.Event{Type: room.EventInput, PlayerID: playerID, Input: input})
+}
+
+func (s *Server) forwardSkill(playerID string, skill *protocol.SkillCast) {
+	s.forwardEvent(playerID, room.Event{Type: room.EventSkill, PlayerID: playerID, Skill: skill})
+}
+
+// forwardChat sends the line to the player's room; the room validates and
+// relays it.
+func (s *Server) forwardChat(playerID, text string) {
 	sess, ok := s.sessions.Get(playerID)
 	if !ok {
 		return
 	}
 	roomID := sess.GetRoomID()
 	if roomID == "" {
+		_ = s.sessions.Send(playerID, protocol.MsgErrorResp, &protocol.ErrorResp{Code: 409, Message: "not in a match"})
 		return
 	}
-	s.rooms.SendEvent(roomID, room.Event{Type: room.EventInput, PlayerID: playerID, Input: input})
+	msg := &protocol.ChatMessage{SenderId: playerID, Username: sess.Username, Text: text}
+	s.rooms.SendEvent(roomID, room.Event{Type: room.EventChat, PlayerID: playerID, Chat: msg})
 }
 
-func (s *Server) forwardSkill(playerID string, skill *protocol.SkillCast) {
+func (s *Server) forwardEvent(playerID string, ev room.Event) {
 	sess, ok := s.sessions.Get(playerID)
 	if !ok {
 		return
@@ -216,7 +373,34 @@ func (s *Server) forwardSkill(playerID string, skill *protocol.SkillCast) {
 	if roomID == "" {
 		return
 	}
-	s.rooms.SendEvent(roomID, room.Event{Type: room.EventSkill, PlayerID: playerID, Skill: skill})
+	s.rooms.SendEvent(roomID, ev)
+}
+
+func (s *Server) replySocial(c *Client, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, store.ErrSelfFriend), errors.Is(err, store.ErrAlreadyFriends), errors.Is(err, store.ErrAlreadyRequested):
+		s.sendError(c, 409, err.Error())
+	case errors.Is(err, store.ErrNoFriendRequest), errors.Is(err, session.ErrNotFound):
+		s.sendError(c, 404, err.Error())
+	default:
+		s.log.Warn("social request failed", zap.Error(err), zap.String("player", c.PlayerID()))
+		s.sendError(c, 500, "internal error")
+	}
+}
+
+func (s *Server) replyLobby(c *Client, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, lobby.ErrBadRules):
+		s.sendError(c, 400, err.Error())
+	case errors.Is(err, lobby.ErrNotHost):
+		s.sendError(c, 403, err.Error())
+	case errors.Is(err, lobby.ErrNotFound), errors.Is(err, lobby.ErrNotInLobby), errors.Is(err, session.ErrNotFound):
+		s.sendError(c, 404, err.Error())
+	default:
+		s.sendError(c, 409, err.Error())
+	}
 }
 
 func (s *Server) sendError(c *Client, code int32, message string) {
@@ -0,0 +1,189 @@
+package netws
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/auth"
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/config"
+	"miniarena/server/internal/lobby"
+	"miniarena/server/internal/match"
+	"miniarena/server/internal/room"
+	"miniarena/server/internal/session"
+	"miniarena/server/internal/social"
+	"miniarena/server/internal/store"
+)
+
+// newTestServer serves a Server over a local websocket listener.
+func newTestServer(t *testing.T) (*httptest.Server, *session.Manager) {
+	t.Helper()
+	log := zap.NewNop()
+	cfg := config.Config{
+		ReconnectTTL:   time.Minute,
+		IdentityTTL:    time.Hour,
+		SendQueueSize:  64,
+		ReadLimitBytes: 1 << 16,
+	}
+	sessions := session.NewManager(cfg.ReconnectTTL, 0, nil, log)
+	rooms := room.NewManager(room.Settings{
+		Tick:         time.Hour,
+		ReadyTimeout: time.Hour,
+		Rules:        battle.DefaultRules(2),
+	}, sessions, store.NewMemoryIdem(), nil, log, room.Hooks{})
+	lobbies := lobby.NewManager(rooms, sessions, time.Hour, log)
+	matcher := match.NewMatcher(match.Modes(2, nil), 16, time.Hour, rooms, sessions, lobbies.InLobby, nil, log)
+	srv := NewServer(cfg, log, nil, auth.NewManager("test"), sessions, matcher, rooms,
+		social.NewService(store.NewMemoryFriends(), sessions, log), lobbies)
+
+	hs := httptest.NewServer(srv)
+	t.Cleanup(func() {
+		hs.Close()
+		rooms.Stop()
+		sessions.Stop()
+	})
+	return hs, sessions
+}
+
+func dial(t *testing.T, hs *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func send(t *testing.T, conn *websocket.Conn, msgType protocol.MsgType, msg proto.Message) {
+	t.Helper()
+	data, err := protocol.Encode(msgType, msg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receive reads messages until one of msgType or an ErrorResp arrives and
+// decodes it into msg; an ErrorResp is returned instead.
+func receive(t *testing.T, conn *websocket.Conn, msgType protocol.MsgType, msg proto.Message) *protocol.ErrorResp {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %v: %v", msgType, err)
+		}
+		env, err := protocol.DecodeEnvelope(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch env.Type {
+		case msgType:
+			if err := proto.Unmarshal(env.Body, msg); err != nil {
+				t.Fatal(err)
+			}
+			return nil
+		case protocol.MsgErrorResp:
+			var resp protocol.ErrorResp
+			if err := proto.Unmarshal(env.Body, &resp); err != nil {
+				t.Fatal(err)
+			}
+			return &resp
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoginWithIdentity(t *testing.T) {
+	cases := []struct {
+		name string
+		// session is what is left of the first login: "online", "offline"
+		// or "expired".
+		session    string
+		badToken   bool
+		samePlayer bool
+		errCode    int32
+	}{
+		{name: "no session left", session: "expired", samePlayer: true},
+		{name: "bad token", session: "expired", badToken: true},
+		{name: "session online", session: "online", errCode: 409},
+		{name: "session waiting for reconnect", session: "offline", errCode: 409},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hs, sessions := newTestServer(t)
+			first := dial(t, hs)
+			send(t, first, protocol.MsgLoginReq, &protocol.LoginReq{Username: "alice"})
+			var login protocol.LoginResp
+			if errResp := receive(t, first, protocol.MsgLoginResp, &login); errResp != nil {
+				t.Fatalf("first login: %+v", errResp)
+			}
+			pid := login.PlayerId
+
+			switch tc.session {
+			case "offline", "expired":
+				first.Close()
+				waitFor(t, "the session to go offline", func() bool { return !sessions.IsOnline(pid) })
+				if tc.session == "expired" {
+					sessions.Remove(pid)
+				}
+			}
+
+			token := login.IdentityToken
+			if tc.badToken {
+				token += "x"
+			}
+			second := dial(t, hs)
+			send(t, second, protocol.MsgLoginReq, &protocol.LoginReq{Username: "alice2", IdentityToken: token})
+			var again protocol.LoginResp
+			errResp := receive(t, second, protocol.MsgLoginResp, &again)
+			switch {
+			case tc.errCode != 0:
+				if errResp == nil || errResp.Code != tc.errCode {
+					t.Fatalf("login = %+v, %+v; want error %d", &again, errResp, tc.errCode)
+				}
+			case errResp != nil:
+				t.Fatalf("login refused: %+v", errResp)
+			case (again.PlayerId == pid) != tc.samePlayer:
+				t.Fatalf("player ID %s after logging in as %s, want same = %v", again.PlayerId, pid, tc.samePlayer)
+			}
+
+			if tc.session == "online" {
+				// The refused login must leave the first connection alone.
+				send(t, first, protocol.MsgPing, &protocol.Ping{ClientTs: 1})
+				var pong protocol.Pong
+				if errResp := receive(t, first, protocol.MsgPong, &pong); errResp != nil || pong.ClientTs != 1 {
+					t.Fatalf("first connection after a refused login: %+v, %+v", &pong, errResp)
+				}
+			}
+			if tc.session == "offline" {
+				// The reconnect token still resumes the session.
+				send(t, second, protocol.MsgReconnectReq, &protocol.ReconnectReq{ReconnectToken: login.ReconnectToken})
+				var resp protocol.ReconnectResp
+				if errResp := receive(t, second, protocol.MsgReconnectResp, &resp); errResp != nil || !resp.Ok || resp.PlayerId != pid {
+					t.Fatalf("reconnect = %+v, %+v", &resp, errResp)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package replay
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+)
+
+// FormatVersion is bumped whenever the file layout or the simulation changes
+// in a way that breaks old replays.
+const FormatVersion = 8
+
+var ErrVersion = errors.New("unsupported replay version")
+
+type EventKind uint8
+
+const (
+	KindInput EventKind = iota + 1
+	KindSkill
+	KindForfeit
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case KindInput:
+		return "input"
+	case KindSkill:
+		return "skill"
+	case KindForfeit:
+		return "forfeit"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is one state change applied by the room, tagged with the tick it was
+// applied on.
+type Event struct {
+	Tick     int64
+	Kind     EventKind
+	PlayerID string
+	Dx       float32
+	Dy       float32
+	SkillID  int32
+	TargetID string
+}
+
+// Replay is everything needed to re-run a match through battle.State.
+type Replay struct {
+	Version   int
+	MatchID   string
+	RoomID    string
+	StartedAt time.Time
+	Initial   *battle.State
+	Events    []Event
+	// FinalTick, Result and Final are what the room ended with.
+	FinalTick int64
+	Result    battle.Result
+	Final     []battle.PlayerState
+	FinalHash uint64
+	// Hashes are the state hash at the start and every HashEvery ticks,
+	// so Verify can tell where a re-run diverged.
+	Hashes []TickHash
+}
+
+// TickHash is the state hash after a tick, before the events applied on it.
+type TickHash struct {
+	Tick int64
+	Hash uint64
+}
+
+// HashEvery is how often a recording takes the state hash, in ticks.
+const HashEvery = 20
+
+// Recorder collects a room's events. It is owned by the room loop and is not
+// safe for concurrent use.
+type Recorder struct {
+	r *Replay
+}
+
+// NewRecorder starts a recording from a copy of the state the match starts
+// with.
+func NewRecorder(matchID, roomID string, initial *battle.State) *Recorder {
+	return &Recorder{r: &Replay{
+		Version:   FormatVersion,
+		MatchID:   matchID,
+		RoomID:    roomID,
+		StartedAt: time.Now(),
+		Initial:   initial.Clone(),
+		Hashes:    []TickHash{{Tick: initial.Tick, Hash: initial.Hash()}},
+	}}
+}
+
+// Tick is called after every tick.
+func (rec *Recorder) Tick(state *battle.State) {
+	if state.Tick%HashEvery == 0 {
+		rec.r.Hashes = append(rec.r.Hashes, TickHash{Tick: state.Tick, Hash: state.Hash()})
+	}
+}
+
+func (rec *Recorder) Input(tick int64, playerID string, input *protocol.PlayerInput) {
+	if input == nil {
+		return
+	}
+	rec.r.Events = append(rec.r.Events, Event{Tick: tick, Kind: KindInput, PlayerID: playerID, Dx: input.Dx, Dy: input.Dy})
+}
+
+func (rec *Recorder) Skill(tick int64, playerID string, skill *protocol.SkillCast) {
+	if skill == nil {
+		return
+	}
+	rec.r.Events = append(rec.r.Events, Event{Tick: tick, Kind: KindSkill, PlayerID: playerID, SkillID: skill.SkillId, TargetID: skill.TargetId})
+}
+
+func (rec *Recorder) Forfeit(tick int64, playerID string) {
+	rec.r.Events = append(rec.r.Events, Event{Tick: tick, Kind: KindForfeit, PlayerID: playerID})
+}
+
+// Finish closes the recording with the final state and result.
+func (rec *Recorder) Finish(final *battle.State, res battle.Result) *Replay {
+	rec.r.FinalTick = final.Tick
+	rec.r.Result = res
+	rec.r.Final = Players(final)
+	rec.r.FinalHash = final.Hash()
+	return rec.r
+}
+
+// Encode writes r as gzip-compressed gob.
+func Encode(w io.Writer, r *Replay) error {
+	zw := gzip.NewWriter(w)
+	if err := gob.NewEncoder(zw).Encode(r); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func Decode(rd io.Reader) (*Replay, error) {
+	zr, err := gzip.NewReader(rd)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var r Replay
+	if err := gob.NewDecoder(zr).Decode(&r); err != nil {
+		return nil, err
+	}
+	if r.Version != FormatVersion {
+		return nil, fmt.Errorf("%w: %d", ErrVersion, r.Version)
+	}
+	return &r, nil
+}
+
+// Run re-simulates r from its initial state up to FinalTick. If each is not
+// nil it is called with the state after every tick, starting with tick 0
+// before anything is applied.
+func Run(r *Replay, each func(*battle.State)) *battle.State {
+	state := r.Initial.Clone()
+	if each != nil {
+		each(state)
+	}
+	advance := func(to int64) {
+		for state.Tick < to {
+			state.TickForward()
+			if each != nil {
+				each(state)
+			}
+		}
+	}
+	for _, ev := range r.Events {
+		advance(ev.Tick)
+		switch ev.Kind {
+		case KindInput:
+			state.ApplyInput(ev.PlayerID, &protocol.PlayerInput{Dx: ev.Dx, Dy: ev.Dy})
+		case KindSkill:
+			state.ApplySkill(ev.PlayerID, &protocol.SkillCast{SkillId: ev.SkillID, TargetId: ev.TargetID})
+		case KindForfeit:
+			state.Forfeit(ev.PlayerID)
+		}
+	}
+	advance(r.FinalTick)
+	return state
+}
+
+// Verify re-runs r and checks that the state hashes, the final state and the
+// result match the recording. A hash mismatch names the first recorded tick
+// that differs.
+func Verify(r *Replay) error {
+	hashes := r.Hashes
+	var desync error
+	check := func(s *battle.State) {
+		if desync != nil || len(hashes) == 0 || hashes[0].Tick != s.Tick {
+			return
+		}
+		if h := s.Hash(); h != hashes[0].Hash {
+			desync = fmt.Errorf("state hash mismatch at tick %d: recorded %016x, replayed %016x", s.Tick, hashes[0].Hash, h)
+		}
+		hashes = hashes[1:]
+	}
+	state := Run(r, check)
+	if desync != nil {
+		return desync
+	}
+	if h := state.Hash(); h != r.FinalHash {
+		return fmt.Errorf("final state hash mismatch: recorded %016x, replayed %016x", r.FinalHash, h)
+	}
+	res, _ := state.Result()
+	if res != r.Result {
+		return fmt.Errorf("result mismatch: recorded %+v, replayed %+v", r.Result, res)
+	}
+	got := Players(state)
+	if len(got) != len(r.Final) {
+		return fmt.Errorf("player count mismatch: recorded %d, replayed %d", len(r.Final), len(got))
+	}
+	for i := range got {
+		if !reflect.DeepEqual(got[i], r.Final[i]) {
+			return fmt.Errorf("player %s mismatch at tick %d: recorded %+v, replayed %+v", got[i].ID, r.FinalTick, r.Final[i], got[i])
+		}
+	}
+	return nil
+}
+
+// Players returns the players of s ordered by ID.
+func Players(s *battle.State) []battle.PlayerState {
+	players := make([]battle.PlayerState, 0, len(s.Players))
+	for _, p := range s.Players {
+		players = append(players, *p)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].ID < players[j].ID })
+	return players
+}
@@ -0,0 +1,108 @@
+package replay
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+)
+
+// record plays a scripted match the way a room does, recording as it goes,
+// and returns the finished recording.
+func record(t *testing.T, rules battle.Rules, startAt int64) *Replay {
+	t.Helper()
+	ids := []string{"a", "b"}
+	state := battle.NewState(ids, rules, 42)
+	// Run up to startAt unrecorded, as a room restored from a checkpoint.
+	for state.Tick < startAt {
+		state.TickForward()
+	}
+	rec := NewRecorder("match-1", "room-1", state)
+	for state.Tick < startAt+150 {
+		for i, id := range ids {
+			p := state.Players[id]
+			input := &protocol.PlayerInput{Dx: -p.X / 5.1, Dy: -p.Y/6.7 + 0.3}
+			state.ApplyInput(id, input)
+			rec.Input(state.Tick, id, input)
+			skill := &protocol.SkillCast{SkillId: 1, TargetId: ids[1-i]}
+			state.ApplySkill(id, skill)
+			rec.Skill(state.Tick, id, skill)
+		}
+		if state.Tick == startAt+120 {
+			state.Forfeit("b")
+			rec.Forfeit(state.Tick, "b")
+		}
+		state.TickForward()
+		rec.Tick(state)
+	}
+	res, _ := state.Result()
+	return rec.Finish(state, res)
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	fixed := battle.DefaultRules(2)
+	fixed.FixedPoint = true
+	cases := []struct {
+		name    string
+		rules   battle.Rules
+		startAt int64
+		tamper  func(r *Replay)
+		err     string
+	}{
+		{name: "float", rules: battle.DefaultRules(2)},
+		{name: "fixed point", rules: fixed},
+		{name: "from a checkpoint", rules: fixed, startAt: 37},
+		{
+			name:   "changed input",
+			rules:  fixed,
+			tamper: func(r *Replay) { r.Events[10].Dx, r.Events[10].Dy = -r.Events[10].Dx, -r.Events[10].Dy },
+			err:    "state hash mismatch",
+		},
+		{
+			name:  "dropped forfeit",
+			rules: fixed,
+			tamper: func(r *Replay) {
+				for i, ev := range r.Events {
+					if ev.Kind == KindForfeit {
+						r.Events = append(r.Events[:i], r.Events[i+1:]...)
+						return
+					}
+				}
+			},
+			err: "mismatch",
+		},
+		{
+			name:   "changed result",
+			rules:  fixed,
+			tamper: func(r *Replay) { r.Result.Winner = "b" },
+			err:    "result mismatch",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rp := record(t, tc.rules, tc.startAt)
+
+			// Verify the copy that went through the wire format.
+			var buf bytes.Buffer
+			if err := Encode(&buf, rp); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.tamper != nil {
+				tc.tamper(got)
+			}
+			err = Verify(got)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("Verify: %v", err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Fatalf("Verify = %v, want an error containing %q", err, tc.err)
+			}
+		})
+	}
+}
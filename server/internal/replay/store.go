@@ -0,0 +1,155 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrNotFound = errors.New("replay not found")
+
+// Store keeps replays by match ID.
+type Store interface {
+	Save(ctx context.Context, r *Replay) error
+	Load(ctx context.Context, matchID string) (*Replay, error)
+}
+
+// pruneEvery is how often DirStore looks for expired replays.
+const pruneEvery = 10 * time.Minute
+
+// DirStore writes one <match_id>.replay file per match and deletes files
+// older than maxAge; 0 keeps them forever.
+type DirStore struct {
+	dir    string
+	maxAge time.Duration
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+func NewDirStore(dir string, maxAge time.Duration) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &DirStore{dir: dir, maxAge: maxAge}
+	s.maybePrune(time.Now())
+	return s, nil
+}
+
+func (s *DirStore) Path(matchID string) string {
+	return filepath.Join(s.dir, matchID+".replay")
+}
+
+func (s *DirStore) Save(ctx context.Context, r *Replay) error {
+	var buf bytes.Buffer
+	if err := Encode(&buf, r); err != nil {
+		return err
+	}
+	// Write to a temp file first so readers never see a partial replay.
+	tmp := s.Path(r.MatchID) + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.Path(r.MatchID)); err != nil {
+		return err
+	}
+	s.maybePrune(time.Now())
+	return nil
+}
+
+// maybePrune deletes expired replays, at most once per pruneEvery. Saves
+// drive it, so an idle server leaves the directory alone.
+func (s *DirStore) maybePrune(now time.Time) {
+	if s.maxAge <= 0 {
+		return
+	}
+	s.mu.Lock()
+	if now.Sub(s.lastPrune) < pruneEvery {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPrune = now
+	s.mu.Unlock()
+	_, _ = s.Prune(now)
+}
+
+// Prune deletes replay files, and temp files left by a crash, last written
+// more than maxAge before now. It returns the number deleted.
+func (s *DirStore) Prune(now time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !(strings.HasSuffix(name, ".replay") || strings.HasSuffix(name, ".replay.tmp")) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) <= s.maxAge {
+			continue
+		}
+		if os.Remove(filepath.Join(s.dir, name)) == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *DirStore) Load(ctx context.Context, matchID string) (*Replay, error) {
+	return LoadFile(s.Path(matchID))
+}
+
+// LoadFile reads a replay file written by DirStore.
+func LoadFile(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+// RedisStore keeps replays under replay:<match_id> until ttl passes.
+type RedisStore struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+func NewRedisStore(rdb *redis.Client, ttl time.Duration) *RedisStore {
+	return &RedisStore{rdb: rdb, ttl: ttl}
+}
+
+func (s *RedisStore) Save(ctx context.Context, r *Replay) error {
+	var buf bytes.Buffer
+	if err := Encode(&buf, r); err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, redisKey(r.MatchID), buf.Bytes(), s.ttl).Err()
+}
+
+func (s *RedisStore) Load(ctx context.Context, matchID string) (*Replay, error) {
+	data, err := s.rdb.Get(ctx, redisKey(matchID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Decode(bytes.NewReader(data))
+}
+
+func redisKey(matchID string) string {
+	return "replay:" + matchID
+}
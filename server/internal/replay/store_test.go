@@ -0,0 +1,75 @@
+package replay
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDirStorePrune(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name   string
+		maxAge time.Duration
+		files  map[string]time.Duration // name to age
+		left   []string
+	}{
+		{
+			name:   "expired replays",
+			maxAge: time.Hour,
+			files:  map[string]time.Duration{"old.replay": 2 * time.Hour, "new.replay": time.Minute},
+			left:   []string{"new.replay"},
+		},
+		{
+			name:   "crashed temp file",
+			maxAge: time.Hour,
+			files:  map[string]time.Duration{"old.replay.tmp": 2 * time.Hour},
+		},
+		{
+			name:   "other files",
+			maxAge: time.Hour,
+			files:  map[string]time.Duration{"notes.txt": 2 * time.Hour},
+			left:   []string{"notes.txt"},
+		},
+		{
+			name:   "kept forever",
+			maxAge: 0,
+			files:  map[string]time.Duration{"old.replay": 1000 * time.Hour},
+			left:   []string{"old.replay"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, age := range tc.files {
+				path := filepath.Join(dir, name)
+				if err := os.WriteFile(path, nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// NewDirStore prunes on open.
+			if _, err := NewDirStore(dir, tc.maxAge); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var left []string
+			for _, e := range entries {
+				left = append(left, e.Name())
+			}
+			sort.Strings(left)
+			if !reflect.DeepEqual(left, tc.left) {
+				t.Fatalf("left %v, want %v", left, tc.left)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+)
+
+var (
+	ErrNotFound  = errors.New("room not found")
+	ErrNotInRoom = errors.New("player not in room")
+	ErrEnded     = errors.New("room already ended")
+	ErrBadResult = errors.New("invalid result")
+)
+
+// Info is what operators see of a live room.
+type Info struct {
+	ID        string
+	MatchID   string
+	Phase     protocol.RoomPhase
+	Players   []string
+	Observers int
+	Tick      int64
+	CreatedAt time.Time
+	// State is a copy taken by the room loop.
+	State *battle.State
+}
+
+// Rooms asks every live room for its Info. Rooms that close or do not answer
+// before ctx is done are left out.
+func (m *Manager) Rooms(ctx context.Context) []Info {
+	m.mu.RLock()
+	replies := make(chan Info, len(m.rooms))
+	sent := 0
+	for _, room := range m.rooms {
+		if room.sendAdmin(Event{Type: EventInspect, Info: replies}) {
+			sent++
+		}
+	}
+	m.mu.RUnlock()
+
+	infos := make([]Info, 0, sent)
+	for len(infos) < sent {
+		select {
+		case info := <-replies:
+			infos = append(infos, info)
+		case <-ctx.Done():
+			return infos
+		}
+	}
+	return infos
+}
+
+func (m *Manager) Inspect(ctx context.Context, roomID string) (Info, error) {
+	reply := make(chan Info, 1)
+	if err := m.sendAdmin(roomID, Event{Type: EventInspect, Info: reply}); err != nil {
+		return Info{}, err
+	}
+	select {
+	case info := <-reply:
+		return info, nil
+	case <-ctx.Done():
+		return Info{}, ctx.Err()
+	}
+}
+
+// ForceEnd ends the room with res. A win needs a winner who is in the room;
+// other outcomes must not name one.
+func (m *Manager) ForceEnd(ctx context.Context, roomID string, res battle.Result) error {
+	return m.call(ctx, roomID, Event{Type: EventForceEnd, Result: res})
+}
+
+// Kick removes a player from the room. Once the match has started they
+// forfeit.
+func (m *Manager) Kick(ctx context.Context, roomID, playerID string) error {
+	return m.call(ctx, roomID, Event{Type: EventKick, PlayerID: playerID})
+}
+
+// Announce sends a system chat line to everyone in the room.
+func (m *Manager) Announce(ctx context.Context, roomID, text string) error {
+	return m.call(ctx, roomID, Event{Type: EventAnnounce, Text: text})
+}
+
+func (m *Manager) call(ctx context.Context, roomID string, ev Event) error {
+	done := make(chan error, 1)
+	ev.Done = done
+	if err := m.sendAdmin(roomID, ev); err != nil {
+		return err
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Manager) sendAdmin(roomID string, ev Event) error {
+	m.mu.RLock()
+	room := m.rooms[roomID]
+	m.mu.RUnlock()
+	if room == nil || !room.sendAdmin(ev) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// sendAdmin queues ev unless the room is already closing. A room that closes
+// after this never answers; callers rely on their context for that.
+func (r *Room) sendAdmin(ev Event) bool {
+	if r.stopped() {
+		return false
+	}
+	r.SendEvent(ev)
+	return true
+}
+
+func (r *Room) handleAdmin(ev Event) {
+	switch ev.Type {
+	case EventInspect:
+		ev.Info <- Info{
+			ID:        r.id,
+			MatchID:   r.matchID,
+			Phase:     r.phase,
+			Players:   append([]string(nil), r.players...),
+			Observers: len(r.observers),
+			Tick:      r.state.Tick,
+			CreatedAt: r.createdAt,
+			State:     r.state.Clone(),
+		}
+	case EventForceEnd:
+		ev.Done <- r.forceEnd(ev.Result)
+	case EventKick:
+		ev.Done <- r.kick(ev.PlayerID)
+	case EventAnnounce:
+		r.announce(ev.Text)
+		ev.Done <- nil
+	}
+}
+
+// forceEnd broadcasts res; the room closes on its next tick. No replay is
+// saved, since res did not come from the simulation.
+func (r *Room) forceEnd(res battle.Result) error {
+	if r.phase == protocol.RoomPhaseEnded {
+		return ErrEnded
+	}
+	// A win names a winner or a winning team, never both.
+	if (res.Outcome == battle.OutcomeWin) != (res.Winner != "" || res.Team != 0) || (res.Winner != "" && res.Team != 0) {
+		return ErrBadResult
+	}
+	if res.Winner != "" && !r.isPlayer(res.Winner) {
+		return ErrNotInRoom
+	}
+	if res.Team != 0 && !r.hasTeam(res.Team) {
+		return ErrNotInRoom
+	}
+	if res.Reason == "" {
+		res.Reason = "ended by admin"
+	}
+	var stats []battle.PlayerStats
+	if r.phase != protocol.RoomPhaseWaiting {
+		stats = r.state.Stats(res)
+	}
+	r.phase = protocol.RoomPhaseEnded
+	r.broadcastRoomOver(res, stats)
+	return nil
+}
+
+func (r *Room) hasTeam(team int32) bool {
+	for _, p := range r.state.Players {
+		if p.Team == team {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Room) kick(playerID string) error {
+	if !r.isPlayer(playerID) {
+		return ErrNotInRoom
+	}
+	if r.phase == protocol.RoomPhaseEnded {
+		return ErrEnded
+	}
+	if r.phase == protocol.RoomPhaseWaiting {
+		kept := make([]string, 0, len(r.players)-1)
+		for _, pid := range r.players {
+			if pid != playerID {
+				kept = append(kept, pid)
+			}
+		}
+		r.players = kept
+		r.state.RemovePlayer(playerID)
+		delete(r.ready, playerID)
+		delete(r.disconnected, playerID)
+		delete(r.controllers, playerID)
+	} else {
+		delete(r.disconnected, playerID)
+		r.forfeit(playerID)
+	}
+	_ = r.sender.Send(playerID, protocol.MsgErrorResp, &protocol.ErrorResp{Code: 403, Message: "removed from room"})
+	r.playerRemoved(playerID)
+	return nil
+}
+
+// announce sends a chat line with no sender. It skips the rate limit and the
+// word filter.
+func (r *Room) announce(text string) {
+	line := &protocol.ChatMessage{
+		RoomId: r.id,
+		Text:   text,
+		SentAt: time.Now().UnixMilli(),
+	}
+	r.chatHistory.Add(line)
+	for _, pid := range r.players {
+		_ = r.sender.Send(pid, protocol.MsgChatMessage, line)
+	}
+	for pid := range r.observers {
+		_ = r.sender.Send(pid, protocol.MsgChatMessage, line)
+	}
+}
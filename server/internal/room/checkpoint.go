@@ -0,0 +1,215 @@
+package room
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/metrics"
+	"miniarena/server/internal/replay"
+	"miniarena/server/internal/store"
+)
+
+// usernames is implemented by senders that know player names. Checkpoints
+// keep them so restored sessions show the same names.
+type usernames interface {
+	Username(playerID string) string
+}
+
+// checkpoint saves the match every Settings.CheckpointEvery while it is
+// played. Saves run in the background one at a time; a tick that finds the
+// previous save still running skips its turn.
+func (r *Room) checkpoint(now time.Time) {
+	if r.settings.Checkpoints == nil || r.settings.CheckpointEvery <= 0 || now.Before(r.nextCheckpoint) {
+		return
+	}
+	select {
+	case <-r.ckptDone:
+	default:
+		return
+	}
+	r.nextCheckpoint = now.Add(r.settings.CheckpointEvery)
+	r.checkpointed = true
+
+	cp := store.Checkpoint{
+		RoomID:  r.id,
+		MatchID: r.matchID,
+		Names:   r.playerNames(),
+		State:   r.state.Clone(),
+		SavedAt: now,
+	}
+	for _, pid := range r.players {
+		if r.bots[pid] {
+			cp.Bots = append(cp.Bots, pid)
+		} else {
+			cp.Players = append(cp.Players, pid)
+		}
+	}
+	done := make(chan struct{})
+	r.ckptDone = done
+	go func() {
+		defer close(done)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := r.settings.Checkpoints.SaveCheckpoint(ctx, cp); err != nil {
+			r.log.Warn("save checkpoint failed", zap.Error(err), zap.String("room", r.id))
+		}
+	}()
+}
+
+// dropCheckpoint deletes the room's checkpoint once the match is settled,
+// after any save still in flight.
+func (r *Room) dropCheckpoint() {
+	if !r.checkpointed {
+		return
+	}
+	r.checkpointed = false
+	prev := r.ckptDone
+	go func() {
+		<-prev
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := r.settings.Checkpoints.DeleteCheckpoint(ctx, r.id); err != nil {
+			r.log.Warn("delete checkpoint failed", zap.Error(err), zap.String("room", r.id))
+		}
+	}()
+}
+
+func (r *Room) playerNames() map[string]string {
+	if r.names != nil {
+		return r.names
+	}
+	r.names = make(map[string]string, len(r.players))
+	if u, ok := r.sender.(usernames); ok {
+		for _, pid := range r.players {
+			if !r.bots[pid] {
+				r.names[pid] = u.Username(pid)
+			}
+		}
+	}
+	return r.names
+}
+
+// restoreRoom rebuilds a room from its checkpoint. It waits in the countdown
+// for its players to reconnect: it starts once everyone is back, or at
+// resumeBy with whoever made it, forfeiting the rest. Nobody back by then
+// aborts the match.
+func restoreRoom(cp store.Checkpoint, settings Settings, sender Sender, idem store.Idempotency, metrics *metrics.Metrics, log *zap.Logger, hooks Hooks) *Room {
+	spec := Spec{MatchID: cp.MatchID, Players: cp.Players, Bots: cp.Bots, Rules: cp.State.Rules}
+	r := NewRoom(cp.RoomID, spec, settings, sender, idem, metrics, log, hooks)
+	now := time.Now()
+	r.state = cp.State
+	r.names = cp.Names
+	r.checkpointed = true
+	if settings.Replays != nil {
+		// What was played before the checkpoint went with the old
+		// process; the replay starts here.
+		r.rec = replay.NewRecorder(cp.MatchID, cp.RoomID, r.state)
+	}
+	r.phase = protocol.RoomPhaseCountdown
+	r.resumeBy = now.Add(settings.ResumeWithin)
+	r.phaseEnd = r.resumeBy
+	for _, pid := range cp.Players {
+		r.ready[pid] = true
+		if p, ok := r.state.Players[pid]; ok && !p.Forfeited {
+			r.disconnected[pid] = r.resumeBy
+		}
+	}
+	return r
+}
+
+// stepResume holds a restored room until its players are back and reports
+// whether the match was aborted instead.
+func (r *Room) stepResume(now time.Time) (done bool) {
+	humans, back := 0, 0
+	for _, pid := range r.players {
+		if p, ok := r.state.Players[pid]; r.bots[pid] || !ok || p.Forfeited {
+			continue
+		}
+		humans++
+		if _, gone := r.disconnected[pid]; !gone {
+			back++
+		}
+	}
+	switch {
+	case back == 0 && (humans == 0 || !now.Before(r.resumeBy)):
+		// Nobody made it back, or everyone gave up and left.
+		r.endAborted("server restarted")
+		return true
+	case back < humans && now.Before(r.resumeBy):
+		return false
+	}
+	r.resumeBy = time.Time{}
+	r.phaseEnd = now.Add(r.settings.Countdown)
+	return false
+}
+
+// Recover resumes the matches checkpointed by a previous run. Checkpoints
+// older than Settings.ResumeWithin are settled as aborted instead, through
+// the same settle key a finished room uses. Hooks.OnRecovered runs for each
+// checkpoint first, so the owner can restore its players' sessions.
+func (m *Manager) Recover(ctx context.Context) error {
+	if m.settings.Checkpoints == nil {
+		return nil
+	}
+	cps, err := m.settings.Checkpoints.LoadCheckpoints(ctx)
+	if err != nil {
+		return err
+	}
+	for _, cp := range cps {
+		resume := time.Since(cp.SavedAt) <= m.settings.ResumeWithin
+		if m.hooks.OnRecovered != nil {
+			m.hooks.OnRecovered(cp, resume)
+		}
+		if !resume {
+			m.settleAborted(ctx, cp)
+			continue
+		}
+		hooks := Hooks{OnClosed: m.closeRoom, OnPlayerRemoved: m.hooks.OnPlayerRemoved, OnRematch: m.rematch}
+		m.start(restoreRoom(cp, m.settings, m.sender, m.idem, m.metrics, m.log, hooks))
+		m.log.Info("room restored", zap.String("room", cp.RoomID), zap.String("match", cp.MatchID), zap.Int64("tick", cp.State.Tick))
+	}
+	return nil
+}
+
+// settleAborted settles a match that is too old to resume the way a room
+// would: players are told with RoomOver and the match is saved with the stats
+// of its last checkpoint.
+func (m *Manager) settleAborted(ctx context.Context, cp store.Checkpoint) {
+	ok, err := m.idem.SetIfNotExists(ctx, "settle:"+cp.MatchID, 5*time.Minute)
+	if err != nil {
+		m.log.Warn("idempotent settle failed", zap.Error(err), zap.String("match", cp.MatchID))
+		ok = true
+	}
+	if ok {
+		res := battle.Result{Outcome: battle.OutcomeAborted, Reason: "server restarted"}
+		m.log.Info("checkpoint settled as aborted", zap.String("room", cp.RoomID), zap.String("match", cp.MatchID))
+		if m.metrics != nil {
+			m.metrics.MatchResults.WithLabelValues(res.Outcome.String()).Inc()
+		}
+		over := &protocol.RoomOver{RoomId: cp.RoomID, Outcome: protocol.RoomOutcome(res.Outcome), Reason: res.Reason}
+		for _, pid := range cp.Players {
+			_ = m.sender.SendReliable(pid, protocol.MsgRoomOver, over)
+		}
+		if m.settings.Matches != nil {
+			rec := store.MatchRecord{
+				MatchID: cp.MatchID,
+				RoomID:  cp.RoomID,
+				Outcome: res.Outcome.String(),
+				Reason:  res.Reason,
+				Ticks:   cp.State.Tick,
+				EndedAt: time.Now(),
+				Players: cp.State.Stats(res),
+			}
+			if err := m.settings.Matches.SaveMatch(ctx, rec); err != nil {
+				m.log.Warn("save match failed", zap.Error(err), zap.String("match", cp.MatchID))
+			}
+		}
+	}
+	if err := m.settings.Checkpoints.DeleteCheckpoint(ctx, cp.RoomID); err != nil {
+		m.log.Warn("delete checkpoint failed", zap.Error(err), zap.String("room", cp.RoomID))
+	}
+}
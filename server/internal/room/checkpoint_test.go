@@ -0,0 +1,135 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/replay"
+	"miniarena/server/internal/store"
+)
+
+// memCheckpoints is a store.Checkpoints backed by a map.
+type memCheckpoints struct {
+	mu  sync.Mutex
+	cps map[string]store.Checkpoint
+}
+
+func (s *memCheckpoints) SaveCheckpoint(_ context.Context, cp store.Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cps[cp.RoomID] = cp
+	return nil
+}
+
+func (s *memCheckpoints) DeleteCheckpoint(_ context.Context, roomID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cps, roomID)
+	return nil
+}
+
+func (s *memCheckpoints) LoadCheckpoints(context.Context) ([]store.Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []store.Checkpoint
+	for _, cp := range s.cps {
+		out = append(out, cp)
+	}
+	return out, nil
+}
+
+// nopReplays accepts every replay and keeps none.
+type nopReplays struct{}
+
+func (nopReplays) Save(context.Context, *replay.Replay) error { return nil }
+func (nopReplays) Load(context.Context, string) (*replay.Replay, error) {
+	return nil, errors.New("not found")
+}
+
+func TestRecover(t *testing.T) {
+	cases := []struct {
+		name    string
+		age     time.Duration
+		resumed bool
+	}{
+		{name: "recent checkpoint resumes", age: time.Second, resumed: true},
+		{name: "old checkpoint settles as aborted", age: time.Hour},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := battle.NewState([]string{"a", "b"}, battle.DefaultRules(2), 1)
+			state.Tick = 100
+			cps := &memCheckpoints{cps: map[string]store.Checkpoint{"room-1": {
+				Version: store.CheckpointVersion,
+				RoomID:  "room-1",
+				MatchID: "match-1",
+				Players: []string{"a", "b"},
+				State:   state,
+				SavedAt: time.Now().Add(-tc.age),
+			}}}
+			matches := store.NewMemoryMatches()
+			settings := testSettings()
+			settings.Checkpoints = cps
+			settings.CheckpointEvery = time.Second
+			settings.ResumeWithin = time.Minute
+			settings.Matches = matches
+			settings.Replays = nopReplays{}
+
+			var recovered []bool
+			sender := &recordSender{}
+			m := NewManager(settings, sender, store.NewMemoryIdem(), nil, zap.NewNop(), Hooks{
+				OnRecovered: func(_ store.Checkpoint, resumed bool) { recovered = append(recovered, resumed) },
+			})
+			defer m.Stop()
+
+			ctx := context.Background()
+			if err := m.Recover(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if len(recovered) != 1 || recovered[0] != tc.resumed {
+				t.Fatalf("OnRecovered got %v, want [%v]", recovered, tc.resumed)
+			}
+
+			if tc.resumed {
+				m.mu.RLock()
+				r := m.rooms["room-1"]
+				m.mu.RUnlock()
+				if r == nil {
+					t.Fatal("room not restored")
+				}
+				if r.rec == nil {
+					t.Fatal("restored room does not record a replay")
+				}
+				return
+			}
+
+			if m.Len() != 0 {
+				t.Fatal("old checkpoint was resumed")
+			}
+			over := sender.take(protocol.MsgRoomOver)
+			if len(over) != 2 {
+				t.Fatalf("RoomOver sent %d times, want once per player", len(over))
+			}
+			if got := over[0].msg.(*protocol.RoomOver).Outcome; got != protocol.RoomOutcome(battle.OutcomeAborted) {
+				t.Fatalf("outcome = %v, want aborted", got)
+			}
+			rec, err := matches.LoadMatch(ctx, "match-1")
+			if err != nil {
+				t.Fatalf("match not saved: %v", err)
+			}
+			if rec.Outcome != battle.OutcomeAborted.String() || rec.Ticks != 100 || len(rec.Players) != 2 {
+				t.Fatalf("saved match %+v", rec)
+			}
+			if left, _ := cps.LoadCheckpoints(ctx); len(left) != 0 {
+				t.Fatal("checkpoint not deleted")
+			}
+		})
+	}
+}
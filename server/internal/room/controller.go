@@ -0,0 +1,209 @@
+package room
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+)
+
+// Controller plays a character on the server, for bots and for players in
+// their disconnect grace period. The room calls Decide once per tick before
+// advancing the state; either return value may be nil.
+type Controller interface {
+	Decide(state *battle.State, playerID string) (*protocol.PlayerInput, *protocol.SkillCast)
+}
+
+type Difficulty int
+
+const (
+	DifficultyEasy Difficulty = iota
+	DifficultyNormal
+	DifficultyHard
+)
+
+func (d Difficulty) String() string {
+	switch d {
+	case DifficultyEasy:
+		return "easy"
+	case DifficultyNormal:
+		return "normal"
+	case DifficultyHard:
+		return "hard"
+	default:
+		return fmt.Sprintf("difficulty(%d)", int(d))
+	}
+}
+
+func ParseDifficulty(s string) (Difficulty, error) {
+	switch strings.ToLower(s) {
+	case "easy":
+		return DifficultyEasy, nil
+	case "", "normal":
+		return DifficultyNormal, nil
+	case "hard":
+		return DifficultyHard, nil
+	default:
+		return DifficultyNormal, fmt.Errorf("unknown difficulty %q", s)
+	}
+}
+
+// AISettings configure the server-side AI.
+type AISettings struct {
+	Difficulty Difficulty
+	// TakeOver lets the AI play for disconnected players during the grace
+	// period.
+	TakeOver bool
+}
+
+const botPrefix = "bot-"
+
+// NewBotID returns a player ID for a bot seat.
+func NewBotID() string {
+	return botPrefix + uuid.NewString()[:8]
+}
+
+// ChaseAI walks toward the nearest opponent and casts whatever is ready and
+// in range, healing itself first when hurt. Lower
+// difficulties move slower, react less often and miss more casts.
+type ChaseAI struct {
+	rng *rand.Rand
+	// speed is the fraction of the maximum move used per tick.
+	speed float32
+	// aim is the chance to cast when a skill is ready and in range.
+	aim float64
+	// think is how many ticks pass between course corrections.
+	think  int64
+	dx, dy float32
+	// lastX and lastY are where the bot was at its last course correction.
+	// A bot that did not get anywhere since walks sideways for detour ticks
+	// to get around whatever is in the way.
+	lastX, lastY float32
+	detour       int64
+	side         float32
+}
+
+func NewChaseAI(d Difficulty, seed int64) *ChaseAI {
+	a := &ChaseAI{rng: rand.New(rand.NewSource(seed))}
+	switch d {
+	case DifficultyEasy:
+		a.speed, a.aim, a.think = 0.4, 0.15, 5
+	case DifficultyHard:
+		a.speed, a.aim, a.think = 1, 1, 1
+	default:
+		a.speed, a.aim, a.think = 0.7, 0.5, 2
+	}
+	return a
+}
+
+func (a *ChaseAI) Decide(state *battle.State, self string) (*protocol.PlayerInput, *protocol.SkillCast) {
+	me := state.Players[self]
+	if me == nil || me.HP <= 0 {
+		return nil, nil
+	}
+	target, dist := nearestOpponent(state, self)
+	if target == nil {
+		return nil, nil
+	}
+
+	los := state.LineOfSight(self, target.ID)
+	if a.detour > 0 {
+		a.detour--
+	}
+	if state.Tick%a.think == 0 {
+		stuck := (a.dx != 0 || a.dy != 0) && me.X == a.lastX && me.Y == a.lastY
+		if stuck && a.detour == 0 {
+			a.detour = a.think * 6
+			a.side = 1
+			if a.rng.Intn(2) == 0 {
+				a.side = -1
+			}
+		}
+		a.lastX, a.lastY = me.X, me.Y
+		a.dx, a.dy = 0, 0
+		// Stop a little inside skill range instead of stacking on the
+		// target, unless something blocks the shot.
+		if dist > reach(state.Rules)*0.8 || !los {
+			step := float64(a.speed) * battle.MaxMovePerTick
+			ux, uy := float64(target.X-me.X)/dist, float64(target.Y-me.Y)/dist
+			if a.detour > 0 {
+				ux, uy = -uy*float64(a.side), ux*float64(a.side)
+			}
+			a.dx, a.dy = float32(ux*step), float32(uy*step)
+		}
+	}
+
+	var skill *protocol.SkillCast
+	if me.Casting == 0 {
+		if sk, ok := pickSkill(state.Rules, me, dist, los); ok && a.rng.Float64() < a.aim {
+			skill = &protocol.SkillCast{SkillId: sk.ID, TargetId: target.ID}
+			if sk.Heal > 0 {
+				skill.TargetId = self
+			}
+		}
+	}
+	return &protocol.PlayerInput{Dx: a.dx, Dy: a.dy}, skill
+}
+
+// reach is the shortest range among damaging skills, so every one of them
+// can hit from where the bot stops.
+func reach(rules battle.Rules) float64 {
+	r := math.Inf(1)
+	for _, sk := range rules.Skills {
+		if sk.Damage > 0 && sk.Range < r {
+			r = sk.Range
+		}
+	}
+	if math.IsInf(r, 1) {
+		return 0
+	}
+	return r
+}
+
+// pickSkill returns the first ready skill worth casting: a heal when at half
+// health or less, otherwise a damaging skill that reaches a target in sight.
+func pickSkill(rules battle.Rules, me *battle.PlayerState, dist float64, los bool) (battle.Skill, bool) {
+	hurt := me.HP*2 <= rules.MaxHP
+	for i, sk := range rules.Skills {
+		if i >= len(me.Cooldowns) || me.Cooldowns[i] > 0 {
+			continue
+		}
+		if hurt && sk.Heal > 0 && sk.Target != battle.TargetEnemy {
+			return sk, true
+		}
+	}
+	if !los {
+		return battle.Skill{}, false
+	}
+	for i, sk := range rules.Skills {
+		if i >= len(me.Cooldowns) || me.Cooldowns[i] > 0 {
+			continue
+		}
+		if sk.Damage > 0 && sk.Target != battle.TargetSelf && dist <= sk.Range {
+			return sk, true
+		}
+	}
+	return battle.Skill{}, false
+}
+
+// nearestOpponent breaks distance ties by player ID so the choice does not
+// depend on map order. Teammates are never opponents, friendly fire or not.
+func nearestOpponent(state *battle.State, self string) (*battle.PlayerState, float64) {
+	var best *battle.PlayerState
+	bestDist := math.Inf(1)
+	for id, p := range state.Players {
+		if id == self || p.HP <= 0 || state.Allies(self, id) {
+			continue
+		}
+		d, _ := state.Distance(self, id)
+		if d < bestDist || (d == bestDist && id < best.ID) {
+			best, bestDist = p, d
+		}
+	}
+	return best, bestDist
+}
@@ -0,0 +1,101 @@
+package room
+
+import (
+	"testing"
+
+	"miniarena/server/internal/battle"
+)
+
+func TestChaseAI(t *testing.T) {
+	mend := battle.Skill{ID: 2, Name: "mend", Heal: 30, Cooldown: 50, Target: battle.TargetSelf}
+
+	type cast struct {
+		skill  int32
+		target string
+		dist   float64
+	}
+	cases := []struct {
+		name       string
+		difficulty Difficulty
+		players    []string
+		teamSize   int
+		skills     []battle.Skill
+		// hp is the bot's starting health, full if 0.
+		hp        int32
+		wantFirst int32
+	}{
+		{name: "hard", difficulty: DifficultyHard, players: []string{"bot", "p"}, wantFirst: 1},
+		{name: "normal", difficulty: DifficultyNormal, players: []string{"bot", "p"}, wantFirst: 1},
+		{name: "easy", difficulty: DifficultyEasy, players: []string{"bot", "p"}, wantFirst: 1},
+		{
+			name:       "heals first when hurt",
+			difficulty: DifficultyHard,
+			players:    []string{"bot", "p"},
+			skills:     append(battle.DefaultSkills(), mend),
+			hp:         20,
+			wantFirst:  2,
+		},
+		{
+			// The ally spawns as close as the nearest opponent.
+			name:       "leaves teammates alone",
+			difficulty: DifficultyHard,
+			players:    []string{"bot", "ally", "p", "q"},
+			teamSize:   2,
+			wantFirst:  1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules := battle.DefaultRules(len(tc.players))
+			rules.TeamSize = tc.teamSize
+			if tc.skills != nil {
+				rules.Skills = tc.skills
+			}
+			s := battle.NewState(tc.players, rules, 1)
+			if tc.hp > 0 {
+				s.Players["bot"].HP = tc.hp
+			}
+			target, start := nearestOpponent(s, "bot")
+
+			ai := NewChaseAI(tc.difficulty, 1)
+			var casts []cast
+			hit := false
+			for i := 0; i < 300 && !hit; i++ {
+				input, skill := ai.Decide(s, "bot")
+				s.ApplyInput("bot", input)
+				if skill != nil {
+					d, _ := s.Distance("bot", skill.TargetId)
+					casts = append(casts, cast{skill.SkillId, skill.TargetId, d})
+				}
+				s.ApplySkill("bot", skill)
+				s.TickForward()
+				for id, p := range s.Players {
+					hit = hit || (id != "bot" && !s.Allies("bot", id) && p.HP < rules.MaxHP)
+				}
+			}
+
+			if !hit {
+				t.Fatalf("no opponent hit after %d ticks, casts %v", s.Tick, casts)
+			}
+			if d, _ := s.Distance("bot", target.ID); d >= start {
+				t.Fatalf("distance to %s went from %.1f to %.1f", target.ID, start, d)
+			}
+			if casts[0].skill != tc.wantFirst {
+				t.Fatalf("first cast %+v, want skill %d", casts[0], tc.wantFirst)
+			}
+			for _, c := range casts {
+				_, sk, _ := rules.Skill(c.skill)
+				switch {
+				case sk.Heal > 0:
+					if c.target != "bot" {
+						t.Fatalf("heal cast on %s", c.target)
+					}
+				case s.Allies("bot", c.target):
+					t.Fatalf("cast %+v at a teammate", c)
+				case c.dist > sk.Range:
+					t.Fatalf("cast %+v out of range %.0f", c, sk.Range)
+				}
+			}
+		})
+	}
+}
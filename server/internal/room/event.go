@@ -1,19 +1,79 @@
 package room
 
-import "miniarena/pkg/protocol"
+import (
+	"fmt"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+)
 
 type EventType int
 
 const (
+	// EventJoin is sent when a player reconnects into the room.
 	EventJoin EventType = iota
+	// EventLeave forfeits the player immediately.
 	EventLeave
+	// EventDisconnect starts the player's reconnect grace period.
+	EventDisconnect
 	EventInput
 	EventSkill
+	EventReady
+	EventSpectate
+	EventUnspectate
+	EventChat
+	EventRematchVote
+	// Admin events. They reply on Info or Done; both must be buffered.
+	EventInspect
+	EventForceEnd
+	EventKick
+	EventAnnounce
 )
 
+func (t EventType) String() string {
+	switch t {
+	case EventJoin:
+		return "join"
+	case EventLeave:
+		return "leave"
+	case EventDisconnect:
+		return "disconnect"
+	case EventInput:
+		return "input"
+	case EventSkill:
+		return "skill"
+	case EventReady:
+		return "ready"
+	case EventSpectate:
+		return "spectate"
+	case EventUnspectate:
+		return "unspectate"
+	case EventChat:
+		return "chat"
+	case EventRematchVote:
+		return "rematch_vote"
+	case EventInspect:
+		return "inspect"
+	case EventForceEnd:
+		return "force_end"
+	case EventKick:
+		return "kick"
+	case EventAnnounce:
+		return "announce"
+	default:
+		return fmt.Sprintf("event(%d)", int(t))
+	}
+}
+
 type Event struct {
 	Type     EventType
 	PlayerID string
 	Input    *protocol.PlayerInput
 	Skill    *protocol.SkillCast
+	Chat     *protocol.ChatMessage
+	Accept   bool
+	Result   battle.Result
+	Text     string
+	Info     chan<- Info
+	Done     chan<- error
 }
@@ -0,0 +1,151 @@
+package room
+
+import (
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/replay"
+)
+
+// A panic while handling an event or a tick aborts the match instead of the
+// process. The room is left Ended, so the next step closes it through the
+// usual OnClosed path. Owner hooks and closing are guarded on their own: a
+// panic there is logged and the room carries on.
+
+func (r *Room) safeHandle(ev Event) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.abort("event", p)
+		}
+	}()
+	r.handleEvent(ev)
+}
+
+func (r *Room) safeStep(now time.Time) (done bool) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.abort("tick", p)
+			done = true
+		}
+	}()
+	done = r.step(now)
+	r.lastStep.Store(time.Now().UnixNano())
+	return done
+}
+
+func (r *Room) abort(in string, p any) {
+	// Dumping the state and telling players go through the same code that
+	// may have panicked, so the room is marked Ended first and each of them
+	// runs guarded.
+	phase := r.phase
+	r.phase = protocol.RoomPhaseEnded
+	r.rematchEnd = time.Time{}
+	r.rec = nil
+	if r.metrics != nil {
+		r.metrics.RoomPanics.WithLabelValues(in).Inc()
+	}
+	stack := debug.Stack()
+	r.guard("abort", func() {
+		r.log.Error("room panic",
+			zap.String("room", r.id),
+			zap.String("match", r.matchID),
+			zap.String("in", in),
+			zap.Any("panic", p),
+			zap.ByteString("stack", stack),
+			zap.Stringer("phase", phase),
+			zap.Int64("tick", r.state.Tick),
+			zap.Int64("seed", r.state.Seed),
+			zap.Any("players", replay.Players(r.state)),
+		)
+	})
+	if phase == protocol.RoomPhaseEnded {
+		return
+	}
+	r.guard("abort", func() { r.endAborted("internal error") })
+}
+
+// guard runs fn and logs a panic instead of letting it out. It is for the
+// work around a match, such as owner hooks and closing, where there is no
+// match left to abort.
+func (r *Room) guard(in string, fn func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.log.Error("room panic",
+				zap.String("room", r.id),
+				zap.String("in", in),
+				zap.Any("panic", p),
+				zap.ByteString("stack", debug.Stack()),
+			)
+			if r.metrics != nil {
+				r.metrics.RoomPanics.WithLabelValues(in).Inc()
+			}
+		}
+	}()
+	fn()
+}
+
+// endAborted ends the match without a result or stats.
+func (r *Room) endAborted(reason string) {
+	r.phase = protocol.RoomPhaseEnded
+	r.broadcastRoomOver(battle.Result{Outcome: battle.OutcomeAborted, Reason: reason}, nil)
+	if r.metrics != nil {
+		r.metrics.MatchResults.WithLabelValues(battle.OutcomeAborted.String()).Inc()
+	}
+}
+
+func (r *Room) lastStepTime() time.Time {
+	return time.Unix(0, r.lastStep.Load())
+}
+
+// watchdog flags rooms whose tick has not advanced for Settings.StallAfter.
+// It cannot unstick them; it makes them visible in logs and metrics.
+func (m *Manager) watchdog() {
+	ticker := time.NewTicker(m.settings.StallAfter / 2)
+	defer ticker.Stop()
+
+	stalled := make(map[*Room]bool)
+	for {
+		select {
+		case now := <-ticker.C:
+			m.checkStalls(now, stalled)
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (m *Manager) checkStalls(now time.Time, stalled map[*Room]bool) {
+	m.mu.RLock()
+	rooms := make(map[*Room]bool, len(m.rooms))
+	for _, r := range m.rooms {
+		rooms[r] = true
+	}
+	m.mu.RUnlock()
+
+	for r := range rooms {
+		since := now.Sub(r.lastStepTime())
+		switch {
+		case since > m.settings.StallAfter && !stalled[r]:
+			stalled[r] = true
+			m.log.Warn("room stalled", zap.String("room", r.id), zap.Duration("since_tick", since))
+			if m.metrics != nil {
+				m.metrics.RoomStalls.Inc()
+			}
+		case since <= m.settings.StallAfter && stalled[r]:
+			delete(stalled, r)
+			m.log.Info("room recovered", zap.String("room", r.id))
+		}
+	}
+	for r := range stalled {
+		if !rooms[r] {
+			delete(stalled, r)
+		}
+	}
+	if m.metrics != nil {
+		m.metrics.StalledRooms.Set(float64(len(stalled)))
+	}
+}
@@ -0,0 +1,71 @@
+package room
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/store"
+)
+
+// panicSender panics on every send.
+type panicSender struct{}
+
+func (panicSender) Send(string, protocol.MsgType, proto.Message) error         { panic("send") }
+func (panicSender) SendReliable(string, protocol.MsgType, proto.Message) error { panic("send") }
+
+func TestGuardRecoversAroundTheMatch(t *testing.T) {
+	boom := func(string, string) { panic("hook") }
+	cases := []struct {
+		name   string
+		sender Sender
+		hooks  Hooks
+		run    func(r *Room)
+		phase  protocol.RoomPhase
+	}{
+		{
+			name:  "OnClosed panics",
+			hooks: Hooks{OnClosed: func(string, []string, []string) { panic("hook") }},
+			run:   func(r *Room) { r.closeRoom() },
+			phase: protocol.RoomPhasePlaying,
+		},
+		{
+			name:   "closing flush panics",
+			sender: panicSender{},
+			run: func(r *Room) {
+				r.feed = append(r.feed, feedItem{})
+				r.observers["o"] = struct{}{}
+				r.closeRoom()
+			},
+			phase: protocol.RoomPhasePlaying,
+		},
+		{
+			name:  "OnPlayerRemoved panics",
+			hooks: Hooks{OnPlayerRemoved: boom},
+			run:   func(r *Room) { _ = r.kick("b") },
+			phase: protocol.RoomPhasePlaying,
+		},
+		{
+			name:   "telling players about an abort panics",
+			sender: panicSender{},
+			run:    func(r *Room) { r.abort("tick", "boom") },
+			phase:  protocol.RoomPhaseEnded,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender := tc.sender
+			if sender == nil {
+				sender = &recordSender{}
+			}
+			r := NewRoom("room-1", Spec{Players: []string{"a", "b", "c"}}, testSettings(), sender, store.NewMemoryIdem(), nil, zap.NewNop(), tc.hooks)
+			r.phase = protocol.RoomPhasePlaying
+			tc.run(r)
+			if r.phase != tc.phase {
+				t.Fatalf("phase = %v, want %v", r.phase, tc.phase)
+			}
+		})
+	}
+}
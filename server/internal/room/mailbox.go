@@ -0,0 +1,156 @@
+package room
+
+import "sync"
+
+const (
+	// actionLaneSize bounds queued skills, and separately chat lines.
+	actionLaneSize = 128
+	// inputLaneSize bounds queued movement inputs.
+	inputLaneSize = 64
+)
+
+// mailbox queues events for a room in three lanes:
+//   - control: lifecycle and admin events, never dropped. Events a client can
+//     repeat at will (ready, rematch votes, spectating) are coalesced to one
+//     pending event per player and kind, so they cannot grow the lane;
+//   - play: inputs and skills in arrival order, taken once per tick. An input
+//     replaces the player's pending one unless a skill of theirs came after
+//     it. Skills are dropped when actionLaneSize are queued;
+//   - chat: dropped when the lane is full.
+type mailbox struct {
+	mu      sync.Mutex
+	control []Event
+	// repeats maps a player's repeatable event to its index in control.
+	repeats map[repeatKey]int
+	chat    []Event
+	play    []Event
+	// inputAt maps a player to the index in play of the input a newer one
+	// may still replace.
+	inputAt map[string]int
+	inputs  int
+	skills  int
+	// ready has a value while control or chat are not empty.
+	ready chan struct{}
+}
+
+type repeatKey struct {
+	playerID string
+	kind     EventType
+}
+
+func newMailbox() *mailbox {
+	return &mailbox{
+		repeats: make(map[repeatKey]int),
+		inputAt: make(map[string]int),
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// push queues ev and reports whether it was kept.
+func (mb *mailbox) push(ev Event) bool {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	switch ev.Type {
+	case EventInput:
+		if i, ok := mb.inputAt[ev.PlayerID]; ok {
+			mb.play[i] = ev
+			return true
+		}
+		if mb.inputs >= inputLaneSize {
+			return false
+		}
+		mb.inputAt[ev.PlayerID] = len(mb.play)
+		mb.play = append(mb.play, ev)
+		mb.inputs++
+		return true
+	case EventSkill:
+		if mb.skills >= actionLaneSize {
+			return false
+		}
+		// The skill must see the player's earlier input, so a later one
+		// queues behind it.
+		delete(mb.inputAt, ev.PlayerID)
+		mb.play = append(mb.play, ev)
+		mb.skills++
+		return true
+	case EventChat:
+		if len(mb.chat) >= actionLaneSize {
+			return false
+		}
+		mb.chat = append(mb.chat, ev)
+	default:
+		kind, ok := repeatKind(ev.Type)
+		if !ok {
+			mb.control = append(mb.control, ev)
+			break
+		}
+		key := repeatKey{ev.PlayerID, kind}
+		if i, ok := mb.repeats[key]; ok {
+			mb.control[i] = coalesce(mb.control[i], ev)
+			return true
+		}
+		mb.repeats[key] = len(mb.control)
+		mb.control = append(mb.control, ev)
+	}
+	select {
+	case mb.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// repeatKind groups the events a client can send over and over. Spectate and
+// unspectate share a kind: only the last one matters. Joins are left alone;
+// each takes a fresh login and must stay ordered against disconnects.
+func repeatKind(t EventType) (EventType, bool) {
+	switch t {
+	case EventReady, EventRematchVote:
+		return t, true
+	case EventSpectate, EventUnspectate:
+		return EventSpectate, true
+	default:
+		return 0, false
+	}
+}
+
+// coalesce merges a repeated event into the pending one. A rematch decline
+// sticks; otherwise the newer event wins.
+func coalesce(pending, ev Event) Event {
+	if ev.Type == EventRematchVote {
+		ev.Accept = ev.Accept && pending.Accept
+	}
+	return ev
+}
+
+// take returns the queued control events followed by chat.
+func (mb *mailbox) take() []Event {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if len(mb.control) == 0 && len(mb.chat) == 0 {
+		return nil
+	}
+	evs := append(mb.control, mb.chat...)
+	mb.control = nil
+	mb.chat = nil
+	clear(mb.repeats)
+	return evs
+}
+
+// takePlay returns the inputs and skills queued since the last tick, in
+// arrival order.
+func (mb *mailbox) takePlay() []Event {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if len(mb.play) == 0 {
+		return nil
+	}
+	evs := mb.play
+	mb.play = nil
+	mb.inputs = 0
+	mb.skills = 0
+	clear(mb.inputAt)
+	return evs
+}
@@ -0,0 +1,155 @@
+package room
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"miniarena/pkg/protocol"
+)
+
+// brief names an event by type, player and, where it has one, the detail
+// that tells events of that type apart.
+func brief(ev Event) string {
+	s := ev.Type.String() + ":" + ev.PlayerID
+	switch {
+	case ev.Input != nil:
+		s += ":" + fmt.Sprint(ev.Input.Dx)
+	case ev.Type == EventRematchVote && ev.Accept:
+		s += ":yes"
+	case ev.Type == EventRematchVote:
+		s += ":no"
+	}
+	return s
+}
+
+func briefs(evs []Event) []string {
+	var out []string
+	for _, ev := range evs {
+		out = append(out, brief(ev))
+	}
+	return out
+}
+
+func input(pid string, dx float32) Event {
+	return Event{Type: EventInput, PlayerID: pid, Input: &protocol.PlayerInput{Dx: dx}}
+}
+
+func skill(pid string) Event {
+	return Event{Type: EventSkill, PlayerID: pid, Skill: &protocol.SkillCast{}}
+}
+
+func TestMailbox(t *testing.T) {
+	cases := []struct {
+		name    string
+		push    []Event
+		control []string
+		play    []string
+	}{
+		{
+			name:    "lanes",
+			push:    []Event{input("a", 1), {Type: EventChat, PlayerID: "a"}, skill("b"), {Type: EventLeave, PlayerID: "c"}},
+			control: []string{"leave:c", "chat:a"},
+			play:    []string{"input:a:1", "skill:b"},
+		},
+		{
+			name: "newer input replaces the pending one",
+			push: []Event{input("a", 1), input("b", 1), input("a", 2)},
+			play: []string{"input:a:2", "input:b:1"},
+		},
+		{
+			name: "skill keeps the input before it",
+			push: []Event{input("a", 1), skill("a"), input("a", 2), input("a", 3)},
+			play: []string{"input:a:1", "skill:a", "input:a:3"},
+		},
+		{
+			name: "another player's skill does not pin an input",
+			push: []Event{input("a", 1), skill("b"), input("a", 2)},
+			play: []string{"input:a:2", "skill:b"},
+		},
+		{
+			name: "repeated ready is coalesced",
+			push: []Event{
+				{Type: EventReady, PlayerID: "a"},
+				{Type: EventDisconnect, PlayerID: "b"},
+				{Type: EventReady, PlayerID: "a"},
+				{Type: EventReady, PlayerID: "b"},
+			},
+			control: []string{"ready:a", "disconnect:b", "ready:b"},
+		},
+		{
+			name: "a rematch decline sticks",
+			push: []Event{
+				{Type: EventRematchVote, PlayerID: "a"},
+				{Type: EventRematchVote, PlayerID: "a", Accept: true},
+				{Type: EventRematchVote, PlayerID: "b", Accept: true},
+				{Type: EventRematchVote, PlayerID: "b", Accept: true},
+			},
+			control: []string{"rematch_vote:a:no", "rematch_vote:b:yes"},
+		},
+		{
+			name: "last of spectate and unspectate wins",
+			push: []Event{
+				{Type: EventSpectate, PlayerID: "a"},
+				{Type: EventUnspectate, PlayerID: "a"},
+				{Type: EventSpectate, PlayerID: "a"},
+				{Type: EventUnspectate, PlayerID: "a"},
+			},
+			control: []string{"unspectate:a"},
+		},
+		{
+			name: "joins are kept in order with disconnects",
+			push: []Event{
+				{Type: EventDisconnect, PlayerID: "a"},
+				{Type: EventJoin, PlayerID: "a"},
+				{Type: EventDisconnect, PlayerID: "a"},
+				{Type: EventJoin, PlayerID: "a"},
+			},
+			control: []string{"disconnect:a", "join:a", "disconnect:a", "join:a"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mb := newMailbox()
+			for _, ev := range tc.push {
+				if !mb.push(ev) {
+					t.Fatalf("%s dropped", brief(ev))
+				}
+			}
+			if got := briefs(mb.take()); !reflect.DeepEqual(got, tc.control) {
+				t.Fatalf("take() = %v, want %v", got, tc.control)
+			}
+			if got := briefs(mb.takePlay()); !reflect.DeepEqual(got, tc.play) {
+				t.Fatalf("takePlay() = %v, want %v", got, tc.play)
+			}
+			if mb.take() != nil || mb.takePlay() != nil {
+				t.Fatal("mailbox not empty after taking")
+			}
+		})
+	}
+}
+
+func TestMailboxBounds(t *testing.T) {
+	cases := []struct {
+		name string
+		ev   func(i int) Event
+		kept int
+	}{
+		{name: "inputs", ev: func(i int) Event { return input(fmt.Sprint(i), 1) }, kept: inputLaneSize},
+		{name: "skills", ev: func(int) Event { return skill("a") }, kept: actionLaneSize},
+		{name: "chat", ev: func(int) Event { return Event{Type: EventChat, PlayerID: "a"} }, kept: actionLaneSize},
+		{name: "repeated ready", ev: func(int) Event { return Event{Type: EventReady, PlayerID: "a"} }, kept: 1},
+		{name: "leaves", ev: func(i int) Event { return Event{Type: EventLeave, PlayerID: fmt.Sprint(i)} }, kept: 2 * actionLaneSize},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mb := newMailbox()
+			for i := 0; i < 2*actionLaneSize; i++ {
+				mb.push(tc.ev(i))
+			}
+			if got := len(mb.take()) + len(mb.takePlay()); got != tc.kept {
+				t.Fatalf("kept %d events, want %d", got, tc.kept)
+			}
+		})
+	}
+}
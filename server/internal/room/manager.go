@@ -1,59 +1,151 @@
 package room
 
 import (
+	"math/rand"
 	"sync"
-	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"miniarena/server/internal/battle"
 	"miniarena/server/internal/metrics"
 	"miniarena/server/internal/store"
 )
 
 type Manager struct {
-	mu      sync.RWMutex
-	rooms   map[string]*Room
-	tick    time.Duration
-	sender  Sender
-	idem    store.Idempotency
-	metrics *metrics.Metrics
-	log     *zap.Logger
-	onRoomClosed func(roomID string, players []string)
+	mu       sync.RWMutex
+	rooms    map[string]*Room
+	settings Settings
+	sender   Sender
+	idem     store.Idempotency
+	metrics  *metrics.Metrics
+	log      *zap.Logger
+	hooks    Hooks
+	// sched is nil when every room runs its own goroutine.
+	sched    *scheduler
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
-func NewManager(tick time.Duration, sender Sender, idem store.Idempotency, metrics *metrics.Metrics, log *zap.Logger, onRoomClosed func(roomID string, players []string)) *Manager {
-	return &Manager{
-		rooms:   make(map[string]*Room),
-		tick:    tick,
-		sender:  sender,
-		idem:    idem,
-		metrics: metrics,
-		log:     log,
-		onRoomClosed: onRoomClosed,
+func NewManager(settings Settings, sender Sender, idem store.Idempotency, metrics *metrics.Metrics, log *zap.Logger, hooks Hooks) *Manager {
+	m := &Manager{
+		rooms:    make(map[string]*Room),
+		settings: settings,
+		sender:   sender,
+		idem:     idem,
+		metrics:  metrics,
+		log:      log,
+		hooks:    hooks,
+		stop:     make(chan struct{}),
 	}
+	if settings.Shards > 0 {
+		m.sched = newScheduler(settings.Shards, settings.Tick)
+	}
+	if settings.StallAfter > 0 {
+		go m.watchdog()
+	}
+	return m
+}
+
+// DefaultRules returns the rules for matchmade rooms. They name no map; see
+// PickMap.
+func (m *Manager) DefaultRules() battle.Rules {
+	return m.settings.Rules
+}
+
+// Map looks up a map by ID.
+func (m *Manager) Map(id string) (battle.Map, bool) {
+	for _, mp := range m.maps() {
+		if mp.ID == id {
+			return mp, true
+		}
+	}
+	return battle.Map{}, false
+}
+
+// PickMap returns a random map with a spawn point for each of the players.
+func (m *Manager) PickMap(players int) battle.Map {
+	var fit []battle.Map
+	for _, mp := range m.maps() {
+		if len(mp.Spawns) >= players {
+			fit = append(fit, mp)
+		}
+	}
+	if len(fit) == 0 {
+		return battle.DefaultMap()
+	}
+	return fit[rand.Intn(len(fit))]
+}
+
+func (m *Manager) maps() []battle.Map {
+	if len(m.settings.Maps) == 0 {
+		return []battle.Map{battle.DefaultMap()}
+	}
+	return m.settings.Maps
 }
 
-func (m *Manager) CreateRoom(matchID string, players []string) string {
+func (m *Manager) CreateRoom(spec Spec) string {
 	roomID := uuid.NewString()
-	room := NewRoom(roomID, matchID, players, m.tick, m.sender, m.idem, m.metrics, m.log, m.closeRoom)
+	hooks := Hooks{OnClosed: m.closeRoom, OnPlayerRemoved: m.hooks.OnPlayerRemoved, OnRematch: m.rematch}
+	m.start(NewRoom(roomID, spec, m.settings, m.sender, m.idem, m.metrics, m.log, hooks))
+	return roomID
+}
 
+func (m *Manager) start(room *Room) {
+	var sh *shard
+	if m.sched != nil {
+		sh = m.sched.bind(room)
+	}
 	m.mu.Lock()
-	m.rooms[roomID] = room
+	m.rooms[room.id] = room
 	m.mu.Unlock()
 
-	room.Start()
-	return roomID
+	if sh != nil {
+		sh.adopt(room)
+	} else {
+		room.Start()
+	}
 }
 
-func (m *Manager) SendEvent(roomID string, ev Event) {
+// Stop ends every room without a result.
+func (m *Manager) Stop() {
+	m.mu.RLock()
+	for _, room := range m.rooms {
+		room.Stop()
+	}
+	m.mu.RUnlock()
+	if m.sched != nil {
+		m.sched.stop()
+	}
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// Len returns the number of live rooms.
+func (m *Manager) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.rooms)
+}
+
+// SendEvent delivers ev to the room and reports whether the room exists.
+func (m *Manager) SendEvent(roomID string, ev Event) bool {
 	m.mu.RLock()
 	room := m.rooms[roomID]
 	m.mu.RUnlock()
 	if room == nil {
-		return
+		return false
 	}
 	room.SendEvent(ev)
+	return true
+}
+
+// rematch starts a new room for players who all voted for a rematch,
+// bypassing matchmaking.
+func (m *Manager) rematch(spec Spec) {
+	roomID := m.CreateRoom(spec)
+	if m.hooks.OnRematchStarted != nil {
+		m.hooks.OnRematchStarted(roomID, spec)
+	}
 }
 
 func (m *Manager) remove(roomID string) {
@@ -62,9 +154,9 @@ func (m *Manager) remove(roomID string) {
 	m.mu.Unlock()
 }
 
-func (m *Manager) closeRoom(roomID string, players []string) {
+func (m *Manager) closeRoom(roomID string, players, observers []string) {
 	m.remove(roomID)
-	if m.onRoomClosed != nil {
-		m.onRoomClosed(roomID, players)
+	if m.hooks.OnClosed != nil {
+		m.hooks.OnClosed(roomID, players, observers)
 	}
 }
@@ -0,0 +1,155 @@
+package room
+
+import (
+	"flag"
+	"math"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/metrics"
+	"miniarena/server/internal/store"
+)
+
+var (
+	benchRooms  = flag.Int("bench.rooms", 1000, "bot-vs-bot rooms running while benchmarking ticks")
+	benchShards = flag.Int("bench.shards", runtime.GOMAXPROCS(0), "scheduler shards for the sharded model")
+)
+
+// benchMetrics registers the metrics once; registering twice panics.
+var benchMetrics = sync.OnceValue(metrics.NewMetrics)
+
+// nopRoomSender discards everything rooms send.
+type nopRoomSender struct{}
+
+func (nopRoomSender) Send(string, protocol.MsgType, proto.Message) error         { return nil }
+func (nopRoomSender) SendReliable(string, protocol.MsgType, proto.Message) error { return nil }
+
+// BenchmarkRoomTicks runs bot-vs-bot rooms with a goroutine per room and then
+// with the sharded scheduler. An op is one tick interval; tick delay and
+// process CPU over the run are reported per model.
+func BenchmarkRoomTicks(b *testing.B) {
+	for _, model := range []struct {
+		name   string
+		shards int
+	}{
+		{"per-room", 0},
+		{"sharded/" + strconv.Itoa(*benchShards), *benchShards},
+	} {
+		b.Run(model.name, func(b *testing.B) {
+			rooms := startBenchRooms(*benchRooms, model.shards)
+			defer func() {
+				rooms.Stop()
+				for rooms.Len() > 0 {
+					time.Sleep(10 * time.Millisecond)
+				}
+			}()
+			// Let every room finish its ready check and countdown.
+			time.Sleep(time.Second)
+
+			before := tickDelay(b)
+			cpu := cpuTime(b)
+			start := time.Now()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				time.Sleep(rooms.settings.Tick)
+			}
+			b.StopTimer()
+			wall := time.Since(start)
+			cpu = cpuTime(b) - cpu
+			delay := tickDelay(b).sub(before)
+
+			b.ReportMetric(delay.sum/float64(delay.count), "delay-mean-ms")
+			b.ReportMetric(delay.quantile(0.5), "delay-p50-ms")
+			b.ReportMetric(delay.quantile(0.99), "delay-p99-ms")
+			b.ReportMetric(cpu.Seconds()/wall.Seconds(), "cores")
+		})
+	}
+}
+
+func startBenchRooms(n, shards int) *Manager {
+	rules := battle.DefaultRules(2)
+	// Nobody should win while we measure.
+	rules.MaxHP = math.MaxInt32
+	rules.TimeLimitTicks = 0
+	settings := Settings{
+		Tick:         50 * time.Millisecond,
+		ReadyTimeout: time.Second,
+		Rules:        rules,
+		AI:           AISettings{Difficulty: DifficultyNormal},
+		Shards:       shards,
+	}
+	rooms := NewManager(settings, nopRoomSender{}, store.NewMemoryIdem(), benchMetrics(), zap.NewNop(), Hooks{})
+	for i := 0; i < n; i++ {
+		rooms.CreateRoom(Spec{
+			MatchID: strconv.Itoa(i),
+			Bots:    []string{NewBotID(), NewBotID()},
+			Rules:   rules,
+		})
+	}
+	return rooms
+}
+
+type histogram struct {
+	count   uint64
+	sum     float64
+	bounds  []float64
+	buckets []uint64
+}
+
+// tickDelay reads arena_room_tick_delay_ms from the default registry.
+func tickDelay(b *testing.B) histogram {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "arena_room_tick_delay_ms" {
+			continue
+		}
+		h := f.GetMetric()[0].GetHistogram()
+		out := histogram{count: h.GetSampleCount(), sum: h.GetSampleSum()}
+		for _, bk := range h.GetBucket() {
+			out.bounds = append(out.bounds, bk.GetUpperBound())
+			out.buckets = append(out.buckets, bk.GetCumulativeCount())
+		}
+		return out
+	}
+	return histogram{}
+}
+
+func (h histogram) sub(o histogram) histogram {
+	out := histogram{count: h.count - o.count, sum: h.sum - o.sum, bounds: h.bounds}
+	for i := range h.buckets {
+		out.buckets = append(out.buckets, h.buckets[i]-o.buckets[i])
+	}
+	return out
+}
+
+// quantile returns the upper bound of the bucket holding q, or +Inf.
+func (h histogram) quantile(q float64) float64 {
+	want := uint64(math.Ceil(q * float64(h.count)))
+	for i, c := range h.buckets {
+		if c >= want {
+			return h.bounds[i]
+		}
+	}
+	return math.Inf(1)
+}
+
+func cpuTime(b *testing.B) time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		b.Fatal(err)
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
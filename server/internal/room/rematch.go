@@ -0,0 +1,86 @@
+package room
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"miniarena/pkg/protocol"
+)
+
+// After a match that was played out the room stays open in the Ended phase
+// for Settings.RematchWindow. If every player votes yes in time the room asks
+// for a new room with the same seats; bots always agree. A player who
+// forfeited or was kicked cannot vote and counts as declining, so no vote is
+// opened for such a match.
+//
+// Sessions stay bound to the room while the vote is open; that is how votes
+// reach it. A player who wants out leaves or queues again, which declines the
+// rematch and closes the room.
+
+// rematchAllowed reports whether the seats can be played again: every human
+// is still in the match and there is at least one to vote.
+func (r *Room) rematchAllowed() bool {
+	voters := 0
+	for _, pid := range r.players {
+		if r.bots[pid] {
+			continue
+		}
+		if p := r.state.Players[pid]; p == nil || p.Forfeited {
+			return false
+		}
+		voters++
+	}
+	return voters > 0
+}
+
+func (r *Room) handleRematchVote(playerID string, accept bool) {
+	if r.rematchEnd.IsZero() || !r.isPlayer(playerID) || r.bots[playerID] {
+		return
+	}
+	if !accept {
+		r.endRematch(protocol.RematchStatusDeclined)
+		return
+	}
+	r.rematchVotes[playerID] = true
+	for _, pid := range r.players {
+		if !r.bots[pid] && !r.rematchVotes[pid] {
+			r.broadcastRematch(protocol.RematchStatusVoting, time.Now())
+			return
+		}
+	}
+
+	r.endRematch(protocol.RematchStatusAccepted)
+	spec := Spec{MatchID: uuid.NewString(), Rules: r.state.Rules}
+	for _, pid := range r.players {
+		if r.bots[pid] {
+			spec.Bots = append(spec.Bots, pid)
+		} else {
+			spec.Players = append(spec.Players, pid)
+		}
+	}
+	if r.hooks.OnRematch != nil {
+		r.guard("on_rematch", func() { r.hooks.OnRematch(spec) })
+	}
+}
+
+// endRematch closes voting; the room closes on its next tick.
+func (r *Room) endRematch(status protocol.RematchStatus) {
+	r.broadcastRematch(status, time.Now())
+	r.rematchEnd = time.Time{}
+}
+
+func (r *Room) broadcastRematch(status protocol.RematchStatus, now time.Time) {
+	msg := &protocol.RematchState{RoomId: r.id, Status: status}
+	if status == protocol.RematchStatusVoting {
+		msg.RemainingMs = int32(r.rematchEnd.Sub(now).Milliseconds())
+	}
+	for _, pid := range r.players {
+		if r.bots[pid] || r.rematchVotes[pid] {
+			msg.Accepted = append(msg.Accepted, pid)
+		}
+	}
+	for _, pid := range r.players {
+		_ = r.sender.Send(pid, protocol.MsgRematchState, msg)
+	}
+}
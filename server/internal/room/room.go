@@ -2,51 +2,209 @@ package room
 
 import (
 	"context"
+	"math/rand"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gogo/protobuf/proto"
 	"go.uber.org/zap"
 
 	"miniarena/pkg/protocol"
 	"miniarena/server/internal/battle"
+	"miniarena/server/internal/chat"
 	"miniarena/server/internal/metrics"
+	"miniarena/server/internal/replay"
 	"miniarena/server/internal/store"
 )
 
+// minPlayers is the smallest number of ready players a match starts with.
+const minPlayers = 2
+
 type Sender interface {
 	Send(playerID string, msgType protocol.MsgType, msg proto.Message) error
+	SendReliable(playerID string, msgType protocol.MsgType, msg proto.Message) error
+}
+
+// Settings are the room timings shared by every room of a manager.
+type Settings struct {
+	Tick         time.Duration
+	ReadyTimeout time.Duration
+	Countdown    time.Duration
+	// MaxSpectators caps observers per room; 0 disables spectating.
+	MaxSpectators int
+	// SpectatorDelay holds snapshots back from observers to prevent ghosting.
+	SpectatorDelay time.Duration
+	// Rules are used for rooms created by matchmaking.
+	Rules battle.Rules
+	// Maps are the arenas rooms are played on. Empty plays every match on
+	// battle.DefaultMap.
+	Maps []battle.Map
+	Chat chat.Settings
+	// Replays stores a recording of every finished match; nil disables
+	// recording.
+	Replays replay.Store
+	// Matches persists results; nil skips it.
+	Matches store.Matches
+	// DisconnectGrace is how long a disconnected player keeps their place
+	// before forfeiting; 0 forfeits at once.
+	DisconnectGrace time.Duration
+	AI              AISettings
+	// RematchWindow is how long players can vote for a rematch after a
+	// match; 0 closes the room right away.
+	RematchWindow time.Duration
+	// Checkpoints stores snapshots of matches in progress every
+	// CheckpointEvery; nil disables them. ResumeWithin is how long a
+	// restored match waits for its players.
+	Checkpoints     store.Checkpoints
+	CheckpointEvery time.Duration
+	ResumeWithin    time.Duration
+	// StallAfter is how long a room may go without a tick before the
+	// watchdog flags it; 0 disables the watchdog.
+	StallAfter time.Duration
+	// Shards is the number of scheduler workers that tick rooms; 0 gives
+	// each room its own goroutine and ticker.
+	Shards int
+}
+
+// Spec describes the match a room is created for.
+type Spec struct {
+	MatchID string
+	Players []string
+	// Bots are extra seats played by the server AI. They start ready.
+	Bots  []string
+	Rules battle.Rules
+}
+
+// Teams returns the team of every seat, players then bots, or nil in a
+// free-for-all.
+func (s Spec) Teams() []int32 {
+	if s.Rules.TeamSize < 2 {
+		return nil
+	}
+	teams := make([]int32, len(s.Players)+len(s.Bots))
+	for i := range teams {
+		teams[i] = s.Rules.TeamOf(i)
+	}
+	return teams
+}
+
+// Hooks let the owner react to players leaving a room.
+type Hooks struct {
+	// OnClosed runs after the room loop exits.
+	OnClosed func(roomID string, players, observers []string)
+	// OnPlayerRemoved runs when a player is dropped before the match starts.
+	OnPlayerRemoved func(roomID, playerID string)
+	// OnRematch asks for a new room once every player voted for a rematch.
+	OnRematch func(spec Spec)
+	// OnRematchStarted runs after the Manager created a rematch room.
+	OnRematchStarted func(roomID string, spec Spec)
+	// OnRecovered runs for every checkpoint Manager.Recover loads, before
+	// the room resumes (resumed) or the match is settled as aborted.
+	OnRecovered func(cp store.Checkpoint, resumed bool)
 }
 
 type Room struct {
-	id        string
-	matchID   string
-	players   []string
-	events    chan Event
-	state     *battle.State
-	tick      time.Duration
-	sender    Sender
-	idem      store.Idempotency
-	metrics   *metrics.Metrics
-	log       *zap.Logger
-	done      chan struct{}
-	onClose   func(roomID string, players []string)
-}
-
-func NewRoom(id, matchID string, players []string, tick time.Duration, sender Sender, idem store.Idempotency, metrics *metrics.Metrics, log *zap.Logger, onClose func(roomID string, players []string)) *Room {
-	return &Room{
-		id:      id,
-		matchID: matchID,
-		players: players,
-		events:  make(chan Event, 128),
-		state:   battle.NewState(players),
-		tick:    tick,
-		sender:  sender,
-		idem:    idem,
-		metrics: metrics,
-		log:     log,
-		done:    make(chan struct{}),
-		onClose: onClose,
+	id       string
+	matchID  string
+	players  []string
+	mail     *mailbox
+	state    *battle.State
+	settings Settings
+	sender   Sender
+	idem     store.Idempotency
+	metrics  *metrics.Metrics
+	log      *zap.Logger
+	done     chan struct{}
+	hooks    Hooks
+	// wake is set when a scheduler shard drives the room.
+	wake      chan<- *Room
+	createdAt time.Time
+	// lastStep is when the last tick finished, in Unix nanoseconds. The
+	// watchdog reads it from another goroutine.
+	lastStep atomic.Int64
+
+	phase protocol.RoomPhase
+	ready map[string]bool
+	// notPlayingSent maps players to the phase they were last told the room
+	// is not playing in, so input spam before the start gets one error.
+	notPlayingSent map[string]protocol.RoomPhase
+	// phaseEnd is the ready deadline while waiting and the start time while
+	// counting down.
+	phaseEnd time.Time
+
+	// disconnected maps players waiting to reconnect to their forfeit
+	// deadline.
+	disconnected map[string]time.Time
+	// controllers are the players the server AI plays for.
+	controllers map[string]Controller
+	bots        map[string]bool
+
+	observers map[string]struct{}
+	// feed holds what observers have not seen yet: recent snapshots and,
+	// once the match is over, RoomOver. They see the oldest entry.
+	feed []feedItem
+
+	chatLimit   *chat.Limiter
+	chatHistory *chat.History
+
+	// rec records the match from the end of the ready check.
+	rec *replay.Recorder
+
+	// rematchEnd is the voting deadline while a rematch vote is open.
+	rematchEnd   time.Time
+	rematchVotes map[string]bool
+
+	nextCheckpoint time.Time
+	// ckptDone is closed when the last checkpoint save has finished.
+	ckptDone     chan struct{}
+	checkpointed bool
+	names        map[string]string
+	// resumeBy is set while a restored room waits for its players.
+	resumeBy time.Time
+}
+
+func NewRoom(id string, spec Spec, settings Settings, sender Sender, idem store.Idempotency, metrics *metrics.Metrics, log *zap.Logger, hooks Hooks) *Room {
+	players := append(append([]string(nil), spec.Players...), spec.Bots...)
+	state := battle.NewState(players, spec.Rules, rand.Int63())
+	r := &Room{
+		id:       id,
+		matchID:  spec.MatchID,
+		players:  players,
+		mail:     newMailbox(),
+		state:    state,
+		settings: settings,
+		sender:   sender,
+		idem:     idem,
+		metrics:  metrics,
+		log:      log,
+		done:     make(chan struct{}),
+		hooks:    hooks,
+
+		createdAt: time.Now(),
+		phase:     protocol.RoomPhaseWaiting,
+		ready:     make(map[string]bool, len(players)),
+		phaseEnd:  time.Now().Add(settings.ReadyTimeout),
+
+		disconnected: make(map[string]time.Time),
+		controllers:  make(map[string]Controller),
+		bots:         make(map[string]bool, len(spec.Bots)),
+		observers:    make(map[string]struct{}),
+		rematchVotes: make(map[string]bool),
+
+		chatLimit:   chat.NewLimiter(settings.Chat.RateLimit, settings.Chat.RateWindow),
+		chatHistory: chat.NewHistory(settings.Chat.History),
+	}
+	r.lastStep.Store(r.createdAt.UnixNano())
+	r.ckptDone = make(chan struct{})
+	close(r.ckptDone)
+	for _, pid := range spec.Bots {
+		r.bots[pid] = true
+		r.ready[pid] = true
+		r.controllers[pid] = r.newController()
 	}
+	return r
 }
 
 func (r *Room) ID() string { return r.id }
@@ -64,32 +222,35 @@ func (r *Room) Stop() {
 	}
 }
 
+// SendEvent queues ev for the room loop. Lifecycle and admin events are never
+// dropped; inputs and skills are applied on the next tick.
 func (r *Room) SendEvent(ev Event) {
-	select {
-	case r.events <- ev:
-	default:
-		r.log.Warn("room event dropped", zap.String("room", r.id))
+	if !r.mail.push(ev) {
+		r.log.Warn("room event dropped", zap.String("room", r.id), zap.Stringer("type", ev.Type))
+		if r.metrics != nil {
+			r.metrics.RoomEventsDropped.WithLabelValues(ev.Type.String()).Inc()
+		}
+		return
+	}
+	if r.wake != nil && ev.Type != EventInput && ev.Type != EventSkill {
+		select {
+		case r.wake <- r:
+		default:
+		}
 	}
 }
 
 func (r *Room) loop() {
-	ticker := time.NewTicker(r.tick)
+	ticker := time.NewTicker(r.settings.Tick)
 	defer ticker.Stop()
 	defer r.closeRoom()
 
 	for {
 		select {
-		case ev := <-r.events:
-			r.handleEvent(ev)
-		case <-ticker.C:
-			start := time.Now()
-			r.state.TickForward()
-			r.broadcastSnapshot()
-			if r.metrics != nil {
-				r.metrics.RoomTickDelay.Observe(float64(time.Since(start).Milliseconds()))
-			}
-			if winner, ok := r.state.Winner(); ok {
-				r.broadcastRoomOver(winner)
+		case <-r.mail.ready:
+			r.drain()
+		case now := <-ticker.C:
+			if r.safeStep(now) {
 				return
 			}
 		case <-r.done:
@@ -98,30 +259,478 @@ func (r *Room) loop() {
 	}
 }
 
+// drain handles the events queued so far without blocking. Events that
+// arrive meanwhile wait for the next call so one busy room cannot hold up the
+// rest of its shard.
+func (r *Room) drain() {
+	for _, ev := range r.mail.take() {
+		r.safeHandle(ev)
+	}
+}
+
+func (r *Room) stopped() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// step advances the room by one tick and reports whether it is finished.
+func (r *Room) step(now time.Time) bool {
+	for _, ev := range r.mail.takePlay() {
+		r.handleEvent(ev)
+	}
+	switch r.phase {
+	case protocol.RoomPhaseEnded:
+		// Either ended outside the tick, e.g. by an admin, or waiting for
+		// rematch votes. Observers still play out the delayed feed up to
+		// RoomOver.
+		if len(r.feed) > 0 {
+			r.popFeed()
+		}
+		if r.rematchEnd.IsZero() {
+			return len(r.feed) == 0
+		}
+		if now.Before(r.rematchEnd) {
+			return false
+		}
+		r.endRematch(protocol.RematchStatusExpired)
+		return true
+	case protocol.RoomPhaseWaiting:
+		if !r.allReady() && now.Before(r.phaseEnd) {
+			break
+		}
+		r.dropUnready()
+		// A team match also needs someone left to play against.
+		if len(r.players) < minPlayers || r.state.Sides() < 2 {
+			r.phase = protocol.RoomPhaseEnded
+			r.broadcastRoomOver(battle.Result{Outcome: battle.OutcomeAbandoned, Reason: "not enough players ready"}, nil)
+			return true
+		}
+		r.phase = protocol.RoomPhaseCountdown
+		r.phaseEnd = now.Add(r.settings.Countdown)
+		if r.settings.Replays != nil {
+			r.rec = replay.NewRecorder(r.matchID, r.id, r.state)
+		}
+	case protocol.RoomPhaseCountdown:
+		if !r.resumeBy.IsZero() {
+			if r.stepResume(now) {
+				return true
+			}
+			break
+		}
+		r.expireGrace(now)
+		if now.Before(r.phaseEnd) {
+			break
+		}
+		r.phase = protocol.RoomPhasePlaying
+	case protocol.RoomPhasePlaying:
+		r.expireGrace(now)
+		r.driveControllers()
+		r.state.TickForward()
+		if r.rec != nil {
+			r.rec.Tick(r.state)
+		}
+		r.broadcastSnapshot(now)
+		if r.metrics != nil {
+			// Measured from when the tick fired, so time spent waiting
+			// for the goroutine or other rooms on the shard counts.
+			r.metrics.RoomTickDelay.Observe(float64(time.Since(now).Microseconds()) / 1000)
+		}
+		if res, ok := r.state.Result(); ok {
+			r.phase = protocol.RoomPhaseEnded
+			r.saveReplay(res)
+			if r.settings.RematchWindow > 0 && r.rematchAllowed() {
+				r.rematchEnd = now.Add(r.settings.RematchWindow)
+			}
+			r.broadcastRoomOver(res, r.state.Stats(res))
+			return r.rematchEnd.IsZero() && len(r.feed) == 0
+		}
+		r.checkpoint(now)
+		return false
+	}
+	r.broadcastSnapshot(now)
+	return false
+}
+
 func (r *Room) handleEvent(ev Event) {
 	switch ev.Type {
 	case EventJoin:
-		// Reserved for future use.
+		if !r.isPlayer(ev.PlayerID) {
+			return
+		}
+		if _, ok := r.disconnected[ev.PlayerID]; ok {
+			delete(r.disconnected, ev.PlayerID)
+			delete(r.controllers, ev.PlayerID)
+			r.notifyConnection(ev.PlayerID, true, 0)
+		}
+		r.sendSnapshot(ev.PlayerID, time.Now())
+		r.sendChatHistory(ev.PlayerID)
+	case EventDisconnect:
+		r.handleDisconnect(ev.PlayerID)
 	case EventLeave:
-		p := r.state.Players[ev.PlayerID]
-		if p != nil {
-			p.HP = 0
+		if r.phase == protocol.RoomPhaseEnded {
+			r.handleRematchVote(ev.PlayerID, false)
+			return
 		}
+		delete(r.disconnected, ev.PlayerID)
+		if r.phase == protocol.RoomPhaseWaiting {
+			delete(r.ready, ev.PlayerID)
+			return
+		}
+		r.forfeit(ev.PlayerID)
+	case EventReady:
+		if r.phase == protocol.RoomPhaseWaiting && r.isPlayer(ev.PlayerID) {
+			r.ready[ev.PlayerID] = true
+		}
+	case EventSpectate:
+		r.addObserver(ev.PlayerID)
+	case EventUnspectate:
+		delete(r.observers, ev.PlayerID)
+	case EventChat:
+		r.handleChat(ev.PlayerID, ev.Chat)
+	case EventRematchVote:
+		r.handleRematchVote(ev.PlayerID, ev.Accept)
+	case EventInspect, EventForceEnd, EventKick, EventAnnounce:
+		r.handleAdmin(ev)
 	case EventInput:
+		if r.rejectOutsidePlay(ev.PlayerID) {
+			return
+		}
 		r.state.ApplyInput(ev.PlayerID, ev.Input)
+		if r.rec != nil {
+			r.rec.Input(r.state.Tick, ev.PlayerID, ev.Input)
+		}
 	case EventSkill:
+		if r.rejectOutsidePlay(ev.PlayerID) {
+			return
+		}
+		// Unknown skills never reach the battle, so replays only hold casts
+		// the catalog knows about.
+		if _, _, ok := r.state.Rules.Skill(ev.Skill.SkillId); !ok {
+			_ = r.sender.Send(ev.PlayerID, protocol.MsgErrorResp, &protocol.ErrorResp{Code: 400, Message: "unknown skill"})
+			return
+		}
 		r.state.ApplySkill(ev.PlayerID, ev.Skill)
+		if r.rec != nil {
+			r.rec.Skill(r.state.Tick, ev.PlayerID, ev.Skill)
+		}
+	}
+}
+
+// handleDisconnect keeps a dropped player in the match for the grace period.
+// While waiting the player just loses their ready flag, since the ready check
+// already drops anyone who does not come back.
+func (r *Room) handleDisconnect(playerID string) {
+	if !r.isPlayer(playerID) || r.phase == protocol.RoomPhaseEnded {
+		return
+	}
+	switch {
+	case r.phase == protocol.RoomPhaseWaiting:
+		delete(r.ready, playerID)
+		r.disconnected[playerID] = time.Time{}
+		r.notifyConnection(playerID, false, 0)
+	case r.settings.DisconnectGrace <= 0:
+		r.forfeit(playerID)
+	default:
+		r.disconnected[playerID] = time.Now().Add(r.settings.DisconnectGrace)
+		if r.settings.AI.TakeOver {
+			r.controllers[playerID] = r.newController()
+		}
+		r.notifyConnection(playerID, false, r.settings.DisconnectGrace)
+	}
+}
+
+// expireGrace forfeits players whose grace period ran out.
+func (r *Room) expireGrace(now time.Time) {
+	for pid, deadline := range r.disconnected {
+		if deadline.IsZero() || now.Before(deadline) {
+			continue
+		}
+		delete(r.disconnected, pid)
+		r.forfeit(pid)
+	}
+}
+
+func (r *Room) forfeit(playerID string) {
+	if !r.bots[playerID] {
+		delete(r.controllers, playerID)
+	}
+	r.state.Forfeit(playerID)
+	if r.rec != nil {
+		r.rec.Forfeit(r.state.Tick, playerID)
+	}
+}
+
+func (r *Room) newController() Controller {
+	// Seeded from the room so each controller behaves differently.
+	return NewChaseAI(r.settings.AI.Difficulty, r.state.Seed+int64(len(r.controllers)))
+}
+
+// driveControllers applies this tick's AI moves, in seat order. They are
+// recorded like player events, so replays do not need to re-run the AI.
+func (r *Room) driveControllers() {
+	for _, pid := range r.players {
+		c := r.controllers[pid]
+		if c == nil {
+			continue
+		}
+		input, skill := c.Decide(r.state, pid)
+		if input != nil {
+			r.state.ApplyInput(pid, input)
+			if r.rec != nil {
+				r.rec.Input(r.state.Tick, pid, input)
+			}
+		}
+		if skill != nil {
+			r.state.ApplySkill(pid, skill)
+			if r.rec != nil {
+				r.rec.Skill(r.state.Tick, pid, skill)
+			}
+		}
 	}
 }
 
-func (r *Room) broadcastSnapshot() {
+// notifyConnection tells everyone else in the room that playerID dropped or
+// came back.
+func (r *Room) notifyConnection(playerID string, connected bool, grace time.Duration) {
+	msg := &protocol.PlayerConnectionChanged{
+		RoomId:    r.id,
+		PlayerId:  playerID,
+		Connected: connected,
+		GraceMs:   int32(grace.Milliseconds()),
+	}
+	for _, pid := range r.players {
+		if pid != playerID {
+			_ = r.sender.Send(pid, protocol.MsgPlayerConnectionChanged, msg)
+		}
+	}
+	for pid := range r.observers {
+		_ = r.sender.Send(pid, protocol.MsgPlayerConnectionChanged, msg)
+	}
+}
+
+func (r *Room) addObserver(playerID string) {
+	resp := &protocol.SpectateResp{RoomId: r.id}
+	switch {
+	case r.isPlayer(playerID):
+		resp.Reason = "already playing"
+	case len(r.observers) >= r.settings.MaxSpectators:
+		resp.Reason = "spectators full"
+	default:
+		r.observers[playerID] = struct{}{}
+		resp.Ok = true
+	}
+	_ = r.sender.Send(playerID, protocol.MsgSpectateResp, resp)
+	if resp.Ok {
+		r.sendChatHistory(playerID)
+	}
+}
+
+// handleChat relays a player's line to players and observers. Observers are
+// read-only. Chat works in every phase.
+func (r *Room) handleChat(playerID string, msg *protocol.ChatMessage) {
+	if !r.isPlayer(playerID) {
+		return
+	}
+	text := strings.TrimSpace(msg.Text)
+	switch {
+	case text == "":
+		return
+	case r.settings.Chat.MaxLength > 0 && utf8.RuneCountInString(text) > r.settings.Chat.MaxLength:
+		r.rejectChat(playerID, 413, "chat message too long", "too_long")
+		return
+	case !r.chatLimit.Allow(playerID, time.Now()):
+		r.rejectChat(playerID, 429, "chat rate limited", "rate_limited")
+		return
+	}
+	text, masked := r.settings.Chat.Filter.Mask(text)
+	if masked && r.metrics != nil {
+		r.metrics.ChatMasked.Inc()
+	}
+
+	line := &protocol.ChatMessage{
+		RoomId:   r.id,
+		SenderId: playerID,
+		Username: msg.Username,
+		Text:     text,
+		SentAt:   time.Now().UnixMilli(),
+	}
+	r.chatHistory.Add(line)
+	for _, pid := range r.players {
+		_ = r.sender.Send(pid, protocol.MsgChatMessage, line)
+	}
+	for pid := range r.observers {
+		_ = r.sender.Send(pid, protocol.MsgChatMessage, line)
+	}
+	if r.metrics != nil {
+		r.metrics.ChatMessages.Inc()
+	}
+}
+
+func (r *Room) rejectChat(playerID string, code int32, message, reason string) {
+	if r.metrics != nil {
+		r.metrics.ChatRejected.WithLabelValues(reason).Inc()
+	}
+	_ = r.sender.Send(playerID, protocol.MsgErrorResp, &protocol.ErrorResp{Code: code, Message: message})
+}
+
+func (r *Room) sendChatHistory(playerID string) {
+	lines := r.chatHistory.Lines()
+	if len(lines) == 0 {
+		return
+	}
+	_ = r.sender.Send(playerID, protocol.MsgChatHistory, &protocol.ChatHistory{RoomId: r.id, Messages: lines})
+}
+
+// rejectOutsidePlay drops gameplay events from observers and from players
+// outside the Playing phase. A player hears about it once per phase; input
+// still in flight when the match ended is dropped quietly.
+func (r *Room) rejectOutsidePlay(playerID string) bool {
+	if !r.isPlayer(playerID) || r.phase == protocol.RoomPhaseEnded {
+		return true
+	}
+	if r.phase == protocol.RoomPhasePlaying {
+		return false
+	}
+	if phase, ok := r.notPlayingSent[playerID]; ok && phase == r.phase {
+		return true
+	}
+	if r.notPlayingSent == nil {
+		r.notPlayingSent = make(map[string]protocol.RoomPhase)
+	}
+	r.notPlayingSent[playerID] = r.phase
+	_ = r.sender.Send(playerID, protocol.MsgErrorResp, &protocol.ErrorResp{Code: 409, Message: "room not playing"})
+	return true
+}
+
+func (r *Room) isPlayer(playerID string) bool {
+	for _, pid := range r.players {
+		if pid == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Room) allReady() bool {
+	for _, pid := range r.players {
+		if !r.ready[pid] {
+			return false
+		}
+	}
+	return true
+}
+
+// dropUnready removes every player who did not ready up in time.
+func (r *Room) dropUnready() {
+	kept := r.players[:0:0]
+	for _, pid := range r.players {
+		if r.ready[pid] {
+			kept = append(kept, pid)
+			continue
+		}
+		r.state.RemovePlayer(pid)
+		delete(r.disconnected, pid)
+		_ = r.sender.Send(pid, protocol.MsgErrorResp, &protocol.ErrorResp{Code: 408, Message: "ready check timed out"})
+		r.playerRemoved(pid)
+	}
+	r.players = kept
+}
+
+func (r *Room) snapshot(now time.Time) *protocol.RoomSnapshot {
 	snap := r.state.Snapshot(r.id)
+	snap.Phase = r.phase
+	switch r.phase {
+	case protocol.RoomPhaseWaiting, protocol.RoomPhaseCountdown:
+		if left := r.phaseEnd.Sub(now); left > 0 {
+			snap.CountdownMs = int32(left.Milliseconds())
+		}
+	case protocol.RoomPhasePlaying:
+		// Time left until the time limit, or until sudden death ends.
+		if end := r.state.EndTick(); end > 0 {
+			next := r.state.Rules.TimeLimitTicks
+			if r.state.SuddenDeath() {
+				next = end
+			}
+			if left := next - r.state.Tick; left > 0 {
+				snap.CountdownMs = int32((time.Duration(left) * r.settings.Tick).Milliseconds())
+			}
+		}
+		snap.SuddenDeath = r.state.SuddenDeath()
+	}
+	for _, p := range snap.Players {
+		p.Ready = r.ready[p.PlayerId]
+		_, p.Disconnected = r.disconnected[p.PlayerId]
+		_, p.Ai = r.controllers[p.PlayerId]
+	}
+	return snap
+}
+
+func (r *Room) broadcastSnapshot(now time.Time) {
+	snap := r.snapshot(now)
 	for _, pid := range r.players {
 		_ = r.sender.Send(pid, protocol.MsgRoomSnapshot, snap)
 	}
+	r.feedObservers(protocol.MsgRoomSnapshot, snap)
+}
+
+// feedItem is a message held back from observers.
+type feedItem struct {
+	msgType protocol.MsgType
+	msg     proto.Message
+}
+
+// feedObservers queues msg for observers and sends them the one from
+// SpectatorDelay ago.
+func (r *Room) feedObservers(msgType protocol.MsgType, msg proto.Message) {
+	delay := 0
+	if r.settings.Tick > 0 {
+		delay = int(r.settings.SpectatorDelay / r.settings.Tick)
+	}
+	r.feed = append(r.feed, feedItem{msgType: msgType, msg: msg})
+	if len(r.feed) <= delay {
+		return
+	}
+	r.popFeed()
+}
+
+// popFeed sends observers the oldest message of the feed.
+func (r *Room) popFeed() {
+	item := r.feed[0]
+	r.feed = append(r.feed[:0], r.feed[1:]...)
+	for pid := range r.observers {
+		_ = r.sender.Send(pid, item.msgType, item.msg)
+	}
 }
 
-func (r *Room) broadcastRoomOver(winner string) {
+func (r *Room) sendSnapshot(playerID string, now time.Time) {
+	_ = r.sender.Send(playerID, protocol.MsgRoomSnapshot, r.snapshot(now))
+}
+
+// saveReplay stores the recording in the background so a slow store does not
+// hold up the room.
+func (r *Room) saveReplay(res battle.Result) {
+	if r.rec == nil {
+		return
+	}
+	rp := r.rec.Finish(r.state, res)
+	r.rec = nil
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.settings.Replays.Save(ctx, rp); err != nil {
+			r.log.Warn("save replay failed", zap.Error(err), zap.String("match", r.matchID))
+		}
+	}()
+}
+
+// broadcastRoomOver settles the match once. stats is nil when the match never
+// started.
+func (r *Room) broadcastRoomOver(res battle.Result, stats []battle.PlayerStats) {
+	r.dropCheckpoint()
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
@@ -136,16 +745,90 @@ func (r *Room) broadcastRoomOver(winner string) {
 	}
 
 	over := &protocol.RoomOver{
-		RoomId:   r.id,
-		WinnerId: winner,
+		RoomId:      r.id,
+		WinnerId:    res.Winner,
+		WinningTeam: res.Team,
+		Outcome:     protocol.RoomOutcome(res.Outcome),
+		Reason:      res.Reason,
+	}
+	if !r.rematchEnd.IsZero() {
+		over.RematchMs = int32(r.settings.RematchWindow.Milliseconds())
+	}
+	for _, st := range stats {
+		over.Players = append(over.Players, &protocol.PlayerMatchStats{
+			PlayerId:     st.PlayerID,
+			Placement:    int32(st.Placement),
+			DamageDealt:  st.DamageDealt,
+			DamageTaken:  st.DamageTaken,
+			SkillsCast:   st.SkillsCast,
+			SkillsLanded: st.SkillsLanded,
+			Distance:     st.Distance,
+			TimeAliveMs:  (time.Duration(st.TicksAlive) * r.settings.Tick).Milliseconds(),
+			Forfeited:    st.Forfeited,
+		})
 	}
 	for _, pid := range r.players {
-		_ = r.sender.Send(pid, protocol.MsgRoomOver, over)
+		_ = r.sender.SendReliable(pid, protocol.MsgRoomOver, over)
+	}
+	// Observers get it after the snapshots they are behind on.
+	r.feedObservers(protocol.MsgRoomOver, over)
+	if stats != nil {
+		r.recordResult(res, stats)
+	}
+}
+
+// recordResult feeds a settled match to metrics and persistence.
+func (r *Room) recordResult(res battle.Result, stats []battle.PlayerStats) {
+	if r.metrics != nil {
+		r.metrics.MatchResults.WithLabelValues(res.Outcome.String()).Inc()
+		for _, st := range stats {
+			r.metrics.PlayerDamage.Observe(float64(st.DamageDealt))
+			r.metrics.SkillsCast.Add(float64(st.SkillsCast))
+			r.metrics.SkillsLanded.Add(float64(st.SkillsLanded))
+			r.metrics.PlayerTimeAlive.Observe((time.Duration(st.TicksAlive) * r.settings.Tick).Seconds())
+		}
+	}
+	if r.settings.Matches == nil {
+		return
+	}
+	rec := store.MatchRecord{
+		MatchID: r.matchID,
+		RoomID:  r.id,
+		Outcome: res.Outcome.String(),
+		Winner:  res.Winner,
+		Reason:  res.Reason,
+		Ticks:   r.state.Tick,
+		EndedAt: time.Now(),
+		Players: stats,
 	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.settings.Matches.SaveMatch(ctx, rec); err != nil {
+			r.log.Warn("save match failed", zap.Error(err), zap.String("match", r.matchID))
+		}
+	}()
 }
 
 func (r *Room) closeRoom() {
-	if r.onClose != nil {
-		r.onClose(r.id, r.players)
+	// A room closed early, by a rematch deadline or a panic, flushes what
+	// observers have not seen yet.
+	r.guard("close", func() {
+		for len(r.feed) > 0 {
+			r.popFeed()
+		}
+	})
+	if r.hooks.OnClosed != nil {
+		observers := make([]string, 0, len(r.observers))
+		for pid := range r.observers {
+			observers = append(observers, pid)
+		}
+		r.guard("on_closed", func() { r.hooks.OnClosed(r.id, r.players, observers) })
+	}
+}
+
+func (r *Room) playerRemoved(playerID string) {
+	if r.hooks.OnPlayerRemoved != nil {
+		r.guard("on_player_removed", func() { r.hooks.OnPlayerRemoved(r.id, playerID) })
 	}
 }
@@ -0,0 +1,468 @@
+package room
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/battle"
+	"miniarena/server/internal/chat"
+	"miniarena/server/internal/store"
+)
+
+type sentMsg struct {
+	playerID string
+	msgType  protocol.MsgType
+	msg      proto.Message
+}
+
+// recordSender records everything a room sends.
+type recordSender struct {
+	mu   sync.Mutex
+	sent []sentMsg
+}
+
+func (s *recordSender) Send(playerID string, msgType protocol.MsgType, msg proto.Message) error {
+	s.mu.Lock()
+	s.sent = append(s.sent, sentMsg{playerID, msgType, msg})
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *recordSender) SendReliable(playerID string, msgType protocol.MsgType, msg proto.Message) error {
+	return s.Send(playerID, msgType, msg)
+}
+
+// take returns the messages of msgType sent so far and forgets everything.
+func (s *recordSender) take(msgType protocol.MsgType) []sentMsg {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []sentMsg
+	for _, m := range s.sent {
+		if m.msgType == msgType {
+			out = append(out, m)
+		}
+	}
+	s.sent = nil
+	return out
+}
+
+func testSettings() Settings {
+	return Settings{
+		Tick:         50 * time.Millisecond,
+		ReadyTimeout: time.Second,
+		Countdown:    time.Second,
+		Rules:        battle.DefaultRules(2),
+	}
+}
+
+// newTestRoom builds a room that the test drives by calling step and
+// handleEvent itself.
+func newTestRoom(t *testing.T, spec Spec, settings Settings) (*Room, *recordSender) {
+	t.Helper()
+	if spec.Rules.MaxHP == 0 {
+		spec.Rules = settings.Rules
+	}
+	sender := &recordSender{}
+	r := NewRoom("room-1", spec, settings, sender, store.NewMemoryIdem(), nil, zap.NewNop(), Hooks{})
+	return r, sender
+}
+
+func TestRejectOutsidePlayOncePerPhase(t *testing.T) {
+	cases := []struct {
+		name   string
+		phases []protocol.RoomPhase
+		inputs int
+		errors int
+	}{
+		{name: "waiting", phases: []protocol.RoomPhase{protocol.RoomPhaseWaiting}, inputs: 5, errors: 1},
+		{name: "countdown", phases: []protocol.RoomPhase{protocol.RoomPhaseCountdown}, inputs: 5, errors: 1},
+		{
+			name:   "waiting then countdown",
+			phases: []protocol.RoomPhase{protocol.RoomPhaseWaiting, protocol.RoomPhaseCountdown},
+			inputs: 3,
+			errors: 2,
+		},
+		{name: "playing", phases: []protocol.RoomPhase{protocol.RoomPhasePlaying}, inputs: 5},
+		{name: "ended", phases: []protocol.RoomPhase{protocol.RoomPhaseEnded}, inputs: 5},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, sender := newTestRoom(t, Spec{Players: []string{"a", "b"}}, testSettings())
+			for _, phase := range tc.phases {
+				r.phase = phase
+				for i := 0; i < tc.inputs; i++ {
+					r.handleEvent(Event{Type: EventInput, PlayerID: "a", Input: &protocol.PlayerInput{Dx: 1}})
+				}
+			}
+			if got := len(sender.take(protocol.MsgErrorResp)); got != tc.errors {
+				t.Fatalf("errors sent = %d, want %d", got, tc.errors)
+			}
+		})
+	}
+}
+
+// types returns the types of the messages sent to playerID so far, in order.
+func (s *recordSender) types(playerID string) []protocol.MsgType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []protocol.MsgType
+	for _, m := range s.sent {
+		if m.playerID == playerID {
+			out = append(out, m.msgType)
+		}
+	}
+	return out
+}
+
+func TestObserversGetRoomOverAfterDelayedSnapshots(t *testing.T) {
+	const snapshots = 5
+	for _, delay := range []int{0, 1, 3} {
+		t.Run(fmt.Sprintf("delay %d", delay), func(t *testing.T) {
+			settings := testSettings()
+			settings.MaxSpectators = 1
+			settings.SpectatorDelay = time.Duration(delay) * settings.Tick
+			r, sender := newTestRoom(t, Spec{Players: []string{"a", "b"}}, settings)
+			r.observers["o"] = struct{}{}
+			r.phase = protocol.RoomPhasePlaying
+
+			now := time.Now()
+			for i := 0; i < snapshots; i++ {
+				r.broadcastSnapshot(now)
+			}
+			r.phase = protocol.RoomPhaseEnded
+			r.broadcastRoomOver(battle.Result{Outcome: battle.OutcomeAbandoned}, nil)
+
+			// The room stays open until RoomOver has gone out.
+			steps := 1
+			for ; !r.step(now); steps++ {
+				if steps > snapshots {
+					t.Fatal("room never finished")
+				}
+			}
+			if want := max(delay, 1); steps != want {
+				t.Fatalf("room finished after %d steps, want %d", steps, want)
+			}
+
+			want := make([]protocol.MsgType, 0, snapshots+1)
+			for i := 0; i < snapshots; i++ {
+				want = append(want, protocol.MsgRoomSnapshot)
+			}
+			want = append(want, protocol.MsgRoomOver)
+			if got := sender.types("o"); !reflect.DeepEqual(got, want) {
+				t.Fatalf("observer got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRematchVote(t *testing.T) {
+	cases := []struct {
+		name   string
+		spec   Spec
+		left   string // forfeits before the match ends
+		votes  map[string]bool
+		open   bool
+		status protocol.RematchStatus
+	}{
+		{
+			name:   "everyone accepts",
+			spec:   Spec{Players: []string{"a", "b"}},
+			votes:  map[string]bool{"a": true, "b": true},
+			open:   true,
+			status: protocol.RematchStatusAccepted,
+		},
+		{
+			name:   "bots always accept",
+			spec:   Spec{Players: []string{"a"}, Bots: []string{"bot"}},
+			votes:  map[string]bool{"a": true},
+			open:   true,
+			status: protocol.RematchStatusAccepted,
+		},
+		{
+			name:   "one declines",
+			spec:   Spec{Players: []string{"a", "b"}},
+			votes:  map[string]bool{"a": true, "b": false},
+			open:   true,
+			status: protocol.RematchStatusDeclined,
+		},
+		{
+			name:   "still voting",
+			spec:   Spec{Players: []string{"a", "b"}},
+			votes:  map[string]bool{"a": true},
+			open:   true,
+			status: protocol.RematchStatusVoting,
+		},
+		{
+			name: "forfeited player counts as declining",
+			spec: Spec{Players: []string{"a", "b", "c"}},
+			left: "c",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := testSettings()
+			settings.Rules = battle.DefaultRules(len(tc.spec.Players) + len(tc.spec.Bots))
+			settings.RematchWindow = time.Second
+			sender := &recordSender{}
+			var rematch *Spec
+			hooks := Hooks{OnRematch: func(spec Spec) { rematch = &spec }}
+			r := NewRoom("room-1", tc.spec, settings, sender, store.NewMemoryIdem(), nil, zap.NewNop(), hooks)
+			r.phase = protocol.RoomPhasePlaying
+			if tc.left != "" {
+				r.forfeit(tc.left)
+			}
+			// Everyone but the first seat falls, which ends the match.
+			for _, pid := range r.players[1:] {
+				r.state.Players[pid].HP = 0
+			}
+			now := time.Now()
+			if closed := r.step(now); closed == tc.open {
+				t.Fatalf("step closed the room = %v, want vote open = %v", closed, tc.open)
+			}
+			if !tc.open {
+				return
+			}
+
+			sender.take(protocol.MsgRematchState)
+			for _, pid := range tc.spec.Players {
+				if accept, ok := tc.votes[pid]; ok {
+					r.handleEvent(Event{Type: EventRematchVote, PlayerID: pid, Accept: accept})
+				}
+			}
+			states := sender.take(protocol.MsgRematchState)
+			if len(states) == 0 {
+				t.Fatal("no RematchState sent")
+			}
+			if got := states[len(states)-1].msg.(*protocol.RematchState).Status; got != tc.status {
+				t.Fatalf("status = %v, want %v", got, tc.status)
+			}
+			if accepted := tc.status == protocol.RematchStatusAccepted; accepted != (rematch != nil) {
+				t.Fatalf("rematch requested = %v, want %v", rematch != nil, accepted)
+			}
+			if rematch != nil && (!reflect.DeepEqual(rematch.Players, tc.spec.Players) || !reflect.DeepEqual(rematch.Bots, tc.spec.Bots)) {
+				t.Fatalf("rematch seats %v %v, want %v %v", rematch.Players, rematch.Bots, tc.spec.Players, tc.spec.Bots)
+			}
+		})
+	}
+}
+
+func TestReadyCheckNeedsTwoSides(t *testing.T) {
+	teams := battle.DefaultRules(4)
+	teams.TeamSize = 2
+	cases := []struct {
+		name    string
+		rules   battle.Rules
+		ready   []string
+		started bool
+	}{
+		{name: "free-for-all with two ready", rules: battle.DefaultRules(4), ready: []string{"a", "c"}, started: true},
+		{name: "free-for-all with one ready", rules: battle.DefaultRules(4), ready: []string{"a"}},
+		{name: "one of each team ready", rules: teams, ready: []string{"a", "c"}, started: true},
+		{name: "only one team ready", rules: teams, ready: []string{"a", "b"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, sender := newTestRoom(t, Spec{Players: []string{"a", "b", "c", "d"}, Rules: tc.rules}, testSettings())
+			for _, pid := range tc.ready {
+				r.handleEvent(Event{Type: EventReady, PlayerID: pid})
+			}
+			closed := r.step(r.phaseEnd)
+			if started := r.phase == protocol.RoomPhaseCountdown; started != tc.started || closed == tc.started {
+				t.Fatalf("phase %v, closed %v; want started %v", r.phase, closed, tc.started)
+			}
+			over := sender.take(protocol.MsgRoomOver)
+			if abandoned := len(over) > 0; abandoned == tc.started {
+				t.Fatalf("RoomOver sent = %v, want %v", abandoned, !tc.started)
+			}
+		})
+	}
+}
+
+func chatSettings() Settings {
+	settings := testSettings()
+	settings.MaxSpectators = 2
+	settings.Chat = chat.Settings{
+		MaxLength:  10,
+		RateLimit:  2,
+		RateWindow: time.Minute,
+		History:    3,
+		Filter:     chat.NewFilter([]string{"darn"}),
+	}
+	return settings
+}
+
+// chatTexts returns the chat lines each recipient got, by player ID.
+func chatTexts(msgs []sentMsg) map[string][]string {
+	out := make(map[string][]string)
+	for _, m := range msgs {
+		out[m.playerID] = append(out[m.playerID], m.msg.(*protocol.ChatMessage).Text)
+	}
+	return out
+}
+
+func TestChat(t *testing.T) {
+	cases := []struct {
+		name  string
+		from  string
+		lines []string
+		// relayed is what each player and the spectator o sees.
+		relayed []string
+		errors  []int32
+	}{
+		{name: "relayed to players and spectators", from: "a", lines: []string{" hi "}, relayed: []string{"hi"}},
+		{name: "masked", from: "a", lines: []string{"oh darn"}, relayed: []string{"oh ****"}},
+		{name: "blank", from: "a", lines: []string{"   "}},
+		{name: "too long", from: "a", lines: []string{"hello there"}, errors: []int32{413}},
+		{name: "longest allowed", from: "a", lines: []string{"héllo ther"}, relayed: []string{"héllo ther"}},
+		{name: "rate limited", from: "a", lines: []string{"1", "2", "3"}, relayed: []string{"1", "2"}, errors: []int32{429}},
+		{name: "spectators are read-only", from: "o", lines: []string{"hi"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, sender := newTestRoom(t, Spec{Players: []string{"a", "b"}}, chatSettings())
+			r.handleEvent(Event{Type: EventSpectate, PlayerID: "o"})
+			sender.take(protocol.MsgSpectateResp)
+
+			for _, line := range tc.lines {
+				r.handleEvent(Event{Type: EventChat, PlayerID: tc.from, Chat: &protocol.ChatMessage{Text: line}})
+			}
+
+			var codes []int32
+			for _, m := range sender.sent {
+				if m.msgType == protocol.MsgErrorResp && m.playerID == tc.from {
+					codes = append(codes, m.msg.(*protocol.ErrorResp).Code)
+				}
+			}
+			got := chatTexts(sender.take(protocol.MsgChatMessage))
+			for _, pid := range []string{"a", "b", "o"} {
+				if !reflect.DeepEqual(got[pid], tc.relayed) {
+					t.Fatalf("%s got %q, want %q", pid, got[pid], tc.relayed)
+				}
+			}
+			if !reflect.DeepEqual(codes, tc.errors) {
+				t.Fatalf("errors %v, want %v", codes, tc.errors)
+			}
+		})
+	}
+}
+
+func TestChatHistory(t *testing.T) {
+	cases := []struct {
+		name string
+		// join brings p into the room after the lines were said.
+		join func(r *Room, p string)
+		p    string
+		want []string
+	}{
+		{
+			name: "rejoin",
+			p:    "b",
+			join: func(r *Room, p string) {
+				r.handleEvent(Event{Type: EventDisconnect, PlayerID: p})
+				r.handleEvent(Event{Type: EventJoin, PlayerID: p})
+			},
+			want: []string{"2", "3", "4"},
+		},
+		{
+			name: "spectate",
+			p:    "o",
+			join: func(r *Room, p string) { r.handleEvent(Event{Type: EventSpectate, PlayerID: p}) },
+			want: []string{"2", "3", "4"},
+		},
+		{
+			name: "outsider",
+			p:    "x",
+			join: func(r *Room, p string) { r.handleEvent(Event{Type: EventJoin, PlayerID: p}) },
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := chatSettings()
+			settings.Chat.RateLimit = 0
+			r, sender := newTestRoom(t, Spec{Players: []string{"a", "b"}}, settings)
+			for _, line := range []string{"1", "2", "3", "4"} {
+				r.handleEvent(Event{Type: EventChat, PlayerID: "a", Chat: &protocol.ChatMessage{Text: line}})
+			}
+			sender.take(protocol.MsgChatHistory)
+
+			tc.join(r, tc.p)
+
+			var got []string
+			for _, m := range sender.take(protocol.MsgChatHistory) {
+				if m.playerID != tc.p {
+					t.Fatalf("history sent to %s, want only %s", m.playerID, tc.p)
+				}
+				for _, line := range m.msg.(*protocol.ChatHistory).Messages {
+					got = append(got, line.Text)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("%s got history %q, want %q", tc.p, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDisconnectGrace(t *testing.T) {
+	cases := []struct {
+		name     string
+		grace    time.Duration
+		takeOver bool
+		rejoin   bool
+		// at is when, after the disconnect, the room steps.
+		at        time.Duration
+		forfeited bool
+		// notices is what b hears of a's connection.
+		notices    []bool
+		controlled bool
+	}{
+		{name: "back within the grace", grace: 10 * time.Second, rejoin: true, at: 20 * time.Second, notices: []bool{false, true}},
+		{name: "still within the grace", grace: 10 * time.Second, at: 9 * time.Second, notices: []bool{false}},
+		{name: "away past the grace", grace: 10 * time.Second, at: 11 * time.Second, forfeited: true, notices: []bool{false}},
+		{name: "no grace", forfeited: true},
+		{name: "AI takes over", grace: 10 * time.Second, takeOver: true, at: 5 * time.Second, notices: []bool{false}, controlled: true},
+		{name: "AI hands back", grace: 10 * time.Second, takeOver: true, rejoin: true, at: 5 * time.Second, notices: []bool{false, true}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := testSettings()
+			settings.DisconnectGrace = tc.grace
+			settings.AI.TakeOver = tc.takeOver
+			r, sender := newTestRoom(t, Spec{Players: []string{"a", "b", "c"}}, settings)
+			r.phase = protocol.RoomPhasePlaying
+
+			start := time.Now()
+			r.handleEvent(Event{Type: EventDisconnect, PlayerID: "a"})
+			if tc.rejoin {
+				r.handleEvent(Event{Type: EventJoin, PlayerID: "a"})
+			}
+			r.step(start.Add(tc.at))
+
+			if got := r.state.Players["a"].Forfeited; got != tc.forfeited {
+				t.Fatalf("forfeited = %v, want %v", got, tc.forfeited)
+			}
+			if _, got := r.controllers["a"]; got != tc.controlled {
+				t.Fatalf("AI in control = %v, want %v", got, tc.controlled)
+			}
+			if _, away := r.disconnected["a"]; away != (!tc.rejoin && !tc.forfeited) {
+				t.Fatalf("still counted away = %v", away)
+			}
+			var notices []bool
+			for _, m := range sender.take(protocol.MsgPlayerConnectionChanged) {
+				if m.playerID == "b" {
+					notices = append(notices, m.msg.(*protocol.PlayerConnectionChanged).Connected)
+				}
+			}
+			if !reflect.DeepEqual(notices, tc.notices) {
+				t.Fatalf("b heard connected = %v, want %v", notices, tc.notices)
+			}
+		})
+	}
+}
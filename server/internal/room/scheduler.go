@@ -0,0 +1,116 @@
+package room
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// scheduler drives rooms from a fixed pool of shards instead of one goroutine
+// and ticker per room. Each shard owns its rooms outright, so a room's events
+// and ticks are still handled by a single goroutine.
+type scheduler struct {
+	shards []*shard
+	once   sync.Once
+}
+
+func newScheduler(n int, tick time.Duration) *scheduler {
+	s := &scheduler{shards: make([]*shard, n)}
+	for i := range s.shards {
+		s.shards[i] = &shard{
+			tick:  tick,
+			add:   make(chan *Room, 64),
+			wake:  make(chan *Room, 1024),
+			stop:  make(chan struct{}),
+			owned: make(map[*Room]struct{}),
+		}
+		go s.shards[i].loop()
+	}
+	return s
+}
+
+// bind picks the room's shard by its ID and points the room's wake channel
+// at it. It must run before the room is reachable by SendEvent.
+func (s *scheduler) bind(r *Room) *shard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(r.id))
+	sh := s.shards[h.Sum32()%uint32(len(s.shards))]
+	r.wake = sh.wake
+	return sh
+}
+
+// adopt hands a bound room to the shard.
+func (sh *shard) adopt(r *Room) {
+	select {
+	case sh.add <- r:
+	default:
+		// Rematches are created from inside a shard, which must not block
+		// on its own channel. Once the shard has stopped nobody reads add,
+		// so give up and close the room.
+		go func() {
+			select {
+			case sh.add <- r:
+			case <-sh.stop:
+				r.closeRoom()
+			}
+		}()
+	}
+}
+
+func (s *scheduler) stop() {
+	s.once.Do(func() {
+		for _, sh := range s.shards {
+			close(sh.stop)
+		}
+	})
+}
+
+type shard struct {
+	tick time.Duration
+	add  chan *Room
+	// wake carries rooms with queued events so they are handled before the
+	// next tick. A full channel only delays them until then.
+	wake chan *Room
+	stop chan struct{}
+	// rooms keeps a stable order so each room ticks at about the same
+	// offset every time.
+	rooms []*Room
+	owned map[*Room]struct{}
+}
+
+func (sh *shard) loop() {
+	ticker := time.NewTicker(sh.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case r := <-sh.add:
+			sh.rooms = append(sh.rooms, r)
+			sh.owned[r] = struct{}{}
+		case r := <-sh.wake:
+			if _, ok := sh.owned[r]; ok {
+				r.drain()
+			}
+		case now := <-ticker.C:
+			live := sh.rooms[:0]
+			for _, r := range sh.rooms {
+				r.drain()
+				if r.stopped() || r.safeStep(now) {
+					delete(sh.owned, r)
+					r.closeRoom()
+					continue
+				}
+				live = append(live, r)
+			}
+			for i := len(live); i < len(sh.rooms); i++ {
+				sh.rooms[i] = nil
+			}
+			sh.rooms = live
+		case <-sh.stop:
+			for _, r := range sh.rooms {
+				r.closeRoom()
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package room
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"miniarena/server/internal/store"
+)
+
+func TestShardAdopt(t *testing.T) {
+	cases := []struct {
+		name    string
+		stopped bool
+	}{
+		{name: "shard takes the room late"},
+		{name: "stopped shard closes the room", stopped: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// An unbuffered add with nobody reading it makes adopt fall
+			// back to its goroutine, as it does from inside a busy shard.
+			sh := &shard{add: make(chan *Room), wake: make(chan *Room, 1), stop: make(chan struct{})}
+			s := &scheduler{shards: []*shard{sh}}
+			closed := make(chan string, 1)
+			hooks := Hooks{OnClosed: func(roomID string, _, _ []string) { closed <- roomID }}
+			r := NewRoom("room-1", Spec{Players: []string{"a", "b"}}, testSettings(), &recordSender{}, store.NewMemoryIdem(), nil, zap.NewNop(), hooks)
+
+			if s.bind(r) != sh || r.wake == nil {
+				t.Fatal("bind did not point the room at its shard")
+			}
+			sh.adopt(r)
+
+			if tc.stopped {
+				close(sh.stop)
+				select {
+				case <-closed:
+				case <-time.After(time.Second):
+					t.Fatal("room was never closed")
+				}
+				return
+			}
+			select {
+			case got := <-sh.add:
+				if got != r {
+					t.Fatal("shard got another room")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("room never reached the shard")
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+type EventType int
+
+const (
+	EventLoggedIn EventType = iota
+	EventReconnected
+	EventDisconnected
+	EventExpired
+	EventRoomChanged
+	EventQueueChanged
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventLoggedIn:
+		return "logged_in"
+	case EventReconnected:
+		return "reconnected"
+	case EventDisconnected:
+		return "disconnected"
+	case EventExpired:
+		return "expired"
+	case EventRoomChanged:
+		return "room_changed"
+	case EventQueueChanged:
+		return "queue_changed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a session lifecycle change. RoomID is the room the player
+// is in after the change; PrevRoomID is only set for EventRoomChanged.
+type Event struct {
+	Type       EventType
+	PlayerID   string
+	Username   string
+	RoomID     string
+	PrevRoomID string
+	At         time.Time
+}
+
+// Handler receives session events. Handlers run synchronously on the
+// goroutine that caused the change, outside any session lock, so they must
+// not block.
+type Handler func(Event)
+
+type eventBus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func (b *eventBus) subscribe(h Handler) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, h)
+	b.mu.Unlock()
+}
+
+func (b *eventBus) publish(ev Event) {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		h(ev)
+	}
+}
@@ -0,0 +1,153 @@
+package session
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// published is the part of an Event the tests compare.
+type published struct {
+	Type     EventType
+	RoomID   string
+	PrevRoom string
+}
+
+func TestEvents(t *testing.T) {
+	conn := &recordSender{}
+	cases := []struct {
+		name  string
+		setup func(m *Manager)
+		do    func(m *Manager)
+		want  []published
+	}{
+		{
+			name: "login",
+			do:   func(m *Manager) { m.Create("p1", "alice", "tok", conn) },
+			want: []published{{Type: EventLoggedIn}},
+		},
+		{
+			name: "reconnect",
+			setup: func(m *Manager) {
+				m.Create("p1", "alice", "tok", conn)
+				m.SetRoom("p1", "r1")
+				m.MarkOffline("p1", conn)
+			},
+			do:   func(m *Manager) { m.Bind("p1", &recordSender{}, 0) },
+			want: []published{{Type: EventReconnected, RoomID: "r1"}},
+		},
+		{
+			name:  "disconnect",
+			setup: func(m *Manager) { m.Create("p1", "alice", "tok", conn) },
+			do: func(m *Manager) {
+				m.MarkOffline("p1", conn)
+				m.MarkOffline("p1", conn)
+			},
+			want: []published{{Type: EventDisconnected}},
+		},
+		{
+			name:  "close of a replaced connection",
+			setup: func(m *Manager) { m.Create("p1", "alice", "tok", conn) },
+			do:    func(m *Manager) { m.MarkOffline("p1", &recordSender{}) },
+		},
+		{
+			name: "expire",
+			setup: func(m *Manager) {
+				m.Create("p1", "alice", "tok", conn)
+				m.MarkOffline("p1", conn)
+			},
+			do: func(m *Manager) {
+				m.expireDue(time.Now().Add(2 * time.Minute))
+				m.expireDue(time.Now().Add(2 * time.Minute))
+			},
+			want: []published{{Type: EventExpired}},
+		},
+		{
+			name: "expire after a reconnect",
+			setup: func(m *Manager) {
+				m.Create("p1", "alice", "tok", conn)
+				m.MarkOffline("p1", conn)
+				m.Bind("p1", conn, 0)
+			},
+			do: func(m *Manager) { m.expireDue(time.Now().Add(2 * time.Minute)) },
+		},
+		{
+			name:  "room set",
+			setup: func(m *Manager) { m.Create("p1", "alice", "tok", conn) },
+			do: func(m *Manager) {
+				m.SetRoom("p1", "r1")
+				m.SetRoom("p1", "r1")
+				m.SetRoom("p1", "r2")
+			},
+			want: []published{
+				{Type: EventRoomChanged, RoomID: "r1"},
+				{Type: EventRoomChanged, RoomID: "r2", PrevRoom: "r1"},
+			},
+		},
+		{
+			name: "room cleared",
+			setup: func(m *Manager) {
+				m.Create("p1", "alice", "tok", conn)
+				m.SetRoom("p1", "r1")
+			},
+			do: func(m *Manager) {
+				m.ClearRoom("p1", "r0")
+				m.ClearRoom("p1", "r1")
+				m.ClearRoom("p1", "r1")
+			},
+			want: []published{{Type: EventRoomChanged, PrevRoom: "r1"}},
+		},
+		{
+			name:  "queue",
+			setup: func(m *Manager) { m.Create("p1", "alice", "tok", conn) },
+			do: func(m *Manager) {
+				m.SetQueued("p1", true)
+				m.SetQueued("p1", true)
+				m.SetQueued("p1", false)
+			},
+			want: []published{{Type: EventQueueChanged}, {Type: EventQueueChanged}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newTestManager(t)
+			if tc.setup != nil {
+				tc.setup(m)
+			}
+
+			var (
+				mu    sync.Mutex
+				got   []published
+				order []string
+			)
+			m.Subscribe(func(ev Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				if ev.PlayerID != "p1" || ev.Username != "alice" {
+					t.Errorf("event %v for %s/%s, want p1/alice", ev.Type, ev.PlayerID, ev.Username)
+				}
+				got = append(got, published{Type: ev.Type, RoomID: ev.RoomID, PrevRoom: ev.PrevRoomID})
+				order = append(order, "first")
+			})
+			m.Subscribe(func(Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, "second")
+			})
+
+			tc.do(m)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("published %+v, want %+v", got, tc.want)
+			}
+			for i := 0; i < len(order); i += 2 {
+				if order[i] != "first" || i+1 >= len(order) || order[i+1] != "second" {
+					t.Fatalf("handlers ran in order %v", order)
+				}
+			}
+		})
+	}
+}
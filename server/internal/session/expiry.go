@@ -0,0 +1,73 @@
+package session
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// expiryEntry schedules the removal of a session that went offline at
+// lastSeen. It is stale once the session reconnects.
+type expiryEntry struct {
+	at       time.Time
+	playerID string
+	lastSeen time.Time
+}
+
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].at.Before(h[j].at) }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiryEntry)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	*h = old[:n-1]
+	return e
+}
+
+// expiryQueue is a min-heap of session deadlines. wake is signalled when a
+// push moves the earliest deadline forward.
+type expiryQueue struct {
+	mu   sync.Mutex
+	h    expiryHeap
+	wake chan struct{}
+}
+
+func newExpiryQueue() *expiryQueue {
+	return &expiryQueue{wake: make(chan struct{}, 1)}
+}
+
+func (q *expiryQueue) push(e expiryEntry) {
+	q.mu.Lock()
+	heap.Push(&q.h, e)
+	first := q.h[0].playerID == e.playerID && q.h[0].at.Equal(e.at)
+	q.mu.Unlock()
+	if first {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (q *expiryQueue) peek() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.h) == 0 {
+		return time.Time{}, false
+	}
+	return q.h[0].at, true
+}
+
+func (q *expiryQueue) popDue(now time.Time) []expiryEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var due []expiryEntry
+	for len(q.h) > 0 && !q.h[0].at.After(now) {
+		due = append(due, heap.Pop(&q.h).(expiryEntry))
+	}
+	return due
+}
@@ -0,0 +1,428 @@
+package session
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/metrics"
+)
+
+// shardCount must be a power of two.
+const shardCount = 64
+
+// retransmitAfter is how long a reliable message may go unacked before it is
+// sent again.
+const retransmitAfter = 2 * time.Second
+
+type shard struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// Manager owns all sessions. Sessions are spread over lock shards so logins on
+// different players never contend, the online count is maintained on state
+// transitions instead of recounted, and offline sessions are expired and
+// unacked reliable messages resent from deadline heaps instead of periodic
+// full scans.
+type Manager struct {
+	shards         [shardCount]shard
+	online         int64
+	total          int64
+	expiry         *expiryQueue
+	retransmits    *retransmitQueue
+	events         eventBus
+	reconnectTTL   time.Duration
+	reliableBuffer int
+	metrics        *metrics.Metrics
+	log            *zap.Logger
+	stop           chan struct{}
+	stopOnce       sync.Once
+}
+
+func NewManager(reconnectTTL time.Duration, reliableBuffer int, metrics *metrics.Metrics, log *zap.Logger) *Manager {
+	m := &Manager{
+		expiry:         newExpiryQueue(),
+		retransmits:    newRetransmitQueue(),
+		reconnectTTL:   reconnectTTL,
+		reliableBuffer: reliableBuffer,
+		metrics:        metrics,
+		log:            log,
+		stop:           make(chan struct{}),
+	}
+	for i := range m.shards {
+		m.shards[i].sessions = make(map[string]*Session)
+	}
+	go m.runDue(m.expiry.peek, m.expiry.wake, m.expireDue)
+	go m.runDue(m.retransmits.peek, m.retransmits.wake, m.retransmitDue)
+	return m
+}
+
+// Stop ends the expiry and retransmit loops. Sessions stay readable but are
+// no longer expired and unacked messages wait for a reconnect.
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+func (m *Manager) shard(playerID string) *shard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(playerID))
+	return &m.shards[h.Sum32()&(shardCount-1)]
+}
+
+// Subscribe registers h for every session event. Subscribe before traffic
+// starts; handlers cannot be removed.
+func (m *Manager) Subscribe(h Handler) {
+	m.events.subscribe(h)
+}
+
+func (m *Manager) Create(playerID, username, reconnectToken string, sender Sender) *Session {
+	s := &Session{
+		PlayerID:       playerID,
+		Username:       username,
+		ReconnectToken: reconnectToken,
+		Online:         true,
+		LastSeen:       time.Now(),
+		sender:         sender,
+		maxPending:     m.reliableBuffer,
+		metrics:        m.metrics,
+		retransmits:    m.retransmits,
+	}
+
+	sh := m.shard(playerID)
+	sh.mu.Lock()
+	old := sh.sessions[playerID]
+	sh.sessions[playerID] = s
+	sh.mu.Unlock()
+
+	if old != nil {
+		if old.markRemoved() {
+			m.addOnline(-1)
+		}
+	} else {
+		atomic.AddInt64(&m.total, 1)
+	}
+	m.addOnline(1)
+	m.events.publish(Event{Type: EventLoggedIn, PlayerID: playerID, Username: username, At: s.LastSeen})
+	return s
+}
+
+// Restore recreates an offline session for a player whose match was
+// recovered after a restart, so their reconnect token works again. It
+// expires after the reconnect TTL like any other offline session.
+func (m *Manager) Restore(playerID, username, roomID string) {
+	now := time.Now()
+	s := &Session{
+		PlayerID:    playerID,
+		Username:    username,
+		RoomID:      roomID,
+		LastSeen:    now,
+		maxPending:  m.reliableBuffer,
+		metrics:     m.metrics,
+		retransmits: m.retransmits,
+	}
+
+	sh := m.shard(playerID)
+	sh.mu.Lock()
+	if _, ok := sh.sessions[playerID]; ok {
+		sh.mu.Unlock()
+		return
+	}
+	sh.sessions[playerID] = s
+	sh.mu.Unlock()
+
+	atomic.AddInt64(&m.total, 1)
+	m.expiry.push(expiryEntry{at: now.Add(m.reconnectTTL), playerID: playerID, lastSeen: now})
+}
+
+// Bind attaches a reconnected player's connection. Reliable messages after
+// lastAcked are resent on it before any new traffic.
+func (m *Manager) Bind(playerID string, sender Sender, lastAcked uint64) (*Session, bool) {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return nil, false
+	}
+	cameOnline, ok := s.setSender(sender, lastAcked)
+	if !ok {
+		return nil, false
+	}
+	if cameOnline {
+		m.addOnline(1)
+	}
+	s.mu.RLock()
+	ev := Event{Type: EventReconnected, PlayerID: playerID, Username: s.Username, RoomID: s.RoomID, At: s.LastSeen}
+	s.mu.RUnlock()
+	m.events.publish(ev)
+	return s, true
+}
+
+func (m *Manager) SetRoom(playerID, roomID string) {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	prev := s.RoomID
+	s.RoomID = roomID
+	username := s.Username
+	s.mu.Unlock()
+	if prev == roomID {
+		return
+	}
+	m.events.publish(Event{Type: EventRoomChanged, PlayerID: playerID, Username: username, RoomID: roomID, PrevRoomID: prev, At: time.Now()})
+}
+
+// ClearRoom clears the player's room only if it is still roomID, so a late
+// notification from an old room cannot detach the player from a new one.
+func (m *Manager) ClearRoom(playerID, roomID string) {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	if s.RoomID != roomID {
+		s.mu.Unlock()
+		return
+	}
+	s.RoomID = ""
+	username := s.Username
+	s.mu.Unlock()
+	m.events.publish(Event{Type: EventRoomChanged, PlayerID: playerID, Username: username, PrevRoomID: roomID, At: time.Now()})
+}
+
+// SetSpectating records the room the player watches and returns the
+// previous one.
+func (m *Manager) SetSpectating(playerID, roomID string) (prev string) {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return ""
+	}
+	s.mu.Lock()
+	prev = s.SpectateRoomID
+	s.SpectateRoomID = roomID
+	s.mu.Unlock()
+	return prev
+}
+
+// ClearSpectating clears the watched room only if it is still roomID.
+func (m *Manager) ClearSpectating(playerID, roomID string) {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	if s.SpectateRoomID == roomID {
+		s.SpectateRoomID = ""
+	}
+	s.mu.Unlock()
+}
+
+// SetQueued records whether the player is waiting in the match queue.
+func (m *Manager) SetQueued(playerID string, queued bool) {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	prev := s.InQueue
+	s.InQueue = queued
+	ev := Event{Type: EventQueueChanged, PlayerID: playerID, Username: s.Username, RoomID: s.RoomID, At: time.Now()}
+	s.mu.Unlock()
+	if prev == queued {
+		return
+	}
+	m.events.publish(ev)
+}
+
+// MarkOffline records that sender's connection closed. It does nothing if the
+// player has since reconnected on another connection.
+func (m *Manager) MarkOffline(playerID string, sender Sender) {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return
+	}
+	wentOffline, at := s.clearSender(sender)
+	if !wentOffline {
+		return
+	}
+	m.addOnline(-1)
+	m.expiry.push(expiryEntry{at: at.Add(m.reconnectTTL), playerID: playerID, lastSeen: at})
+	s.mu.RLock()
+	ev := Event{Type: EventDisconnected, PlayerID: playerID, Username: s.Username, RoomID: s.RoomID, At: at}
+	s.mu.RUnlock()
+	m.events.publish(ev)
+}
+
+func (m *Manager) Remove(playerID string) {
+	sh := m.shard(playerID)
+	sh.mu.Lock()
+	s := sh.sessions[playerID]
+	delete(sh.sessions, playerID)
+	sh.mu.Unlock()
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&m.total, -1)
+	if s.markRemoved() {
+		m.addOnline(-1)
+	}
+}
+
+func (m *Manager) Get(playerID string) (*Session, bool) {
+	sh := m.shard(playerID)
+	sh.mu.RLock()
+	s := sh.sessions[playerID]
+	sh.mu.RUnlock()
+	if s == nil {
+		return nil, false
+	}
+	return s, true
+}
+
+// Username returns the player's name, or "" without a session.
+func (m *Manager) Username(playerID string) string {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return ""
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Username
+}
+
+func (m *Manager) IsOnline(playerID string) bool {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return false
+	}
+	s.mu.RLock()
+	online := s.Online
+	s.mu.RUnlock()
+	return online
+}
+
+// OnlineCount returns the number of sessions with a live connection.
+func (m *Manager) OnlineCount() int {
+	return int(atomic.LoadInt64(&m.online))
+}
+
+// Len returns the number of sessions, online or waiting for reconnect.
+func (m *Manager) Len() int {
+	return int(atomic.LoadInt64(&m.total))
+}
+
+func (m *Manager) Send(playerID string, msgType protocol.MsgType, msg proto.Message) error {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return ErrNotFound
+	}
+	return s.Send(msgType, msg)
+}
+
+func (m *Manager) SendReliable(playerID string, msgType protocol.MsgType, msg proto.Message) error {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return ErrNotFound
+	}
+	return s.SendReliable(msgType, msg)
+}
+
+func (m *Manager) Ack(playerID string, seq uint64) {
+	s, ok := m.Get(playerID)
+	if !ok {
+		return
+	}
+	s.Ack(seq)
+}
+
+func (m *Manager) Broadcast(playerIDs []string, msgType protocol.MsgType, msg proto.Message) {
+	for _, pid := range playerIDs {
+		_ = m.Send(pid, msgType, msg)
+	}
+}
+
+func (m *Manager) addOnline(delta int64) {
+	atomic.AddInt64(&m.online, delta)
+	// Adding the delta rather than setting the count keeps the gauge right
+	// when concurrent updates publish out of order.
+	if m.metrics != nil {
+		m.metrics.OnlineGauge.Add(float64(delta))
+	}
+}
+
+// runDue calls due whenever the earliest deadline next reports passes, and
+// looks again when wake signals an earlier one, until the manager stops.
+func (m *Manager) runDue(next func() (time.Time, bool), wake <-chan struct{}, due func(now time.Time)) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		wait := time.Hour
+		if at, ok := next(); ok {
+			wait = time.Until(at)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-timer.C:
+		case <-wake:
+		case <-m.stop:
+			return
+		}
+		due(time.Now())
+	}
+}
+
+func (m *Manager) expireDue(now time.Time) {
+	for _, e := range m.expiry.popDue(now) {
+		m.expire(e)
+	}
+}
+
+// retransmitDue resends reliable messages that a connection refused or a
+// client never acked, so delivery does not wait for a reconnect. Only
+// sessions with unacked messages are queued.
+func (m *Manager) retransmitDue(now time.Time) {
+	for _, s := range m.retransmits.popDue(now) {
+		s.retransmit(now, retransmitAfter)
+	}
+}
+
+// expire removes the session if it is still in the offline period that e was
+// scheduled for. Entries left behind by a reconnect are ignored.
+func (m *Manager) expire(e expiryEntry) {
+	sh := m.shard(e.playerID)
+	sh.mu.Lock()
+	s := sh.sessions[e.playerID]
+	if s == nil {
+		sh.mu.Unlock()
+		return
+	}
+	s.mu.Lock()
+	stale := s.removed || s.Online || !s.LastSeen.Equal(e.lastSeen)
+	if !stale {
+		s.removed = true
+	}
+	ev := Event{Type: EventExpired, PlayerID: e.playerID, Username: s.Username, RoomID: s.RoomID, At: e.at}
+	s.mu.Unlock()
+	if stale {
+		sh.mu.Unlock()
+		return
+	}
+	delete(sh.sessions, e.playerID)
+	sh.mu.Unlock()
+
+	atomic.AddInt64(&m.total, -1)
+	m.events.publish(ev)
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"flag"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var benchSessions = flag.Int("bench.sessions", 100000, "sessions preloaded while benchmarking the manager")
+
+// nopSender stands in for a websocket client.
+type nopSender struct{}
+
+func (nopSender) Send(data []byte) error { return nil }
+func (nopSender) Close() error           { return nil }
+
+func benchManager(b *testing.B) *Manager {
+	b.Helper()
+	m := NewManager(30*time.Second, 64, nil, zap.NewNop())
+	b.Cleanup(m.Stop)
+	for i := 0; i < *benchSessions; i++ {
+		m.Create("p"+strconv.Itoa(i), "bot", "", nopSender{})
+	}
+	b.ResetTimer()
+	return m
+}
+
+func BenchmarkCreate(b *testing.B) {
+	m := benchManager(b)
+	next := int64(*benchSessions)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := atomic.AddInt64(&next, 1)
+			m.Create("p"+strconv.FormatInt(id, 10), "bot", "", nopSender{})
+		}
+	})
+}
+
+func BenchmarkOfflineBind(b *testing.B) {
+	m := benchManager(b)
+	var next int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := "p" + strconv.FormatInt(atomic.AddInt64(&next, 1)%int64(*benchSessions), 10)
+			m.MarkOffline(id, nopSender{})
+			m.Bind(id, nopSender{}, 0)
+		}
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	m := benchManager(b)
+	var next int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := "p" + strconv.FormatInt(atomic.AddInt64(&next, 1)%int64(*benchSessions), 10)
+			m.IsOnline(id)
+		}
+	})
+}
+
+func BenchmarkOnlineCount(b *testing.B) {
+	m := benchManager(b)
+	for i := 0; i < b.N; i++ {
+		_ = m.OnlineCount()
+	}
+}
+
+// BenchmarkExpire reports how long after their shared deadline the preloaded
+// sessions, all offline, are removed.
+func BenchmarkExpire(b *testing.B) {
+	var late time.Duration
+	for i := 0; i < b.N; i++ {
+		m := NewManager(time.Second, 64, nil, zap.NewNop())
+		for j := 0; j < *benchSessions; j++ {
+			id := "p" + strconv.Itoa(j)
+			m.Create(id, "bot", "", nopSender{})
+			m.MarkOffline(id, nopSender{})
+		}
+		deadline := time.Now().Add(time.Second)
+		for m.Len() > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		late += time.Since(deadline)
+		m.Stop()
+	}
+	b.ReportMetric(float64(late.Microseconds())/1000/float64(b.N), "ms-late/op")
+}
@@ -0,0 +1,118 @@
+package session
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// retransmitEntry schedules the next resend check of a session with unacked
+// reliable messages.
+type retransmitEntry struct {
+	at    time.Time
+	s     *Session
+	index int
+}
+
+type retransmitHeap []*retransmitEntry
+
+func (h retransmitHeap) Len() int           { return len(h) }
+func (h retransmitHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h retransmitHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *retransmitHeap) Push(x interface{}) {
+	e := x.(*retransmitEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *retransmitHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	*h = old[:n-1]
+	return e
+}
+
+// retransmitQueue is a min-heap of the sessions waiting on an ack, keyed by
+// when they are next due a resend, with at most one entry per session. wake
+// is signalled when a schedule moves the earliest deadline forward.
+type retransmitQueue struct {
+	mu      sync.Mutex
+	h       retransmitHeap
+	entries map[*Session]*retransmitEntry
+	wake    chan struct{}
+}
+
+func newRetransmitQueue() *retransmitQueue {
+	return &retransmitQueue{
+		entries: make(map[*Session]*retransmitEntry),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// schedule makes s due no later than at. A session already due earlier keeps
+// its deadline; the resend check reschedules it from what is then pending.
+func (q *retransmitQueue) schedule(s *Session, at time.Time) {
+	q.mu.Lock()
+	e := q.entries[s]
+	switch {
+	case e == nil:
+		e = &retransmitEntry{at: at, s: s}
+		q.entries[s] = e
+		heap.Push(&q.h, e)
+	case at.Before(e.at):
+		e.at = at
+		heap.Fix(&q.h, e.index)
+	default:
+		q.mu.Unlock()
+		return
+	}
+	first := q.h[0] == e
+	q.mu.Unlock()
+	if first {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// cancel drops s from the queue, once it has nothing left to resend.
+func (q *retransmitQueue) cancel(s *Session) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if e := q.entries[s]; e != nil {
+		heap.Remove(&q.h, e.index)
+		delete(q.entries, s)
+	}
+}
+
+func (q *retransmitQueue) peek() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.h) == 0 {
+		return time.Time{}, false
+	}
+	return q.h[0].at, true
+}
+
+func (q *retransmitQueue) popDue(now time.Time) []*Session {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var due []*Session
+	for len(q.h) > 0 && !q.h[0].at.After(now) {
+		e := heap.Pop(&q.h).(*retransmitEntry)
+		delete(q.entries, e.s)
+		due = append(due, e.s)
+	}
+	return due
+}
+
+func (q *retransmitQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.h)
+}
@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/gogo/protobuf/proto"
-	"go.uber.org/zap"
 
 	"miniarena/pkg/protocol"
 	"miniarena/server/internal/metrics"
@@ -26,32 +25,82 @@ type Session struct {
 	PlayerID       string
 	Username       string
 	RoomID         string
+	InQueue        bool
+	SpectateRoomID string
 	ReconnectToken string
 	Online         bool
 	LastSeen       time.Time
 	sender         Sender
 	seq            uint64
-}
-
-func (s *Session) SetSender(sender Sender) {
+	reliableSeq    uint64
+	pending        []reliableMsg
+	maxPending     int
+	metrics        *metrics.Metrics
+	retransmits    *retransmitQueue
+	removed        bool
+}
+
+// reliableMsg is an encoded reliable message waiting for the client's ack.
+// sentAt is zero until the message is handed to a connection.
+type reliableMsg struct {
+	seq     uint64
+	payload []byte
+	sentAt  time.Time
+}
+
+// setSender attaches a connection and resends every reliable message after
+// lastAcked to it before anything else can be sent. It reports whether the
+// session came online and false for ok when the session was already removed.
+func (s *Session) setSender(sender Sender, lastAcked uint64) (cameOnline, ok bool) {
 	var old Sender
 	s.mu.Lock()
+	if s.removed {
+		s.mu.Unlock()
+		return false, false
+	}
 	old = s.sender
+	cameOnline = !s.Online
 	s.sender = sender
 	s.Online = true
 	s.LastSeen = time.Now()
+	s.ackLocked(lastAcked)
+	s.resendLocked(s.LastSeen)
+	s.scheduleLocked(s.LastSeen)
 	s.mu.Unlock()
 	if old != nil && old != sender {
 		_ = old.Close()
 	}
+	return cameOnline, true
 }
 
-func (s *Session) ClearSender() {
+// clearSender detaches the connection if it is still sender; a connection
+// replaced by a reconnect must not take the new one offline. It reports
+// whether the session went offline and the time it did so.
+func (s *Session) clearSender(sender Sender) (wentOffline bool, at time.Time) {
 	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.removed || s.sender != sender {
+		return false, s.LastSeen
+	}
+	wentOffline = s.Online
 	s.sender = nil
 	s.Online = false
 	s.LastSeen = time.Now()
-	s.mu.Unlock()
+	s.scheduleLocked(s.LastSeen)
+	return wentOffline, s.LastSeen
+}
+
+// markRemoved detaches the session from its manager. It reports whether the
+// session was online at that point.
+func (s *Session) markRemoved() (wasOnline bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.removed {
+		return false
+	}
+	s.removed = true
+	s.scheduleLocked(time.Now())
+	return s.Online
 }
 
 func (s *Session) Send(msgType protocol.MsgType, msg proto.Message) error {
@@ -71,168 +120,122 @@ func (s *Session) Send(msgType protocol.MsgType, msg proto.Message) error {
 	return sender.Send(payload)
 }
 
-func (s *Session) GetRoomID() string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.RoomID
-}
-
-type Manager struct {
-	mu           sync.RWMutex
-	sessions     map[string]*Session
-	reconnectTTL time.Duration
-	metrics      *metrics.Metrics
-	log          *zap.Logger
-}
+// SendReliable sequences msg on the reliable channel and keeps it buffered
+// until the client acks it. Messages that cannot be delivered right now stay
+// in the buffer and are resent on reconnect or by the retransmit loop, so
+// only encoding errors are returned.
+func (s *Session) SendReliable(msgType protocol.MsgType, msg proto.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-func NewManager(reconnectTTL time.Duration, metrics *metrics.Metrics, log *zap.Logger) *Manager {
-	m := &Manager{
-		sessions:     make(map[string]*Session),
-		reconnectTTL: reconnectTTL,
-		metrics:      metrics,
-		log:          log,
+	seq := s.reliableSeq + 1
+	payload, err := protocol.EncodeReliable(msgType, msg, seq)
+	if err != nil {
+		return err
+	}
+	s.reliableSeq = seq
+	if s.maxPending > 0 && len(s.pending) >= s.maxPending {
+		s.pending = s.pending[1:]
+		if s.metrics != nil {
+			s.metrics.ReliableOverflow.Inc()
+		}
+	}
+	m := reliableMsg{seq: seq, payload: payload}
+	now := time.Now()
+	// Sending under the lock keeps reliable messages in seq order on the
+	// wire. A message sent out of turn, after an earlier one failed, is
+	// dropped by the client and goes again with the rest on retransmit.
+	if s.Online && s.sender != nil && s.sender.Send(payload) == nil {
+		m.sentAt = now
 	}
-	go m.cleanupLoop()
-	return m
+	s.pending = append(s.pending, m)
+	s.scheduleLocked(now)
+	return nil
 }
 
-func (m *Manager) Create(playerID, username, reconnectToken string, sender Sender) *Session {
-	s := &Session{
-		PlayerID:       playerID,
-		Username:       username,
-		ReconnectToken: reconnectToken,
-		Online:         true,
-		LastSeen:       time.Now(),
-		sender:         sender,
-	}
-
-	m.mu.Lock()
-	m.sessions[playerID] = s
-	m.mu.Unlock()
-	m.updateOnlineGauge()
-	return s
+// Ack drops buffered reliable messages up to and including seq.
+func (s *Session) Ack(seq uint64) {
+	s.mu.Lock()
+	s.ackLocked(seq)
+	if len(s.pending) == 0 {
+		s.scheduleLocked(time.Now())
+	}
+	s.mu.Unlock()
 }
 
-func (m *Manager) Bind(playerID string, sender Sender) (*Session, bool) {
-	m.mu.RLock()
-	s := m.sessions[playerID]
-	m.mu.RUnlock()
-	if s == nil {
-		return nil, false
+// retransmit resends the buffered reliable messages when the oldest has gone
+// unacked for after, or was never sent, and schedules the next check. It
+// returns the number resent.
+func (s *Session) retransmit(now time.Time, after time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	if len(s.pending) > 0 && now.Sub(s.pending[0].sentAt) >= after {
+		n = s.resendLocked(now)
 	}
-	s.SetSender(sender)
-	m.updateOnlineGauge()
-	return s, true
+	s.scheduleLocked(now)
+	return n
 }
 
-func (m *Manager) SetRoom(playerID, roomID string) {
-	m.mu.RLock()
-	s := m.sessions[playerID]
-	m.mu.RUnlock()
-	if s == nil {
+// scheduleLocked queues the session for its next resend check, or drops it
+// from the queue when there is nothing it could resend. A message the
+// connection refused is retried after half the timeout rather than at once,
+// so a full connection is not polled in a busy loop.
+func (s *Session) scheduleLocked(now time.Time) {
+	if s.retransmits == nil {
 		return
 	}
-	s.mu.Lock()
-	s.RoomID = roomID
-	s.mu.Unlock()
-}
-
-func (m *Manager) MarkOffline(playerID string) {
-	m.mu.RLock()
-	s := m.sessions[playerID]
-	m.mu.RUnlock()
-	if s == nil {
+	if s.removed || !s.Online || s.sender == nil || len(s.pending) == 0 {
+		s.retransmits.cancel(s)
 		return
 	}
-	s.ClearSender()
-	m.updateOnlineGauge()
-}
-
-func (m *Manager) Remove(playerID string) {
-	m.mu.Lock()
-	delete(m.sessions, playerID)
-	m.mu.Unlock()
-	m.updateOnlineGauge()
-}
-
-func (m *Manager) Get(playerID string) (*Session, bool) {
-	m.mu.RLock()
-	s := m.sessions[playerID]
-	m.mu.RUnlock()
-	if s == nil {
-		return nil, false
+	at := s.pending[0].sentAt.Add(retransmitAfter)
+	if retry := now.Add(retransmitAfter / 2); at.Before(retry) {
+		at = retry
 	}
-	return s, true
+	s.retransmits.schedule(s, at)
 }
 
-func (m *Manager) IsOnline(playerID string) bool {
-	s, ok := m.Get(playerID)
-	if !ok {
-		return false
+// resendLocked sends every buffered reliable message, oldest first, and
+// stops at the first the connection refuses so the rest keep their order.
+func (s *Session) resendLocked(now time.Time) int {
+	if !s.Online || s.sender == nil {
+		return 0
 	}
-	s.mu.RLock()
-	online := s.Online
-	s.mu.RUnlock()
-	return online
-}
-
-func (m *Manager) Send(playerID string, msgType protocol.MsgType, msg proto.Message) error {
-	s, ok := m.Get(playerID)
-	if !ok {
-		return ErrNotFound
+	n := 0
+	for i := range s.pending {
+		if s.sender.Send(s.pending[i].payload) != nil {
+			break
+		}
+		s.pending[i].sentAt = now
+		n++
 	}
-	return s.Send(msgType, msg)
-}
-
-func (m *Manager) Broadcast(playerIDs []string, msgType protocol.MsgType, msg proto.Message) {
-	for _, pid := range playerIDs {
-		_ = m.Send(pid, msgType, msg)
+	if s.metrics != nil {
+		s.metrics.ReliableReplayed.Add(float64(n))
 	}
+	return n
 }
 
-func (m *Manager) updateOnlineGauge() {
-	if m.metrics == nil {
-		return
+func (s *Session) ackLocked(seq uint64) {
+	n := 0
+	for n < len(s.pending) && s.pending[n].seq <= seq {
+		n++
 	}
-	count := 0
-	m.mu.RLock()
-	for _, s := range m.sessions {
-		s.mu.RLock()
-		if s.Online {
-			count++
-		}
-		s.mu.RUnlock()
+	if n == 0 {
+		return
 	}
-	m.mu.RUnlock()
-	m.metrics.OnlineGauge.Set(float64(count))
+	s.pending = append(s.pending[:0:0], s.pending[n:]...)
 }
 
-func (m *Manager) cleanupLoop() {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		var toRemove []string
-		now := time.Now()
-		m.mu.RLock()
-		for id, s := range m.sessions {
-			s.mu.RLock()
-			offline := !s.Online
-			last := s.LastSeen
-			s.mu.RUnlock()
-			if offline && now.Sub(last) > m.reconnectTTL {
-				toRemove = append(toRemove, id)
-			}
-		}
-		m.mu.RUnlock()
-		if len(toRemove) == 0 {
-			continue
-		}
-		m.mu.Lock()
-		for _, id := range toRemove {
-			delete(m.sessions, id)
-		}
-		m.mu.Unlock()
-		m.updateOnlineGauge()
-	}
+func (s *Session) GetRoomID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.RoomID
+}
+
+// Presence returns a consistent view of the fields presence is derived from.
+func (s *Session) Presence() (online bool, roomID string, inQueue bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Online, s.RoomID, s.InQueue
 }
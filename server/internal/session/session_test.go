@@ -0,0 +1,237 @@
+package session
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+)
+
+// recordSender records the seq of every reliable message it accepts and
+// refuses everything while full is set.
+type recordSender struct {
+	mu   sync.Mutex
+	full bool
+	seqs []uint64
+}
+
+func (r *recordSender) Send(data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.full {
+		return errors.New("send queue full")
+	}
+	env, err := protocol.DecodeEnvelope(data)
+	if err != nil {
+		return err
+	}
+	if env.Reliable {
+		r.seqs = append(r.seqs, env.Seq)
+	}
+	return nil
+}
+
+func (r *recordSender) Close() error { return nil }
+
+func (r *recordSender) setFull(full bool) {
+	r.mu.Lock()
+	r.full = full
+	r.mu.Unlock()
+}
+
+func (r *recordSender) take() []uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seqs := r.seqs
+	r.seqs = nil
+	return seqs
+}
+
+func newTestManager(t *testing.T) *Manager {
+	m := NewManager(time.Minute, 0, nil, zap.NewNop())
+	t.Cleanup(m.Stop)
+	return m
+}
+
+func sendReliable(t *testing.T, m *Manager, playerID string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := m.SendReliable(playerID, protocol.MsgRoomOver, &protocol.RoomOver{}); err != nil {
+			t.Fatalf("SendReliable: %v", err)
+		}
+	}
+}
+
+func TestReliableRetransmit(t *testing.T) {
+	cases := []struct {
+		name   string
+		full   int    // messages sent while the connection refuses them
+		sent   int    // messages sent after it accepts again
+		ack    uint64 // ack before the retransmit
+		onWire []uint64
+		resent []uint64
+	}{
+		{name: "all acked", sent: 3, ack: 3, onWire: []uint64{1, 2, 3}},
+		{name: "unacked tail", sent: 3, ack: 1, onWire: []uint64{1, 2, 3}, resent: []uint64{2, 3}},
+		{name: "refused then sent", full: 2, sent: 1, onWire: []uint64{3}, resent: []uint64{1, 2, 3}},
+		{name: "refused only", full: 2, resent: []uint64{1, 2}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newTestManager(t)
+			conn := &recordSender{}
+			s := m.Create("p1", "alice", "tok", conn)
+
+			conn.setFull(true)
+			sendReliable(t, m, "p1", tc.full)
+			conn.setFull(false)
+			sendReliable(t, m, "p1", tc.sent)
+			if got := conn.take(); !reflect.DeepEqual(got, tc.onWire) {
+				t.Fatalf("on wire = %v, want %v", got, tc.onWire)
+			}
+
+			m.Ack("p1", tc.ack)
+			s.retransmit(time.Now().Add(retransmitAfter), retransmitAfter)
+			if got := conn.take(); !reflect.DeepEqual(got, tc.resent) {
+				t.Fatalf("resent = %v, want %v", got, tc.resent)
+			}
+		})
+	}
+}
+
+func TestReliableRetransmitWaits(t *testing.T) {
+	m := newTestManager(t)
+	conn := &recordSender{}
+	s := m.Create("p1", "alice", "tok", conn)
+	sendReliable(t, m, "p1", 2)
+	conn.take()
+
+	if n := s.retransmit(time.Now(), retransmitAfter); n != 0 {
+		t.Fatalf("retransmit before the timeout resent %d messages", n)
+	}
+}
+
+func TestBindReplaysBeforeNewTraffic(t *testing.T) {
+	cases := []struct {
+		name      string
+		lastAcked uint64
+		want      []uint64
+	}{
+		{name: "nothing acked", lastAcked: 0, want: []uint64{1, 2, 3, 4}},
+		{name: "some acked", lastAcked: 2, want: []uint64{3, 4}},
+		{name: "all acked", lastAcked: 3, want: []uint64{4}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newTestManager(t)
+			old := &recordSender{}
+			m.Create("p1", "alice", "tok", old)
+			m.MarkOffline("p1", old)
+			sendReliable(t, m, "p1", 3)
+
+			conn := &recordSender{}
+			if _, ok := m.Bind("p1", conn, tc.lastAcked); !ok {
+				t.Fatal("Bind failed")
+			}
+			sendReliable(t, m, "p1", 1)
+			if got := conn.take(); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("delivered = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetransmitQueue(t *testing.T) {
+	cases := []struct {
+		name    string
+		sent    int
+		ack     uint64
+		offline bool
+		rebind  bool
+		queued  bool
+	}{
+		{name: "nothing sent"},
+		{name: "all acked", sent: 2, ack: 2},
+		{name: "unacked", sent: 2, ack: 1, queued: true},
+		{name: "offline", sent: 2, offline: true},
+		{name: "offline then rebound", sent: 2, offline: true, rebind: true, queued: true},
+		{name: "rebound with all acked", sent: 2, ack: 2, offline: true, rebind: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newTestManager(t)
+			conn := &recordSender{}
+			m.Create("p1", "alice", "tok", conn)
+			// An idle session never enters the queue.
+			m.Create("p2", "bob", "tok", &recordSender{})
+
+			sendReliable(t, m, "p1", tc.sent)
+			m.Ack("p1", tc.ack)
+			if tc.offline {
+				m.MarkOffline("p1", conn)
+			}
+			if tc.rebind {
+				m.Bind("p1", &recordSender{}, tc.ack)
+			}
+
+			want := 0
+			if tc.queued {
+				want = 1
+			}
+			if got := m.retransmits.len(); got != want {
+				t.Fatalf("%d sessions queued, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestRetransmitDue(t *testing.T) {
+	m := newTestManager(t)
+	conn := &recordSender{}
+	m.Create("p1", "alice", "tok", conn)
+	sendReliable(t, m, "p1", 2)
+	conn.take()
+
+	m.retransmitDue(time.Now())
+	if got := conn.take(); got != nil {
+		t.Fatalf("resent %v before the timeout", got)
+	}
+	at, ok := m.retransmits.peek()
+	if !ok {
+		t.Fatal("session left the queue before its messages were acked")
+	}
+
+	m.retransmitDue(at.Add(time.Millisecond))
+	if got := conn.take(); !reflect.DeepEqual(got, []uint64{1, 2}) {
+		t.Fatalf("resent %v, want [1 2]", got)
+	}
+	if next, ok := m.retransmits.peek(); !ok || !next.After(at) {
+		t.Fatalf("next resend at %v, %v; want after %v", next, ok, at)
+	}
+
+	m.Ack("p1", 2)
+	if _, ok := m.retransmits.peek(); ok {
+		t.Fatal("session still queued after its messages were acked")
+	}
+}
+
+func TestStopEndsLoops(t *testing.T) {
+	m := NewManager(time.Minute, 0, nil, zap.NewNop())
+	done := make(chan struct{})
+	go func() {
+		m.runDue(m.retransmits.peek, m.retransmits.wake, func(time.Time) {})
+		close(done)
+	}()
+	m.Stop()
+	m.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("loop still running after Stop")
+	}
+}
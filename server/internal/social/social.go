@@ -0,0 +1,280 @@
+package social
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/session"
+	"miniarena/server/internal/store"
+)
+
+const storeTimeout = 2 * time.Second
+
+// Service handles friend requests and pushes presence changes to friends who
+// subscribed to them. Friendships are keyed by player ID, which a player
+// keeps across logins with their identity token; usernames are only shown.
+type Service struct {
+	friends  store.Friends
+	sessions *session.Manager
+	log      *zap.Logger
+
+	mu sync.Mutex
+	// watchers maps a player ID to the player IDs subscribed to it.
+	watchers map[string]map[string]struct{}
+	// watching maps a player ID to the player IDs it subscribed to.
+	watching map[string]map[string]struct{}
+}
+
+func NewService(friends store.Friends, sessions *session.Manager, log *zap.Logger) *Service {
+	return &Service{
+		friends:  friends,
+		sessions: sessions,
+		log:      log,
+		watchers: make(map[string]map[string]struct{}),
+		watching: make(map[string]map[string]struct{}),
+	}
+}
+
+// AddFriend sends a friend request, or accepts the target's pending request.
+// The target must have a session, online or waiting for reconnect.
+func (s *Service) AddFriend(playerID, friendID string) error {
+	if _, ok := s.sessions.Get(friendID); !ok {
+		return session.ErrNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if _, err := s.friends.Request(ctx, playerID, friendID); err != nil {
+		return err
+	}
+	s.pushFriendList(playerID)
+	s.pushFriendList(friendID)
+	return nil
+}
+
+func (s *Service) AcceptFriend(playerID, friendID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := s.friends.Accept(ctx, playerID, friendID); err != nil {
+		return err
+	}
+	s.pushFriendList(playerID)
+	s.pushFriendList(friendID)
+	return nil
+}
+
+// RemoveFriend removes a friendship or declines/cancels a pending request,
+// and drops presence subscriptions in both directions.
+func (s *Service) RemoveFriend(playerID, friendID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := s.friends.Remove(ctx, playerID, friendID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.unwatchLocked(playerID, friendID)
+	s.unwatchLocked(friendID, playerID)
+	s.mu.Unlock()
+
+	s.pushFriendList(playerID)
+	s.pushFriendList(friendID)
+	return nil
+}
+
+// SendFriendList sends the player's friends with their presence and any
+// pending requests.
+func (s *Service) SendFriendList(playerID string) error {
+	resp, err := s.friendList(playerID)
+	if err != nil {
+		return err
+	}
+	return s.sessions.Send(playerID, protocol.MsgFriendListResp, resp)
+}
+
+// Subscribe starts pushing presence for the given friends, or for all
+// friends when playerIDs is empty. The current presence is sent right away.
+// Players who are not friends are ignored.
+func (s *Service) Subscribe(playerID string, playerIDs []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	list, err := s.friends.List(ctx, playerID)
+	if err != nil {
+		return err
+	}
+	targets := list.Friends
+	if len(playerIDs) > 0 {
+		targets = intersect(playerIDs, list.Friends)
+	}
+
+	s.mu.Lock()
+	for _, f := range targets {
+		s.watchLocked(playerID, f.PlayerID)
+	}
+	s.mu.Unlock()
+
+	for _, f := range targets {
+		_ = s.sessions.Send(playerID, protocol.MsgPresenceUpdate, s.presence(f.PlayerID, f.Username))
+	}
+	return nil
+}
+
+// Unsubscribe stops presence pushes for the given players, or for all of
+// them when playerIDs is empty.
+func (s *Service) Unsubscribe(playerID string, playerIDs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(playerIDs) == 0 {
+		for id := range s.watching[playerID] {
+			s.unwatchLocked(playerID, id)
+		}
+		return
+	}
+	for _, id := range playerIDs {
+		s.unwatchLocked(playerID, id)
+	}
+}
+
+// OnSessionEvent records the names players log in with and fans presence
+// changes out to subscribers.
+func (s *Service) OnSessionEvent(ev session.Event) {
+	switch ev.Type {
+	case session.EventLoggedIn:
+		// The store call must not hold up the login that published this.
+		go s.setName(ev.PlayerID, ev.Username)
+	case session.EventExpired:
+		s.mu.Lock()
+		for id := range s.watching[ev.PlayerID] {
+			s.unwatchLocked(ev.PlayerID, id)
+		}
+		s.mu.Unlock()
+	}
+	s.broadcast(ev.PlayerID, ev.Username)
+}
+
+func (s *Service) setName(playerID, username string) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := s.friends.SetName(ctx, playerID, username); err != nil {
+		s.log.Warn("save player name failed", zap.Error(err), zap.String("player", playerID))
+	}
+}
+
+func (s *Service) broadcast(playerID, username string) {
+	s.mu.Lock()
+	subs := make([]string, 0, len(s.watchers[playerID]))
+	for pid := range s.watchers[playerID] {
+		subs = append(subs, pid)
+	}
+	s.mu.Unlock()
+	if len(subs) == 0 {
+		return
+	}
+	s.sessions.Broadcast(subs, protocol.MsgPresenceUpdate, s.presence(playerID, username))
+}
+
+// presence reports playerID's status; username is used while the player has
+// no session.
+func (s *Service) presence(playerID, username string) *protocol.PresenceUpdate {
+	update := &protocol.PresenceUpdate{PlayerId: playerID, Username: username, Status: protocol.PresenceOffline}
+	sess, ok := s.sessions.Get(playerID)
+	if !ok {
+		return update
+	}
+	update.Username = s.sessions.Username(playerID)
+	online, roomID, queued := sess.Presence()
+	switch {
+	case !online:
+	case roomID != "":
+		update.Status = protocol.PresenceInMatch
+		update.RoomId = roomID
+	case queued:
+		update.Status = protocol.PresenceInQueue
+	default:
+		update.Status = protocol.PresenceIdle
+	}
+	return update
+}
+
+func (s *Service) friendList(playerID string) (*protocol.FriendListResp, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	list, err := s.friends.List(ctx, playerID)
+	if err != nil {
+		return nil, err
+	}
+	resp := &protocol.FriendListResp{
+		Friends:  make([]*protocol.PresenceUpdate, 0, len(list.Friends)),
+		Incoming: refs(list.Incoming),
+		Outgoing: refs(list.Outgoing),
+	}
+	for _, f := range list.Friends {
+		resp.Friends = append(resp.Friends, s.presence(f.PlayerID, f.Username))
+	}
+	return resp, nil
+}
+
+// pushFriendList refreshes the friend list of playerID if it is online.
+func (s *Service) pushFriendList(playerID string) {
+	if !s.sessions.IsOnline(playerID) {
+		return
+	}
+	resp, err := s.friendList(playerID)
+	if err != nil {
+		s.log.Warn("friend list failed", zap.Error(err), zap.String("player", playerID))
+		return
+	}
+	_ = s.sessions.Send(playerID, protocol.MsgFriendListResp, resp)
+}
+
+func (s *Service) watchLocked(playerID, target string) {
+	if s.watchers[target] == nil {
+		s.watchers[target] = make(map[string]struct{})
+	}
+	s.watchers[target][playerID] = struct{}{}
+	if s.watching[playerID] == nil {
+		s.watching[playerID] = make(map[string]struct{})
+	}
+	s.watching[playerID][target] = struct{}{}
+}
+
+func (s *Service) unwatchLocked(playerID, target string) {
+	if w := s.watchers[target]; w != nil {
+		delete(w, playerID)
+		if len(w) == 0 {
+			delete(s.watchers, target)
+		}
+	}
+	if w := s.watching[playerID]; w != nil {
+		delete(w, target)
+		if len(w) == 0 {
+			delete(s.watching, playerID)
+		}
+	}
+}
+
+func refs(friends []store.Friend) []*protocol.FriendRef {
+	out := make([]*protocol.FriendRef, 0, len(friends))
+	for _, f := range friends {
+		out = append(out, &protocol.FriendRef{PlayerId: f.PlayerID, Username: f.Username})
+	}
+	return out
+}
+
+// intersect returns the friends whose player IDs are in ids.
+func intersect(ids []string, friends []store.Friend) []store.Friend {
+	set := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	var out []store.Friend
+	for _, f := range friends {
+		if _, ok := set[f.PlayerID]; ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
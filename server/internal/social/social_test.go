@@ -0,0 +1,150 @@
+package social
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+
+	"miniarena/pkg/protocol"
+	"miniarena/server/internal/session"
+	"miniarena/server/internal/store"
+)
+
+// presenceSender keeps the presence updates a player's connection receives.
+type presenceSender struct {
+	mu      sync.Mutex
+	updates []*protocol.PresenceUpdate
+}
+
+func (s *presenceSender) Send(data []byte) error {
+	env, err := protocol.DecodeEnvelope(data)
+	if err != nil || env.Type != protocol.MsgPresenceUpdate {
+		return err
+	}
+	var update protocol.PresenceUpdate
+	if err := proto.Unmarshal(env.Body, &update); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.updates = append(s.updates, &update)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *presenceSender) Close() error { return nil }
+
+var statusNames = map[protocol.PresenceStatus]string{
+	protocol.PresenceOffline: "offline",
+	protocol.PresenceIdle:    "idle",
+	protocol.PresenceInQueue: "queue",
+	protocol.PresenceInMatch: "match",
+}
+
+// take returns the statuses received since the last take, with the room for
+// in-match updates.
+func (s *presenceSender) take() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, u := range s.updates {
+		status := u.PlayerId + ":" + statusNames[u.Status]
+		if u.RoomId != "" {
+			status += ":" + u.RoomId
+		}
+		out = append(out, status)
+	}
+	s.updates = nil
+	return out
+}
+
+func TestPresence(t *testing.T) {
+	cases := []struct {
+		name string
+		do   func(t *testing.T, svc *Service, sessions *session.Manager, a *presenceSender)
+		// want is what b, a's friend who subscribed, receives. c also
+		// subscribed to a but is not a friend and receives nothing.
+		want []string
+	}{
+		{
+			name: "queued",
+			do: func(t *testing.T, svc *Service, sessions *session.Manager, a *presenceSender) {
+				sessions.SetQueued("a", true)
+				sessions.SetQueued("a", true)
+			},
+			want: []string{"a:queue"},
+		},
+		{
+			name: "in a match",
+			do: func(t *testing.T, svc *Service, sessions *session.Manager, a *presenceSender) {
+				sessions.SetRoom("a", "r1")
+			},
+			want: []string{"a:match:r1"},
+		},
+		{
+			name: "offline and back",
+			do: func(t *testing.T, svc *Service, sessions *session.Manager, a *presenceSender) {
+				sessions.MarkOffline("a", a)
+				sessions.Bind("a", a, 0)
+			},
+			want: []string{"a:offline", "a:idle"},
+		},
+		{
+			name: "unsubscribed",
+			do: func(t *testing.T, svc *Service, sessions *session.Manager, a *presenceSender) {
+				svc.Unsubscribe("b", nil)
+				sessions.SetQueued("a", true)
+			},
+		},
+		{
+			name: "unfriended",
+			do: func(t *testing.T, svc *Service, sessions *session.Manager, a *presenceSender) {
+				if err := svc.RemoveFriend("a", "b"); err != nil {
+					t.Fatal(err)
+				}
+				sessions.SetQueued("a", true)
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			log := zap.NewNop()
+			sessions := session.NewManager(time.Minute, 0, nil, log)
+			defer sessions.Stop()
+			svc := NewService(store.NewMemoryFriends(), sessions, log)
+			sessions.Subscribe(svc.OnSessionEvent)
+
+			senders := map[string]*presenceSender{"a": {}, "b": {}, "c": {}}
+			for id, s := range senders {
+				sessions.Create(id, id, "", s)
+			}
+			if err := svc.AddFriend("b", "a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := svc.AcceptFriend("a", "b"); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []string{"b", "c"} {
+				if err := svc.Subscribe(id, []string{"a"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Subscribing sends the current presence right away.
+			if got, want := senders["b"].take(), []string{"a:idle"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("b got %v on subscribe, want %v", got, want)
+			}
+
+			tc.do(t, svc, sessions, senders["a"])
+
+			if got := senders["b"].take(); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("b got %v, want %v", got, tc.want)
+			}
+			if got := senders["c"].take(); got != nil {
+				t.Fatalf("c, not a friend, got %v", got)
+			}
+		})
+	}
+}
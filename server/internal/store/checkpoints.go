@@ -0,0 +1,88 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"miniarena/server/internal/battle"
+)
+
+// CheckpointVersion is bumped whenever Checkpoint or battle.State changes in
+// a way an older checkpoint cannot be resumed from.
+const CheckpointVersion = 1
+
+// Checkpoint is a snapshot of a match in progress, written so a restarted
+// server can resume or settle it.
+type Checkpoint struct {
+	// Version is set on save; checkpoints of another version are not loaded.
+	Version int
+	RoomID  string
+	MatchID string
+	// Players are the human seats; Bots the seats played by the server AI.
+	Players []string
+	Bots    []string
+	// Names are the players' usernames, so restored sessions keep them.
+	Names   map[string]string
+	State   *battle.State
+	SavedAt time.Time
+}
+
+// Checkpoints stores the latest checkpoint of every live match.
+type Checkpoints interface {
+	SaveCheckpoint(ctx context.Context, cp Checkpoint) error
+	DeleteCheckpoint(ctx context.Context, roomID string) error
+	LoadCheckpoints(ctx context.Context) ([]Checkpoint, error)
+}
+
+const checkpointPrefix = "checkpoint:"
+
+// RedisCheckpoints keeps each room's checkpoint gob-encoded under
+// checkpoint:<room_id>. ttl drops checkpoints nobody came back for.
+type RedisCheckpoints struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+func NewRedisCheckpoints(rdb *redis.Client, ttl time.Duration) *RedisCheckpoints {
+	return &RedisCheckpoints{rdb: rdb, ttl: ttl}
+}
+
+func (s *RedisCheckpoints) SaveCheckpoint(ctx context.Context, cp Checkpoint) error {
+	cp.Version = CheckpointVersion
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cp); err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, checkpointPrefix+cp.RoomID, buf.Bytes(), s.ttl).Err()
+}
+
+func (s *RedisCheckpoints) DeleteCheckpoint(ctx context.Context, roomID string) error {
+	return s.rdb.Del(ctx, checkpointPrefix+roomID).Err()
+}
+
+func (s *RedisCheckpoints) LoadCheckpoints(ctx context.Context) ([]Checkpoint, error) {
+	var out []Checkpoint
+	iter := s.rdb.Scan(ctx, 0, checkpointPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		data, err := s.rdb.Get(ctx, iter.Val()).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Checkpoints written by an incompatible build are skipped and
+		// left to expire. Ones from before versioning decode as version 0.
+		var cp Checkpoint
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&cp); err != nil || cp.Version != CheckpointVersion {
+			continue
+		}
+		out = append(out, cp)
+	}
+	return out, iter.Err()
+}
@@ -0,0 +1,321 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrSelfFriend       = errors.New("cannot befriend yourself")
+	ErrAlreadyFriends   = errors.New("already friends")
+	ErrAlreadyRequested = errors.New("friend request already sent")
+	ErrNoFriendRequest  = errors.New("no pending friend request")
+)
+
+// Friend is the other player of a friendship or request. Username is the
+// name the player last logged in with, or "" if never recorded.
+type Friend struct {
+	PlayerID string
+	Username string
+}
+
+// FriendList is one player's view of the social graph.
+type FriendList struct {
+	Friends  []Friend
+	Incoming []Friend
+	Outgoing []Friend
+}
+
+// Friends stores friendships between player IDs. A request from a to b is
+// pending until b accepts it; a request that crosses an existing one in the
+// other direction is accepted immediately.
+type Friends interface {
+	Request(ctx context.Context, from, to string) (accepted bool, err error)
+	Accept(ctx context.Context, playerID, from string) error
+	Remove(ctx context.Context, playerID, other string) error
+	List(ctx context.Context, playerID string) (FriendList, error)
+	// SetName records the username friend lists show for playerID.
+	SetName(ctx context.Context, playerID, username string) error
+}
+
+var friendsSchema = []string{
+	`CREATE TABLE IF NOT EXISTS friend_pairs (
+	player_a     VARCHAR(64) NOT NULL,
+	player_b     VARCHAR(64) NOT NULL,
+	requested_by VARCHAR(64) NOT NULL,
+	accepted     TINYINT(1)  NOT NULL DEFAULT 0,
+	created_at   TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (player_a, player_b),
+	KEY idx_player_b (player_b)
+)`,
+	`CREATE TABLE IF NOT EXISTS player_names (
+	player_id  VARCHAR(64) NOT NULL PRIMARY KEY,
+	username   VARCHAR(64) NOT NULL,
+	updated_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+)`,
+}
+
+// MySQLFriends keeps one row per pair of players, with player_a < player_b,
+// so requests in both directions land on the same primary key. Writes are
+// single upserts or conditional updates on that row, which keeps crossing
+// requests from racing into inconsistent rows.
+type MySQLFriends struct {
+	db *sqlx.DB
+}
+
+func NewMySQLFriends(ctx context.Context, db *sqlx.DB) (*MySQLFriends, error) {
+	for _, stmt := range friendsSchema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &MySQLFriends{db: db}, nil
+}
+
+func (f *MySQLFriends) Request(ctx context.Context, from, to string) (bool, error) {
+	if from == to {
+		return false, ErrSelfFriend
+	}
+	tx, err := f.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Affected rows tell the cases apart: 1 inserted a request, 2 accepted
+	// the other player's, 0 left an existing row alone.
+	a, b := pair(from, to)
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO friend_pairs (player_a, player_b, requested_by) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE accepted = accepted OR requested_by <> VALUES(requested_by)`,
+		a, b, from)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	switch n {
+	case 1:
+		return false, tx.Commit()
+	case 2:
+		return true, tx.Commit()
+	}
+
+	// The upsert locked the row, so it reads the same until commit.
+	var accepted bool
+	err = tx.GetContext(ctx, &accepted,
+		`SELECT accepted FROM friend_pairs WHERE player_a = ? AND player_b = ?`, a, b)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return false, ErrAlreadyRequested
+	case err != nil:
+		return false, err
+	case accepted:
+		return false, ErrAlreadyFriends
+	}
+	return false, ErrAlreadyRequested
+}
+
+func (f *MySQLFriends) Accept(ctx context.Context, playerID, from string) error {
+	a, b := pair(playerID, from)
+	res, err := f.db.ExecContext(ctx,
+		`UPDATE friend_pairs SET accepted = 1
+		WHERE player_a = ? AND player_b = ? AND requested_by = ? AND accepted = 0`,
+		a, b, from)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoFriendRequest
+	}
+	return nil
+}
+
+func (f *MySQLFriends) Remove(ctx context.Context, playerID, other string) error {
+	a, b := pair(playerID, other)
+	_, err := f.db.ExecContext(ctx, `DELETE FROM friend_pairs WHERE player_a = ? AND player_b = ?`, a, b)
+	return err
+}
+
+func (f *MySQLFriends) List(ctx context.Context, playerID string) (FriendList, error) {
+	var rows []struct {
+		PlayerA     string `db:"player_a"`
+		PlayerB     string `db:"player_b"`
+		RequestedBy string `db:"requested_by"`
+		Accepted    bool   `db:"accepted"`
+		Username    string `db:"username"`
+	}
+	err := f.db.SelectContext(ctx, &rows,
+		`SELECT p.player_a, p.player_b, p.requested_by, p.accepted, COALESCE(n.username, '') AS username
+		FROM friend_pairs p
+		LEFT JOIN player_names n ON n.player_id = IF(p.player_a = ?, p.player_b, p.player_a)
+		WHERE p.player_a = ? OR p.player_b = ?`,
+		playerID, playerID, playerID)
+	if err != nil {
+		return FriendList{}, err
+	}
+	var list FriendList
+	for _, r := range rows {
+		other := Friend{PlayerID: r.PlayerA, Username: r.Username}
+		if other.PlayerID == playerID {
+			other.PlayerID = r.PlayerB
+		}
+		list.add(other, r.Accepted, r.RequestedBy == playerID)
+	}
+	list.sort()
+	return list, nil
+}
+
+func (f *MySQLFriends) SetName(ctx context.Context, playerID, username string) error {
+	_, err := f.db.ExecContext(ctx,
+		`INSERT INTO player_names (player_id, username) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE username = VALUES(username)`,
+		playerID, username)
+	return err
+}
+
+// pair orders two player IDs the way friend_pairs keys them.
+func pair(x, y string) (a, b string) {
+	if x < y {
+		return x, y
+	}
+	return y, x
+}
+
+// friendPair is a friendship or a pending request between two players.
+type friendPair struct {
+	requestedBy string
+	accepted    bool
+}
+
+// MemoryFriends provides a process-local fallback.
+type MemoryFriends struct {
+	mu sync.Mutex
+	// pairs maps each player to the other player of every pair they are in;
+	// both directions share one friendPair.
+	pairs map[string]map[string]*friendPair
+	names map[string]string
+}
+
+func NewMemoryFriends() *MemoryFriends {
+	return &MemoryFriends{
+		pairs: make(map[string]map[string]*friendPair),
+		names: make(map[string]string),
+	}
+}
+
+func (f *MemoryFriends) Request(ctx context.Context, from, to string) (bool, error) {
+	if from == to {
+		return false, ErrSelfFriend
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p := f.pairs[from][to]
+	switch {
+	case p == nil:
+		p = &friendPair{requestedBy: from}
+		f.link(from, to, p)
+		f.link(to, from, p)
+		return false, nil
+	case p.accepted:
+		return false, ErrAlreadyFriends
+	case p.requestedBy == from:
+		return false, ErrAlreadyRequested
+	}
+	p.accepted = true
+	return true, nil
+}
+
+func (f *MemoryFriends) Accept(ctx context.Context, playerID, from string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p := f.pairs[playerID][from]
+	if p == nil || p.accepted || p.requestedBy != from {
+		return ErrNoFriendRequest
+	}
+	p.accepted = true
+	return nil
+}
+
+func (f *MemoryFriends) Remove(ctx context.Context, playerID, other string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.unlink(playerID, other)
+	f.unlink(other, playerID)
+	return nil
+}
+
+func (f *MemoryFriends) List(ctx context.Context, playerID string) (FriendList, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var list FriendList
+	for other, p := range f.pairs[playerID] {
+		list.add(Friend{PlayerID: other, Username: f.names[other]}, p.accepted, p.requestedBy == playerID)
+	}
+	list.sort()
+	return list, nil
+}
+
+func (f *MemoryFriends) SetName(ctx context.Context, playerID, username string) error {
+	f.mu.Lock()
+	f.names[playerID] = username
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *MemoryFriends) link(playerID, other string, p *friendPair) {
+	out := f.pairs[playerID]
+	if out == nil {
+		out = make(map[string]*friendPair)
+		f.pairs[playerID] = out
+	}
+	out[other] = p
+}
+
+func (f *MemoryFriends) unlink(playerID, other string) {
+	if out := f.pairs[playerID]; out != nil {
+		delete(out, other)
+		if len(out) == 0 {
+			delete(f.pairs, playerID)
+		}
+	}
+}
+
+// add files other under friends, or under outgoing or incoming requests
+// depending on who asked.
+func (l *FriendList) add(other Friend, accepted, outgoing bool) {
+	switch {
+	case accepted:
+		l.Friends = append(l.Friends, other)
+	case outgoing:
+		l.Outgoing = append(l.Outgoing, other)
+	default:
+		l.Incoming = append(l.Incoming, other)
+	}
+}
+
+func (l *FriendList) sort() {
+	for _, fs := range [][]Friend{l.Friends, l.Incoming, l.Outgoing} {
+		sort.Slice(fs, func(i, j int) bool {
+			if fs[i].Username != fs[j].Username {
+				return fs[i].Username < fs[j].Username
+			}
+			return fs[i].PlayerID < fs[j].PlayerID
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryFriends(t *testing.T) {
+	type step struct {
+		op       string // request, accept or remove
+		from, to string
+		accepted bool
+		err      error
+	}
+	cases := []struct {
+		name  string
+		steps []step
+		// want is a's list after the steps.
+		want FriendList
+	}{
+		{
+			name:  "pending request",
+			steps: []step{{op: "request", from: "a", to: "b"}},
+			want:  FriendList{Outgoing: []Friend{{PlayerID: "b", Username: "bob"}}},
+		},
+		{
+			name:  "incoming request",
+			steps: []step{{op: "request", from: "b", to: "a"}},
+			want:  FriendList{Incoming: []Friend{{PlayerID: "b", Username: "bob"}}},
+		},
+		{
+			name: "accepted",
+			steps: []step{
+				{op: "request", from: "a", to: "b"},
+				{op: "accept", from: "b", to: "a"},
+			},
+			want: FriendList{Friends: []Friend{{PlayerID: "b", Username: "bob"}}},
+		},
+		{
+			name: "crossing requests",
+			steps: []step{
+				{op: "request", from: "a", to: "b"},
+				{op: "request", from: "b", to: "a", accepted: true},
+			},
+			want: FriendList{Friends: []Friend{{PlayerID: "b", Username: "bob"}}},
+		},
+		{
+			name: "repeated request",
+			steps: []step{
+				{op: "request", from: "a", to: "b"},
+				{op: "request", from: "a", to: "b", err: ErrAlreadyRequested},
+			},
+			want: FriendList{Outgoing: []Friend{{PlayerID: "b", Username: "bob"}}},
+		},
+		{
+			name: "request to a friend",
+			steps: []step{
+				{op: "request", from: "a", to: "b"},
+				{op: "accept", from: "b", to: "a"},
+				{op: "request", from: "b", to: "a", err: ErrAlreadyFriends},
+			},
+			want: FriendList{Friends: []Friend{{PlayerID: "b", Username: "bob"}}},
+		},
+		{
+			name: "accept own request",
+			steps: []step{
+				{op: "request", from: "a", to: "b"},
+				{op: "accept", from: "a", to: "b", err: ErrNoFriendRequest},
+			},
+			want: FriendList{Outgoing: []Friend{{PlayerID: "b", Username: "bob"}}},
+		},
+		{
+			name:  "self",
+			steps: []step{{op: "request", from: "a", to: "a", err: ErrSelfFriend}},
+		},
+		{
+			name: "removed",
+			steps: []step{
+				{op: "request", from: "a", to: "b"},
+				{op: "accept", from: "b", to: "a"},
+				{op: "remove", from: "b", to: "a"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := NewMemoryFriends()
+			_ = f.SetName(ctx, "a", "alice")
+			_ = f.SetName(ctx, "b", "bob")
+			for i, st := range tc.steps {
+				var accepted bool
+				var err error
+				switch st.op {
+				case "request":
+					accepted, err = f.Request(ctx, st.from, st.to)
+				case "accept":
+					err = f.Accept(ctx, st.from, st.to)
+				case "remove":
+					err = f.Remove(ctx, st.from, st.to)
+				}
+				if !errors.Is(err, st.err) || accepted != st.accepted {
+					t.Fatalf("step %d %s: got (%v, %v), want (%v, %v)", i, st.op, accepted, err, st.accepted, st.err)
+				}
+			}
+			got, err := f.List(ctx, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("list = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
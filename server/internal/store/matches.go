@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"miniarena/server/internal/battle"
+)
+
+var ErrMatchNotFound = errors.New("match not found")
+
+// MatchRecord is a finished match with every player's stats, best placement
+// first.
+type MatchRecord struct {
+	MatchID string
+	RoomID  string
+	Outcome string
+	Winner  string
+	Reason  string
+	Ticks   int64
+	EndedAt time.Time
+	Players []battle.PlayerStats
+}
+
+// Matches stores finished match results.
+type Matches interface {
+	SaveMatch(ctx context.Context, m MatchRecord) error
+	LoadMatch(ctx context.Context, matchID string) (MatchRecord, error)
+}
+
+var matchesSchema = []string{
+	`CREATE TABLE IF NOT EXISTS matches (
+	match_id VARCHAR(64)  NOT NULL PRIMARY KEY,
+	room_id  VARCHAR(64)  NOT NULL,
+	outcome  VARCHAR(16)  NOT NULL,
+	winner   VARCHAR(64)  NOT NULL,
+	reason   VARCHAR(128) NOT NULL,
+	ticks    BIGINT       NOT NULL,
+	ended_at TIMESTAMP    NOT NULL
+)`,
+	`CREATE TABLE IF NOT EXISTS match_players (
+	match_id      VARCHAR(64) NOT NULL,
+	player_id     VARCHAR(64) NOT NULL,
+	placement     INT         NOT NULL,
+	damage_dealt  INT         NOT NULL,
+	damage_taken  INT         NOT NULL,
+	skills_cast   INT         NOT NULL,
+	skills_landed INT         NOT NULL,
+	distance      FLOAT       NOT NULL,
+	ticks_alive   BIGINT      NOT NULL,
+	forfeited     TINYINT(1)  NOT NULL,
+	PRIMARY KEY (match_id, player_id),
+	KEY idx_player (player_id)
+)`,
+}
+
+type MySQLMatches struct {
+	db *sqlx.DB
+}
+
+func NewMySQLMatches(ctx context.Context, db *sqlx.DB) (*MySQLMatches, error) {
+	for _, stmt := range matchesSchema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &MySQLMatches{db: db}, nil
+}
+
+type matchPlayerRow struct {
+	PlayerID     string  `db:"player_id"`
+	Placement    int     `db:"placement"`
+	DamageDealt  int32   `db:"damage_dealt"`
+	DamageTaken  int32   `db:"damage_taken"`
+	SkillsCast   int32   `db:"skills_cast"`
+	SkillsLanded int32   `db:"skills_landed"`
+	Distance     float32 `db:"distance"`
+	TicksAlive   int64   `db:"ticks_alive"`
+	Forfeited    bool    `db:"forfeited"`
+}
+
+func (s *MySQLMatches) SaveMatch(ctx context.Context, m MatchRecord) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO matches (match_id, room_id, outcome, winner, reason, ticks, ended_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		m.MatchID, m.RoomID, m.Outcome, m.Winner, m.Reason, m.Ticks, m.EndedAt); err != nil {
+		return err
+	}
+	for _, p := range m.Players {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO match_players (match_id, player_id, placement, damage_dealt, damage_taken, skills_cast, skills_landed, distance, ticks_alive, forfeited)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.MatchID, p.PlayerID, p.Placement, p.DamageDealt, p.DamageTaken, p.SkillsCast, p.SkillsLanded, p.Distance, p.TicksAlive, p.Forfeited); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *MySQLMatches) LoadMatch(ctx context.Context, matchID string) (MatchRecord, error) {
+	var m struct {
+		MatchID string    `db:"match_id"`
+		RoomID  string    `db:"room_id"`
+		Outcome string    `db:"outcome"`
+		Winner  string    `db:"winner"`
+		Reason  string    `db:"reason"`
+		Ticks   int64     `db:"ticks"`
+		EndedAt time.Time `db:"ended_at"`
+	}
+	err := s.db.GetContext(ctx, &m,
+		`SELECT match_id, room_id, outcome, winner, reason, ticks, ended_at FROM matches WHERE match_id = ?`, matchID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return MatchRecord{}, ErrMatchNotFound
+	}
+	if err != nil {
+		return MatchRecord{}, err
+	}
+	var rows []matchPlayerRow
+	if err := s.db.SelectContext(ctx, &rows,
+		`SELECT player_id, placement, damage_dealt, damage_taken, skills_cast, skills_landed, distance, ticks_alive, forfeited
+		FROM match_players WHERE match_id = ? ORDER BY placement, player_id`, matchID); err != nil {
+		return MatchRecord{}, err
+	}
+	rec := MatchRecord{
+		MatchID: m.MatchID,
+		RoomID:  m.RoomID,
+		Outcome: m.Outcome,
+		Winner:  m.Winner,
+		Reason:  m.Reason,
+		Ticks:   m.Ticks,
+		EndedAt: m.EndedAt,
+	}
+	for _, r := range rows {
+		rec.Players = append(rec.Players, battle.PlayerStats(r))
+	}
+	return rec, nil
+}
+
+// memoryMatchLimit bounds how many results MemoryMatches keeps.
+const memoryMatchLimit = 1000
+
+// MemoryMatches keeps the most recent results in process.
+type MemoryMatches struct {
+	mu    sync.Mutex
+	byID  map[string]MatchRecord
+	order []string
+}
+
+func NewMemoryMatches() *MemoryMatches {
+	return &MemoryMatches{byID: make(map[string]MatchRecord)}
+}
+
+func (s *MemoryMatches) SaveMatch(ctx context.Context, m MatchRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[m.MatchID]; !ok {
+		s.order = append(s.order, m.MatchID)
+	}
+	s.byID[m.MatchID] = m
+	if len(s.order) > memoryMatchLimit {
+		delete(s.byID, s.order[0])
+		s.order = s.order[1:]
+	}
+	return nil
+}
+
+func (s *MemoryMatches) LoadMatch(ctx context.Context, matchID string) (MatchRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.byID[matchID]
+	if !ok {
+		return MatchRecord{}, ErrMatchNotFound
+	}
+	return m, nil
+}
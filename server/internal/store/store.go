@@ -12,11 +12,18 @@ import (
 	"miniarena/server/internal/config"
 )
 
+// checkpointTTL bounds how long an unfinished match can be recovered.
+const checkpointTTL = time.Hour
+
 type Store struct {
-	Redis *redis.Client
-	MySQL *sqlx.DB
-	Idem  Idempotency
-	log   *zap.Logger
+	Redis   *redis.Client
+	MySQL   *sqlx.DB
+	Idem    Idempotency
+	Friends Friends
+	Matches Matches
+	// Checkpoints is nil without Redis.
+	Checkpoints Checkpoints
+	log         *zap.Logger
 }
 
 func NewStore(cfg config.Config, log *zap.Logger) (*Store, error) {
@@ -47,10 +54,39 @@ func NewStore(cfg config.Config, log *zap.Logger) (*Store, error) {
 
 	if s.Redis != nil {
 		s.Idem = NewRedisIdem(s.Redis)
+		s.Checkpoints = NewRedisCheckpoints(s.Redis, checkpointTTL)
 	} else {
 		s.Idem = NewMemoryIdem()
 	}
 
+	if s.MySQL != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		friends, err := NewMySQLFriends(ctx, s.MySQL)
+		cancel()
+		if err != nil {
+			log.Warn("mysql friends schema failed", zap.Error(err))
+		} else {
+			s.Friends = friends
+		}
+	}
+	if s.Friends == nil {
+		s.Friends = NewMemoryFriends()
+	}
+
+	if s.MySQL != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		matches, err := NewMySQLMatches(ctx, s.MySQL)
+		cancel()
+		if err != nil {
+			log.Warn("mysql matches schema failed", zap.Error(err))
+		} else {
+			s.Matches = matches
+		}
+	}
+	if s.Matches == nil {
+		s.Matches = NewMemoryMatches()
+	}
+
 	return s, nil
 }
 